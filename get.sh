@@ -6,7 +6,12 @@ export REPO="ensi-local-ctl"
 export BIN_LOCATION="/opt/elc"
 export LINK_LOCATION="/usr/local/bin"
 
-version=$(curl -sI https://github.com/$OWNER/$REPO/releases/latest | grep -i "location:" | awk -F"/" '{ printf "%s", $NF }' | tr -d '\r')
+if [ "$ELC_UPDATE_CHANNEL" = "beta" ]; then
+  # the newest release including pre-releases
+  version=$(curl -s https://api.github.com/repos/$OWNER/$REPO/releases | grep -m 1 '"tag_name"' | awk -F'"' '{ printf "%s", $4 }')
+else
+  version=$(curl -sI https://github.com/$OWNER/$REPO/releases/latest | grep -i "location:" | awk -F"/" '{ printf "%s", $NF }' | tr -d '\r')
+fi
 
 if [ ! $version ]; then
   echo "Failed while attempting to install $REPO. Please manually install:"
@@ -35,6 +40,31 @@ curl -sSL $url --output "$targetFile"
 
 if [ "$?" = "0" ]; then
   echo "Download complete."
+
+  # checksum published with release only detects damaged downloads, pass ELC_EXPECTED_SHA256
+  # from a trusted source to check that binary is not replaced
+  expectedChecksum="$ELC_EXPECTED_SHA256"
+  if [ ! "$expectedChecksum" ]; then
+    expectedChecksum=$(curl -sSfL "$url.sha256" 2>/dev/null | awk '{ printf "%s", $1 }')
+  fi
+
+  if [ "$expectedChecksum" ]; then
+    actualChecksum=$(sha256sum "$targetFile" | awk '{ printf "%s", $1 }')
+    if [ "$actualChecksum" != "$expectedChecksum" ]; then
+      echo "Checksum of $targetFile does not match: expected $expectedChecksum, got $actualChecksum"
+      rm "$targetFile"
+      exit 1
+    fi
+    echo "Checksum verified."
+  elif [ "$ELC_SKIP_CHECKSUM" = "1" ]; then
+    echo "Checksum is not published for $version, downloaded binary is not verified because ELC_SKIP_CHECKSUM=1."
+  else
+    echo "Checksum is not published for $version, pass it with 'elc update --sha256=HASH'"
+    echo "or set ELC_SKIP_CHECKSUM=1 to install unverified binary, eg. curl -sSL .../get.sh | sudo ELC_SKIP_CHECKSUM=1 bash"
+    rm "$targetFile"
+    exit 1
+  fi
+
   chmod +x "$targetFile"
   mv "$targetFile" "$BIN_LOCATION/$PROGRAM_NAME-$version"
   if [ "$?" != "0" ]; then
@@ -3,43 +3,84 @@ package main
 import (
 	"fmt"
 	elc "github.com/madridianfox/elc/src"
-	"path"
+	"os"
+	"time"
 )
 
 func main() {
+	started := time.Now()
 	elc.Pc = &elc.RealPC{}
-	args := elc.Pc.Args()
+	defer elc.HandlePanic()
+	args, err := elc.ParseGlobalFlags(elc.Pc.Args()[1:])
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		elc.Pc.Exit(1)
+	}
+	args = append([]string{elc.Pc.Args()[0]}, args...)
+
+	homeDir, err := elc.Pc.HomeDir()
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		elc.Pc.Exit(1)
+	}
 
-	if elc.NeedHelp(args[1:], "COMMAND", []string{
+	homeConfigPath, err := elc.GetHomeConfigPath(homeDir, elc.Globals.Profile)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		elc.Pc.Exit(1)
+	}
+
+	err = elc.LoadColorTheme(homeConfigPath)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+	}
+
+	if elc.NeedHelp(args[1:], "[GLOBAL OPTIONS] COMMAND", []string{
 		"Available commands:",
-		fmt.Sprintf("  %-20s - %s", elc.Color("exec", elc.CYellow), "execute command inside service's container"),
-		fmt.Sprintf("  %-20s - %s", elc.Color("compose", elc.CYellow), "run docker-compose command"),
-		fmt.Sprintf("  %-20s - %s", elc.Color("destroy", elc.CYellow), "delete service containers"),
-		fmt.Sprintf("  %-20s - %s", elc.Color("help", elc.CYellow), "print this help message"),
-		fmt.Sprintf("  %-20s - %s", elc.Color("restart", elc.CYellow), "restart service"),
-		fmt.Sprintf("  %-20s - %s", elc.Color("set-hooks", elc.CYellow), "install git hooks"),
-		fmt.Sprintf("  %-20s - %s", elc.Color("start", elc.CYellow), "start service"),
-		fmt.Sprintf("  %-20s - %s", elc.Color("stop", elc.CYellow), "stop service"),
-		fmt.Sprintf("  %-20s - %s", elc.Color("vars", elc.CYellow), "print variables"),
-		fmt.Sprintf("  %-20s - %s", elc.Color("workspace", elc.CYellow), "manage workspaces"),
-		fmt.Sprintf("  %-20s - %s", elc.Color("update", elc.CYellow), "download new version of elc and replace current binary"),
-		fmt.Sprintf("  %-20s - %s", elc.Color("version", elc.CYellow), "print version"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("exec", elc.CHighlight), "execute command inside service's container"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("build", elc.CHighlight), "build images of services"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("compose", elc.CHighlight), "run docker-compose command"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("config", elc.CHighlight), "manage workspace config"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("destroy, rm", elc.CHighlight), "delete service containers"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("doctor", elc.CHighlight), "check home config and workspaces for common problems"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("enter, sh", elc.CHighlight), "open shell inside service's container"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("help", elc.CHighlight), "print this help message"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("hooks", elc.CHighlight), "run installed git hooks"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("is-running", elc.CHighlight), "check that service is running with exit code"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("logs", elc.CHighlight), "print logs of one or more services"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("module", elc.CHighlight), "manage modules"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("paths", elc.CHighlight), "print paths of configs, current directory and service"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("prune", elc.CHighlight), "remove unused docker resources of workspace"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("recreate", elc.CHighlight), "recreate service containers"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("restart", elc.CHighlight), "restart service"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("run-script", elc.CHighlight), "run script from workspace config"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("service", elc.CHighlight), "show information about services"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("set-hooks", elc.CHighlight), "install git hooks from one or several folders"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("start, up", elc.CHighlight), "start service"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("status", elc.CHighlight), "print status of services"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("stop, down", elc.CHighlight), "stop service"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("vars", elc.CHighlight), "print variables"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("workspace", elc.CHighlight), "manage workspaces"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("update", elc.CHighlight), "download new version of elc and replace current binary"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("version", elc.CHighlight), "print version"),
+		"If executable elc-COMMAND is found in PATH, it is run as plugin with the rest of arguments.",
 		"Any other arguments will be used for invoke of implicit exec command.",
 		"",
+		"Global options:",
+		fmt.Sprintf("  %-20s - %s", elc.Color("--cwd=DIR", elc.CHighlight), "use DIR instead of current directory to find service or module"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("--profile=NAME", elc.CHighlight), "use ~/.elc.NAME.yaml instead of ~/.elc.yaml with own list of workspaces"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("-q, --quiet", elc.CHighlight), "do not print informational messages and warnings, only errors and output of commands"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("--timings", elc.CHighlight), "print duration of start, stop and compose calls to stderr"),
+		fmt.Sprintf("  %-20s - %s", elc.Color("--verbose", elc.CHighlight), "print debug messages and details of internal errors, the latter is the same as ELC_DEBUG=1"),
+		"",
 		"You can get help for any command invoke it with '--help' option.",
 	}) {
 		elc.Pc.Exit(0)
 	}
-	var err error
 	var returnCode int
+	errorCode := 1
 
-	homeDir, err := elc.Pc.HomeDir()
-	if err != nil {
-		fmt.Println(err)
-		elc.Pc.Exit(1)
-	}
-
-	homeConfigPath := path.Join(homeDir, ".elc.yaml")
+	updateNotices := elc.StartUpdateCheck(homeConfigPath)
 
 	switch args[1] {
 	case "workspace":
@@ -48,40 +89,149 @@ func main() {
 			err = elc.CmdWorkspaceList(homeConfigPath, args[3:])
 		case "add":
 			err = elc.CmdWorkspaceAdd(homeConfigPath, args[3:])
+		case "init":
+			err = elc.CmdWorkspaceInit(homeConfigPath, args[3:])
 		case "select":
 			err = elc.CmdWorkspaceSelect(homeConfigPath, args[3:])
+		case "set-path":
+			err = elc.CmdWorkspaceSetPath(homeConfigPath, args[3:])
+		case "push":
+			err = elc.CmdWorkspacePush(homeConfigPath, args[3:])
+		case "pop":
+			err = elc.CmdWorkspacePop(homeConfigPath, args[3:])
 		case "show":
 			err = elc.CmdWorkspaceShow(homeConfigPath, args[3:])
+		case "export":
+			err = elc.CmdWorkspaceExport(homeConfigPath, args[3:])
+		case "import":
+			err = elc.CmdWorkspaceImport(homeConfigPath, args[3:])
+		case "doctor":
+			err = elc.CmdWorkspaceDoctor(homeConfigPath, args[3:])
 		default:
 			err = elc.CmdWorkspaceHelp()
 		}
-	case "start":
+	case "config":
+		subcommand := ""
+		if len(args) > 2 {
+			subcommand = args[2]
+		}
+		switch subcommand {
+		case "edit":
+			err = elc.CmdConfigEdit(homeConfigPath, args[3:])
+		case "get":
+			err = elc.CmdConfigGet(homeConfigPath, args[3:])
+		case "set":
+			err = elc.CmdConfigSet(homeConfigPath, args[3:])
+		case "migrate":
+			err = elc.CmdConfigMigrate(homeConfigPath, args[3:])
+		case "validate":
+			err = elc.CmdConfigValidate(homeConfigPath, args[3:])
+		default:
+			err = elc.CmdConfigHelp()
+		}
+	case "service":
+		subcommand := ""
+		if len(args) > 2 {
+			subcommand = args[2]
+		}
+		switch subcommand {
+		case "show":
+			err = elc.CmdServiceShow(homeConfigPath, args[3:])
+		case "path":
+			err = elc.CmdServicePath(homeConfigPath, args[3:])
+		case "project":
+			err = elc.CmdServiceProject(homeConfigPath, args[3:])
+		case "deps":
+			err = elc.CmdServiceDeps(homeConfigPath, args[3:])
+		case "rename":
+			err = elc.CmdServiceRename(homeConfigPath, args[3:])
+		case "tags-set":
+			err = elc.CmdServiceTagsSet(homeConfigPath, args[3:])
+		default:
+			err = elc.CmdServiceHelp()
+		}
+	case "module":
+		subcommand := ""
+		if len(args) > 2 {
+			subcommand = args[2]
+		}
+		switch subcommand {
+		case "add":
+			err = elc.CmdModuleAdd(homeConfigPath, args[3:])
+		case "exec":
+			returnCode, err = elc.CmdModuleExec(homeConfigPath, args[3:])
+		default:
+			err = elc.CmdModuleHelp()
+		}
+	case "start", "up":
 		err = elc.CmdServiceStart(homeConfigPath, args[2:])
-	case "stop":
+	case "stop", "down":
 		err = elc.CmdServiceStop(homeConfigPath, args[2:])
 	case "restart":
 		err = elc.CmdServiceRestart(homeConfigPath, args[2:])
-	case "destroy":
+	case "logs":
+		err = elc.CmdServiceLogs(homeConfigPath, args[2:])
+	case "build":
+		err = elc.CmdServiceBuild(homeConfigPath, args[2:])
+	case "recreate":
+		err = elc.CmdServiceRecreate(homeConfigPath, args[2:])
+	case "destroy", "rm":
 		err = elc.CmdServiceDestroy(homeConfigPath, args[2:])
 	case "compose":
 		returnCode, err = elc.CmdServiceCompose(homeConfigPath, args[2:])
 	case "vars":
-		err = elc.CmdServiceVars(homeConfigPath, args[2:])
+		if len(args) > 2 && args[2] == "diff" {
+			err = elc.CmdServiceVarsDiff(homeConfigPath, args[3:])
+		} else {
+			err = elc.CmdServiceVars(homeConfigPath, args[2:])
+		}
+	case "run-script":
+		returnCode, err = elc.CmdRunScript(homeConfigPath, args[2:])
 	case "set-hooks":
 		err = elc.CmdServiceSetHooks(args[2:])
+	case "hooks":
+		subcommand := ""
+		if len(args) > 2 {
+			subcommand = args[2]
+		}
+		switch subcommand {
+		case "run":
+			returnCode, err = elc.CmdHooksRun(args[3:])
+		default:
+			err = elc.CmdHooksHelp()
+		}
 	case "exec":
 		returnCode, err = elc.CmdServiceExec(homeConfigPath, args[2:])
+	case "enter", "sh":
+		returnCode, err = elc.CmdServiceEnter(homeConfigPath, args[2:])
 	case "update":
 		err = elc.CmdUpdate(homeConfigPath, args[2:])
+	case "doctor":
+		err = elc.CmdDoctor(homeConfigPath, args[2:])
+	case "prune":
+		err = elc.CmdPrune(homeConfigPath, args[2:])
+	case "is-running":
+		returnCode, err = elc.CmdIsRunning(homeConfigPath, args[2:])
+		errorCode = elc.IsRunningErrorCode
+	case "status":
+		err = elc.CmdStatus(homeConfigPath, args[2:])
+	case "paths":
+		err = elc.CmdPaths(homeConfigPath, args[2:])
 	case "version":
 		elc.CmdVersion()
 	default:
-		returnCode, err = elc.CmdServiceExec(homeConfigPath, args[1:])
+		if pluginPath, found := elc.FindPlugin(args[1]); found {
+			returnCode, err = elc.CmdPlugin(homeConfigPath, pluginPath, args[2:])
+		} else {
+			returnCode, err = elc.CmdServiceExec(homeConfigPath, args[1:])
+		}
 	}
+	elc.MeasureTime("total", started)
+	elc.PrintUpdateNotice(updateNotices)
 
 	if err != nil {
-		fmt.Println(err)
-		elc.Pc.Exit(1)
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		elc.Pc.Exit(errorCode)
 	}
 
 	elc.Pc.Exit(returnCode)
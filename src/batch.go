@@ -0,0 +1,214 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type svcAction func(svc *Service) error
+
+var errInterrupted = errors.New("interrupted")
+
+// interrupted is set when elc receives SIGINT while batch command is running.
+var interrupted int32
+
+func isInterrupted() bool {
+	return atomic.LoadInt32(&interrupted) == 1
+}
+
+// watchInterrupt catches SIGINT until returned function is called. First signal marks batch
+// as interrupted: child process gets Ctrl+C from terminal itself and elc waits for it, so no process
+// is left behind, and remaining services are skipped. Second signal terminates elc immediately.
+// SIGTERM is not caught, because it is not delivered to child process, so elc would wait for it forever.
+func watchInterrupt() func() {
+	atomic.StoreInt32(&interrupted, 0)
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt)
+
+	go func() {
+		defer HandlePanic()
+		for {
+			select {
+			case <-signals:
+				if atomic.SwapInt32(&interrupted, 1) == 1 {
+					Pc.Exit(130)
+				}
+				Warn("interrupted, waiting for current operation to finish, press Ctrl+C again to exit immediately\n")
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+		atomic.StoreInt32(&interrupted, 0)
+	}
+}
+
+type batchReport struct {
+	mutex    sync.Mutex
+	names    []string
+	statuses map[string]string
+}
+
+func newBatchReport(names []string) *batchReport {
+	report := &batchReport{names: names, statuses: make(map[string]string)}
+	for _, name := range names {
+		report.statuses[name] = "skipped"
+	}
+
+	return report
+}
+
+func (report *batchReport) set(name string, err error) {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	if err != nil {
+		report.statuses[name] = fmt.Sprintf("failed: %s", err)
+	} else {
+		report.statuses[name] = "done"
+	}
+}
+
+// print shows status of every service, report of single service is omitted.
+func (report *batchReport) print() {
+	if len(report.names) < 2 {
+		return
+	}
+
+	Info("%-20s %s\n", "SERVICE", "STATUS")
+	for _, name := range report.names {
+		Info("%-20s %s\n", name, report.statuses[name])
+	}
+}
+
+func applyAction(cfg *MainConfig, svcName string, action svcAction, report *batchReport) error {
+	svc, err := CreateFromSvcName(cfg, svcName)
+	if err == nil {
+		err = action(svc)
+	}
+	report.set(svcName, err)
+
+	return err
+}
+
+// runSequential applies action to services one by one and stops on first error.
+// With keepGoing it processes all services and returns errors of all failed ones.
+func runSequential(cfg *MainConfig, svcNames []string, keepGoing bool, action svcAction, report *batchReport) error {
+	errs := make([]error, 0)
+	for _, svcName := range svcNames {
+		if isInterrupted() {
+			return joinErrors(append(errs, errInterrupted))
+		}
+		err := applyAction(cfg, svcName, action, report)
+		if err != nil {
+			if !keepGoing {
+				return err
+			}
+			errs = append(errs, errors.New(fmt.Sprintf("%s: %s", svcName, err)))
+		}
+	}
+
+	return joinErrors(errs)
+}
+
+// runParallel applies action to every service using no more than workers goroutines
+// and returns errors of all failed services.
+func runParallel(cfg *MainConfig, svcNames []string, workers int, action svcAction, report *batchReport) error {
+	errs := make([]error, len(svcNames))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer HandlePanic()
+			for i := range jobs {
+				if isInterrupted() {
+					continue
+				}
+				err := applyAction(cfg, svcNames[i], action, report)
+				if err != nil {
+					errs[i] = errors.New(fmt.Sprintf("%s: %s", svcNames[i], err))
+				}
+			}
+		}()
+	}
+
+	for i := range svcNames {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if isInterrupted() {
+		errs = append(errs, errInterrupted)
+	}
+
+	return joinErrors(errs)
+}
+
+// createServices builds services for all names, result keeps order of names.
+// Building is cheap, it only reads config, so it is not worth running concurrently.
+func createServices(cfg *MainConfig, svcNames []string) ([]*Service, error) {
+	services := make([]*Service, 0, len(svcNames))
+	for _, svcName := range svcNames {
+		svc, err := CreateFromSvcName(cfg, svcName)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, svc)
+	}
+
+	return services, nil
+}
+
+func joinErrors(errs []error) error {
+	messages := make([]string, 0)
+	for _, err := range errs {
+		if err != nil {
+			messages = append(messages, err.Error())
+		}
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	return errors.New(strings.Join(messages, "\n"))
+}
+
+// shutdownServices applies action to services one by one or, if parallel is greater than 1,
+// concurrently by levels of dependencies starting with services which nobody depends on.
+func shutdownServices(cfg *MainConfig, svcNames []string, parallel int, keepGoing bool, action svcAction) error {
+	report := newBatchReport(svcNames)
+	defer report.print()
+
+	if parallel <= 1 {
+		return runSequential(cfg, svcNames, keepGoing, action, report)
+	}
+
+	errs := make([]error, 0)
+	levels := cfg.GroupByDependencyLevels(svcNames)
+	for i := len(levels) - 1; i >= 0; i-- {
+		err := runParallel(cfg, levels[i], parallel, action, report)
+		if err != nil {
+			if !keepGoing {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+
+	return joinErrors(errs)
+}
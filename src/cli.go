@@ -1,17 +1,127 @@
 package src
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"runtime/debug"
 	"strings"
+	"time"
 )
 
 const CReset = "\033[0m"
+const CRed = "\033[31m"
+const CGreen = "\033[32m"
 const CYellow = "\033[33m"
+const CBlue = "\033[34m"
+const CMagenta = "\033[35m"
+const CCyan = "\033[36m"
 
+// Roles of text in output, Color paints them with colors of current theme.
+const CHighlight = "highlight"
+const CError = "error"
+const CSuccess = "success"
+
+var colorNames = map[string]string{
+	"red":     CRed,
+	"green":   CGreen,
+	"yellow":  CYellow,
+	"blue":    CBlue,
+	"magenta": CMagenta,
+	"cyan":    CCyan,
+	"none":    "",
+}
+
+// colorThemes assign colors to roles of text, empty color means text without color.
+// Theme plain disables all colors, including colors of log prefixes.
+var colorThemes = map[string]map[string]string{
+	"default": {
+		CHighlight: CYellow,
+		CError:     CRed,
+		CSuccess:   CGreen,
+	},
+	"light": {
+		CHighlight: CBlue,
+		CError:     CRed,
+		CSuccess:   CGreen,
+	},
+	"plain": {
+		CHighlight: "",
+		CError:     "",
+		CSuccess:   "",
+	},
+}
+
+var palette = colorThemes["default"]
+var plainColors = false
+
+// Color paints text with color of role, e.g. CHighlight. Color itself, e.g. CCyan, is used as is,
+// when text has no role, like prefixes of logs which only have to differ from each other.
 func Color(text string, color string) string {
+	if code, found := palette[color]; found {
+		color = code
+	}
+	if color == "" || plainColors {
+		return text
+	}
 	return fmt.Sprintf("%s%s%s", color, text, CReset)
 }
 
+// setColorTheme fills palette with colors of theme, colors of roles are overridden by names, e.g. highlight: blue.
+func setColorTheme(theme string, colors map[string]string) error {
+	if theme == "" {
+		theme = "default"
+	}
+	themeColors, found := colorThemes[theme]
+	if !found {
+		return errors.New(fmt.Sprintf("unknown color theme '%s', use one of: default, light, plain", theme))
+	}
+
+	result := make(map[string]string)
+	for role, color := range themeColors {
+		result[role] = color
+	}
+	for role, colorName := range colors {
+		if _, found := result[role]; !found {
+			return errors.New(fmt.Sprintf("unknown role '%s' in colors of home config, use one of: %s, %s, %s", role, CHighlight, CError, CSuccess))
+		}
+		color, found := colorNames[colorName]
+		if !found {
+			return errors.New(fmt.Sprintf("unknown color '%s' in home config", colorName))
+		}
+		result[role] = color
+	}
+	palette = result
+	plainColors = theme == "plain"
+
+	return nil
+}
+
+// preloadedHC is home config read by LoadColorTheme, first command which loads the same home config
+// takes it instead of reading and parsing file again.
+var preloadedHC *HomeConfig
+
+// LoadColorTheme applies color_theme and colors from home config, it is called before any output,
+// so help messages are printed with configured colors too. Invalid home config is not reported here,
+// command reports it when loads home config.
+func LoadColorTheme(homeConfigPath string) error {
+	if !Pc.FileExists(homeConfigPath) {
+		return nil
+	}
+	hc, err := LoadHomeConfig(homeConfigPath)
+	if err != nil {
+		return nil
+	}
+	preloadedHC = hc
+
+	return setColorTheme(hc.ColorTheme, hc.Colors)
+}
+
+// setTerminalTitle changes title of terminal window or tab, empty title resets it to default.
+func setTerminalTitle(title string) {
+	_, _ = Pc.Printf("\033]0;%s\007", title)
+}
+
 func NeedHelp(args []string, usage string, lines []string) bool {
 	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help" || args[0] == "help") {
 		fmt.Printf("Usage: %s %s\n", Pc.Args()[0], usage)
@@ -24,3 +134,135 @@ func NeedHelp(args []string, usage string, lines []string) bool {
 	}
 	return false
 }
+
+type GlobalParams struct {
+	Cwd     string
+	Profile string
+	Timings bool
+	Quiet   bool
+	Verbose bool
+}
+
+var Globals = &GlobalParams{}
+
+func addGlobalFlags(fs *flag.FlagSet, params *GlobalParams) {
+	fs.StringVar(&params.Cwd, "cwd", "", "use DIR instead of current directory")
+	fs.StringVar(&params.Profile, "profile", "", "use separate home config for profile NAME")
+	fs.BoolVar(&params.Timings, "timings", false, "print duration of operations to stderr")
+	fs.BoolVar(&params.Quiet, "quiet", false, "do not print informational messages and warnings")
+	fs.BoolVar(&params.Quiet, "q", false, "do not print informational messages and warnings")
+	fs.BoolVar(&params.Verbose, "verbose", false, "print debug messages and details of internal errors")
+}
+
+// ParseGlobalFlags consumes known global options from the beginning of args
+// and returns the rest. Unknown options are left untouched, because they may
+// belong to implicit exec command.
+func ParseGlobalFlags(args []string) ([]string, error) {
+	fs := flag.NewFlagSet("elc", flag.ContinueOnError)
+	addGlobalFlags(fs, Globals)
+
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		name := strings.SplitN(strings.TrimLeft(args[0], "-"), "=", 2)[0]
+		fl := fs.Lookup(name)
+		if fl == nil {
+			break
+		}
+
+		count := 1
+		boolFlag, isBool := fl.Value.(interface{ IsBoolFlag() bool })
+		if !strings.Contains(args[0], "=") && !(isBool && boolFlag.IsBoolFlag()) {
+			count = 2
+		}
+		if count > len(args) {
+			return nil, errors.New(fmt.Sprintf("option %s requires a value", args[0]))
+		}
+
+		err := fs.Parse(args[:count])
+		if err != nil {
+			return nil, err
+		}
+		args = args[count:]
+	}
+
+	return args, nil
+}
+
+// MeasureTime prints duration of operation to stderr if --timings option is set.
+// Use it with defer: defer MeasureTime("operation", time.Now())
+func MeasureTime(operation string, started time.Time) {
+	if Globals.Timings {
+		_, _ = Pc.Eprintf("%-40s %s\n", operation, time.Since(started).Round(time.Millisecond))
+	}
+}
+
+// Messages of elc have levels: debug messages are printed only with --verbose option,
+// info and warnings are suppressed by --quiet option, errors are printed always.
+// Info goes to stdout next to output of commands, other levels go to stderr.
+// Output of commands, which may be used by scripts, must be printed with Pc directly.
+
+// Debug prints details which help to find out why elc behaves so, e.g. why service is skipped.
+func Debug(format string, a ...interface{}) {
+	if Globals.Verbose && !Globals.Quiet {
+		_, _ = Pc.Eprintf(format, a...)
+	}
+}
+
+// Info prints informational message about progress of command.
+func Info(format string, a ...interface{}) {
+	if !Globals.Quiet {
+		_, _ = Pc.Printf(format, a...)
+	}
+}
+
+// Warn prints message about something user should pay attention to, but command is not failed.
+func Warn(format string, a ...interface{}) {
+	if !Globals.Quiet {
+		_, _ = Pc.Eprintf(format, a...)
+	}
+}
+
+// Error prints error which does not stop command, errors which do are returned to main.
+func Error(format string, a ...interface{}) {
+	_, _ = Pc.Eprintf(format, a...)
+}
+
+// askConfirmation asks user a yes/no question, without terminal on stdin the answer is "no".
+func askConfirmation(question string) (bool, error) {
+	if !Pc.IsStdinTerminal() {
+		return false, nil
+	}
+
+	_, _ = Pc.Eprintf("%s [y/N] ", question)
+	answer, err := Pc.ReadLine()
+	if err != nil {
+		return false, err
+	}
+
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
+}
+
+// debugEnv enables the same details of internal errors as --verbose option.
+const debugEnv = "ELC_DEBUG"
+
+const issuesUrl = "https://github.com/MadridianFox/ensi-local-ctl/issues"
+
+// HandlePanic must be deferred in main and in every goroutine started by elc, because panic can be
+// recovered only in its own goroutine. It replaces go trace of unexpected error with short message,
+// full trace is printed only with --verbose option or ELC_DEBUG variable.
+func HandlePanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	_, _ = Pc.Eprintf("internal error: %v\n", r)
+	debugValue, found := Pc.LookupEnv(debugEnv)
+	if Globals.Verbose || (found && debugValue != "" && debugValue != "0") {
+		_, _ = Pc.Eprintf("%s\n", debug.Stack())
+	} else {
+		_, _ = Pc.Eprintf("run command with --verbose option or %s=1 to see details\n", debugEnv)
+	}
+	_, _ = Pc.Eprintf("please report it at %s\n", issuesUrl)
+	Pc.Exit(2)
+}
@@ -1,10 +1,21 @@
 package src
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"gopkg.in/yaml.v2"
 	"os"
+	"os/signal"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 func checkAndLoadHC(homeConfigPath string) (*HomeConfig, error) {
@@ -17,9 +28,37 @@ func checkAndLoadHC(homeConfigPath string) (*HomeConfig, error) {
 		return nil, err
 	}
 
+	if hc.LogFile != "" {
+		homeDir, err := Pc.HomeDir()
+		if err != nil {
+			return nil, err
+		}
+		enableExecLog(expandHomePath(homeDir, hc.LogFile))
+	}
+
 	return hc, nil
 }
 
+func getCwd() (string, error) {
+	cwd, err := Pc.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	if Globals.Cwd == "" {
+		return cwd, nil
+	}
+
+	if path.IsAbs(Globals.Cwd) {
+		return path.Clean(Globals.Cwd), nil
+	}
+
+	return path.Join(cwd, Globals.Cwd), nil
+}
+
+// modeEnv overrides default mode of workspace and home configs, but not --mode option.
+const modeEnv = "ELC_MODE"
+
 func getWorkspaceConfig(homeConfigPath string) (*MainConfig, error) {
 	hc, err := checkAndLoadHC(homeConfigPath)
 	if err != nil {
@@ -31,12 +70,17 @@ func getWorkspaceConfig(homeConfigPath string) (*MainConfig, error) {
 		return nil, err
 	}
 
-	cwd, err := Pc.Getwd()
+	if !Pc.FileExists(wsPath) {
+		return nil, errors.New(fmt.Sprintf("directory of workspace '%s' is not found at %s, fix it with 'elc workspace set-path %s PATH'", hc.CurrentWorkspace, wsPath, hc.CurrentWorkspace))
+	}
+
+	cwd, err := getCwd()
 	if err != nil {
 		return nil, err
 	}
 
 	cfg := NewConfig(wsPath, cwd)
+	cfg.ConfigFile = hc.getCurrentWsConfig()
 	err = cfg.LoadFromFile()
 	if err != nil {
 		return nil, err
@@ -47,12 +91,205 @@ func getWorkspaceConfig(homeConfigPath string) (*MainConfig, error) {
 		return nil, err
 	}
 
+	err = cfg.setComposeEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	envMode, _ := Pc.LookupEnv(modeEnv)
+	cfg.DefaultMode = resolveDefaultMode(cfg.DefaultMode, hc.DefaultMode, envMode)
+	cfg.RememberLastService = hc.RememberLastService
+
+	for _, name := range hc.PushedWorkspaces {
+		if name == hc.CurrentWorkspace {
+			continue
+		}
+
+		ws := hc.findWorkspace(name)
+		if ws == nil {
+			return nil, errors.New(fmt.Sprintf("pushed workspace '%s' is not defined, remove it with 'elc workspace pop %s'", name, name))
+		}
+
+		stacked := NewConfig(ws.Path, cwd)
+		stacked.ConfigFile = ws.Config
+		err = stacked.LoadFromFile()
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("workspace '%s': %s", name, err))
+		}
+		stacked.DefaultMode = resolveDefaultMode(stacked.DefaultMode, hc.DefaultMode, envMode)
+		stacked.runOptions = cfg.runOptions
+		stacked.Runner = cfg.Runner
+		if stacked.ComposeEngine != "" {
+			stacked.Runner, err = newComposeRunner(stacked.ComposeEngine)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("workspace '%s': %s", name, err))
+			}
+		}
+		cfg.Stacked = append(cfg.Stacked, stacked)
+	}
+
 	return cfg, nil
 }
 
+// resolveDefaultMode returns mode from ELC_MODE variable, workspace config or home config, in order of priority.
+func resolveDefaultMode(wsMode string, homeMode string, envMode string) string {
+	if envMode != "" {
+		return envMode
+	}
+	if wsMode != "" {
+		return wsMode
+	}
+
+	return homeMode
+}
+
+// rememberLastService saves explicitly passed service name to workspace state, if remember_last_service is enabled.
+func rememberLastService(cfg *MainConfig, svcName string) error {
+	if !cfg.RememberLastService {
+		return nil
+	}
+
+	state, err := LoadWorkspaceState(cfg.WorkspacePath)
+	if err != nil {
+		return err
+	}
+	if state.LastService == svcName {
+		return nil
+	}
+	state.LastService = svcName
+
+	return SaveWorkspaceState(state)
+}
+
+// findServiceByPathOrLast returns service found with current directory or,
+// if remember_last_service is enabled, service used last time.
+func findServiceByPathOrLast(cfg *MainConfig) (string, error) {
+	svcName, err := cfg.FindServiceByPath()
+	if err == nil {
+		return svcName, nil
+	}
+	if !cfg.RememberLastService {
+		return selectService(cfg, err)
+	}
+
+	state, stateErr := LoadWorkspaceState(cfg.WorkspacePath)
+	if stateErr != nil || state.LastService == "" {
+		return selectService(cfg, err)
+	}
+
+	return state.LastService, nil
+}
+
+// selectService asks user to choose service from numbered list, when service can not be found with
+// current directory. Without terminal on stdin the reason is returned as is.
+func selectService(cfg *MainConfig, reason error) (string, error) {
+	if !Pc.IsStdinTerminal() {
+		return "", reason
+	}
+
+	svcNames := cfg.GetAllSvcNames()
+	if len(svcNames) == 0 {
+		return "", reason
+	}
+	sort.Strings(svcNames)
+
+	_, _ = Pc.Eprintf("%s, select service:\n", reason)
+	for i, name := range svcNames {
+		_, _ = Pc.Eprintf("%3d) %s\n", i+1, name)
+	}
+	_, _ = Pc.Eprintf("number of service: ")
+
+	answer, err := Pc.ReadLine()
+	if err != nil {
+		return "", err
+	}
+
+	number, err := strconv.Atoi(answer)
+	if err != nil || number < 1 || number > len(svcNames) {
+		return "", errors.New(fmt.Sprintf("invalid number of service '%s'", answer))
+	}
+
+	return svcNames[number-1], nil
+}
+
+func isFlagPassed(fs *flag.FlagSet, name string) bool {
+	passed := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+
+	return passed
+}
+
+// applyStartDefaults fills start params with values from config, if corresponding options are not passed.
+func applyStartDefaults(fs *flag.FlagSet, cfg *MainConfig, params *SvcStartParams) error {
+	if !isFlagPassed(fs, "mode") && cfg.DefaultMode != "" {
+		params.Mode = cfg.DefaultMode
+	}
+
+	if !isFlagPassed(fs, "dep-timeout") && cfg.DepTimeout != "" {
+		timeout, err := time.ParseDuration(cfg.DepTimeout)
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid dep_timeout '%s' in workspace config: %s", cfg.DepTimeout, err))
+		}
+		params.DepTimeout = timeout
+	}
+
+	return nil
+}
+
 func addStartFlags(fs *flag.FlagSet, params *SvcStartParams) {
 	fs.StringVar(&params.Mode, "mode", "default", "tag for dependencies selecting")
 	fs.BoolVar(&params.Force, "force", false, "force start dependencies")
+	fs.DurationVar(&params.DepTimeout, "dep-timeout", 0, "timeout for starting of dependencies")
+	fs.BoolVar(&params.NoPortCheck, "no-port-check", false, "do not check that published ports are free")
+}
+
+// printCmdFlags keeps options --print-cmd and --show-secrets, values of secret variables
+// are masked in printed commands unless --show-secrets is passed.
+type printCmdFlags struct {
+	printCmd    bool
+	showSecrets bool
+}
+
+func addPrintCmdFlag(fs *flag.FlagSet) *printCmdFlags {
+	flags := &printCmdFlags{}
+	fs.BoolVar(&flags.printCmd, "print-cmd", false, "print commands instead of running them")
+	fs.BoolVar(&flags.showSecrets, "show-secrets", false, "print values of secret variables in printed commands")
+	return flags
+}
+
+func (flags *printCmdFlags) apply(cfg *MainConfig) {
+	cfg.PrintCmd = flags.printCmd
+	cfg.ShowSecrets = flags.showSecrets
+}
+
+// overridesFlag collects values of repeatable option --set KEY=VALUE.
+type overridesFlag struct {
+	ctx Context
+}
+
+func (f *overridesFlag) String() string {
+	return strings.Join(f.ctx.renderMapToEnv(), " ")
+}
+
+func (f *overridesFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return errors.New(fmt.Sprintf("invalid value '%s' of option --set, expected KEY=VALUE", value))
+	}
+	f.ctx = f.ctx.add(parts[0], parts[1])
+
+	return nil
+}
+
+func addSetFlag(fs *flag.FlagSet) *overridesFlag {
+	overrides := &overridesFlag{}
+	fs.Var(overrides, "set", "override variable of service")
+
+	return overrides
 }
 
 func addComposeFlags(fs *flag.FlagSet, params *SvcComposeParams) {
@@ -61,11 +298,21 @@ func addComposeFlags(fs *flag.FlagSet, params *SvcComposeParams) {
 
 func addExecFlags(fs *flag.FlagSet, params *SvcExecParams) {
 	fs.IntVar(&params.UID, "uid", Pc.Getuid(), "user id")
+	fs.StringVar(&params.User, "user", "", "user name")
+	fs.BoolVar(&params.Detach, "detach", false, "run command in background")
+	fs.BoolVar(&params.Detach, "d", false, "run command in background")
+	fs.BoolVar(&params.NoTTY, "no-tty", false, "do not allocate tty")
+	fs.BoolVar(&params.NoTTY, "T", false, "do not allocate tty")
+	fs.StringVar(&params.DetachKeys, "detach-keys", "", "key sequence for detaching from container")
+	fs.StringVar(&params.WorkingDir, "workdir", "", "working directory inside container")
 }
 
 func CmdWorkspaceList(homeConfigPath string, args []string) error {
-	if NeedHelp(args, "workspace list", []string{
+	if NeedHelp(args, "workspace list [OPTIONS]", []string{
 		"Show list of registered workspaces.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--format=FORMAT", CHighlight), "output format: table (default), json or plain"),
 	}) {
 		return nil
 	}
@@ -74,16 +321,31 @@ func CmdWorkspaceList(homeConfigPath string, args []string) error {
 		return err
 	}
 
+	fs := flag.NewFlagSet("workspace list", flag.ContinueOnError)
+	var format string
+	addFormatFlag(fs, &format, FormatTable)
+	err = fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	table := &OutputTable{Columns: []string{"name", "path"}}
 	for _, workspace := range hc.Workspaces {
-		_, _ = Pc.Printf("%-10s %s\n", workspace.Name, workspace.Path)
+		table.Rows = append(table.Rows, []string{workspace.Name, workspace.Path})
 	}
 
-	return nil
+	return table.Print(format)
 }
 
 func CmdWorkspaceAdd(homeConfigPath string, args []string) error {
-	if NeedHelp(args, "workspace add NAME PATH", []string{
+	if NeedHelp(args, "workspace add [OPTIONS] NAME PATH", []string{
 		"Register new workspace.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--config=FILE", CHighlight), "use FILE as config of workspace, relative to PATH, instead of workspace.yaml"),
+		"",
+		"Only config file is replaced: env.yaml, .env and state of services are taken from PATH,",
+		"so they are shared with other workspaces registered with the same PATH.",
 	}) {
 		return nil
 	}
@@ -92,24 +354,32 @@ func CmdWorkspaceAdd(homeConfigPath string, args []string) error {
 		return err
 	}
 
-	if len(args) != 2 {
+	fs := flag.NewFlagSet("workspace add", flag.ContinueOnError)
+	configFile := fs.String("config", "", "config file of workspace")
+	err = fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
 		return errors.New("command requires exactly 2 arguments")
 	}
 
-	name := args[0]
-	wsPath := args[1]
+	return addWorkspace(hc, fs.Arg(0), fs.Arg(1), *configFile)
+}
 
+func addWorkspace(hc *HomeConfig, name string, wsPath string, configFile string) error {
 	ws := hc.findWorkspace(name)
 	if ws != nil {
 		return errors.New(fmt.Sprintf("workspace with name '%s' already exists", name))
 	}
 
-	err = hc.AddWorkspace(name, wsPath)
+	err := hc.AddWorkspace(name, wsPath, configFile)
 	if err != nil {
 		return err
 	}
 
-	_, _ = Pc.Printf("workspace '%s' is added\n", name)
+	Info("workspace '%s' is added\n", name)
 
 	if hc.CurrentWorkspace == "" {
 		hc.CurrentWorkspace = name
@@ -118,7 +388,7 @@ func CmdWorkspaceAdd(homeConfigPath string, args []string) error {
 			return err
 		}
 
-		_, _ = Pc.Printf("active workspace changed to '%s'\n", name)
+		Info("active workspace changed to '%s'\n", name)
 	}
 
 	return nil
@@ -152,13 +422,14 @@ func CmdWorkspaceSelect(homeConfigPath string, args []string) error {
 		return err
 	}
 
-	_, _ = Pc.Printf("active workspace changed to '%s'\n", name)
+	Info("active workspace changed to '%s'\n", name)
 	return nil
 }
 
-func CmdWorkspaceShow(homeConfigPath string, args []string) error {
-	if NeedHelp(args, "workspace show", []string{
-		"Print current workspace name.",
+func CmdWorkspacePush(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "workspace push NAME", []string{
+		"Add services of workspace NAME to current workspace.",
+		"Services are searched in current workspace first and then in pushed workspaces in order they were pushed.",
 	}) {
 		return nil
 	}
@@ -166,274 +437,1849 @@ func CmdWorkspaceShow(homeConfigPath string, args []string) error {
 	if err != nil {
 		return err
 	}
-	_, _ = Pc.Println(hc.CurrentWorkspace)
 
-	return nil
-}
+	if len(args) != 1 {
+		return errors.New("command requires exactly 1 argument")
+	}
 
-func CmdWorkspaceHelp() error {
-	NeedHelp([]string{"--help"}, "workspace COMMAND", []string{
-		"Available commands:",
-		fmt.Sprintf("  %-18s - %s", Color("ls, list", CYellow), "list available workspaces"),
-		fmt.Sprintf("  %-18s - %s", Color("show", CYellow), "how current workspace name"),
-		fmt.Sprintf("  %-18s - %s", Color("add", CYellow), "add new workspace"),
-		fmt.Sprintf("  %-18s - %s", Color("select", CYellow), "select workspace as current"),
-	})
-	return nil
-}
+	name := args[0]
 
-func CmdVersion() {
-	fmt.Printf("v%s\n", Version)
+	ws := hc.findWorkspace(name)
+	if ws == nil {
+		return errors.New(fmt.Sprintf("workspace with name '%s' is not defined", name))
+	}
+
+	if contains(hc.PushedWorkspaces, name) {
+		return errors.New(fmt.Sprintf("workspace '%s' is already pushed", name))
+	}
+
+	hc.PushedWorkspaces = append(hc.PushedWorkspaces, name)
+	err = SaveHomeConfig(hc)
+	if err != nil {
+		return err
+	}
+
+	Info("workspace '%s' pushed\n", name)
+	return nil
 }
 
-func CmdServiceStart(homeConfigPath string, args []string) error {
-	if NeedHelp(args, "start [OPTIONS] [NAMES...]", []string{
-		"Start one or more services.",
-		"By default starts service found with current directory, but you can pass one or more service names instead.",
-		"",
-		"Available options:",
-		fmt.Sprintf("  %-20s - %s", Color("--force", CYellow), "force start dependencies, even if service already started"),
-		fmt.Sprintf("  %-20s - %s", Color("--mode=MODE", CYellow), "start only dependencies with specified mode, by default starts 'default' dependencies"),
+func CmdWorkspacePop(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "workspace pop [NAME]", []string{
+		"Remove workspace NAME or the last pushed workspace from list of pushed workspaces.",
 	}) {
 		return nil
 	}
-	fs := flag.NewFlagSet("start", flag.ContinueOnError)
-	startParams := &SvcStartParams{}
-	addStartFlags(fs, startParams)
-	err := fs.Parse(args)
+	hc, err := checkAndLoadHC(homeConfigPath)
 	if err != nil {
 		return err
 	}
 
-	cfg, err := getWorkspaceConfig(homeConfigPath)
-	if err != nil {
-		return err
+	if len(hc.PushedWorkspaces) == 0 {
+		return errors.New("there are no pushed workspaces")
 	}
 
-	svcNames := fs.Args()
-	if len(svcNames) > 0 {
-		for _, svcName := range svcNames {
-			svc, err := CreateFromSvcName(cfg, svcName)
-			if err != nil {
-				return err
-			}
+	name := hc.PushedWorkspaces[len(hc.PushedWorkspaces)-1]
+	if len(args) > 0 {
+		name = args[0]
+	}
 
-			err = svc.Start(startParams)
-			if err != nil {
-				return err
-			}
-		}
-	} else {
-		svcName, err := cfg.FindServiceByPath()
-		if err != nil {
-			return err
-		}
+	if !contains(hc.PushedWorkspaces, name) {
+		return errors.New(fmt.Sprintf("workspace '%s' is not pushed", name))
+	}
 
-		svc, err := CreateFromSvcName(cfg, svcName)
-		if err != nil {
-			return err
+	pushed := make([]string, 0, len(hc.PushedWorkspaces))
+	for _, item := range hc.PushedWorkspaces {
+		if item != name {
+			pushed = append(pushed, item)
 		}
+	}
+	hc.PushedWorkspaces = pushed
 
-		err = svc.Start(startParams)
-		if err != nil {
-			return err
-		}
+	err = SaveHomeConfig(hc)
+	if err != nil {
+		return err
 	}
 
+	Info("workspace '%s' popped\n", name)
 	return nil
 }
 
-func CmdServiceStop(homeConfigPath string, args []string) error {
-	if NeedHelp(args, "stop [NAMES...]", []string{
-		"Stop one or more services.",
-		"By default stops service found with current directory, but you can pass one or more service names instead.",
-		"",
-		"Available options:",
-		fmt.Sprintf("  %-20s - %s", Color("--all", CYellow), "stop all services"),
+func CmdWorkspaceSetPath(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "workspace set-path NAME PATH", []string{
+		"Change path of registered workspace, eg. after it was moved to another directory.",
 	}) {
 		return nil
 	}
-	cfg, err := getWorkspaceConfig(homeConfigPath)
-	if err != nil {
-		return err
-	}
-
-	fs := flag.NewFlagSet("stop", flag.ContinueOnError)
-	all := fs.Bool("all", false, "stop all services")
-	err = fs.Parse(args)
+	hc, err := checkAndLoadHC(homeConfigPath)
 	if err != nil {
 		return err
 	}
 
-	var svcNames []string
-	if *all {
-		svcNames = cfg.GetAllSvcNames()
-	} else {
-		svcNames = args
+	if len(args) != 2 {
+		return errors.New("command requires exactly 2 arguments")
 	}
 
-	if len(svcNames) > 0 {
-		for _, svcName := range svcNames {
-			svc, err := CreateFromSvcName(cfg, svcName)
-			if err != nil {
-				return err
-			}
-			err = svc.Stop()
-			if err != nil {
-				return err
-			}
-		}
-	} else {
-		svcName, err := cfg.FindServiceByPath()
-		if err != nil {
-			return err
-		}
-
-		svc, err := CreateFromSvcName(cfg, svcName)
-		if err != nil {
-			return err
+	found := false
+	for i, workspace := range hc.Workspaces {
+		if workspace.Name == args[0] {
+			hc.Workspaces[i].Path = args[1]
+			found = true
 		}
+	}
+	if !found {
+		return errors.New(fmt.Sprintf("workspace with name '%s' is not defined", args[0]))
+	}
 
-		err = svc.Stop()
-		if err != nil {
-			return err
-		}
+	err = SaveHomeConfig(hc)
+	if err != nil {
+		return err
 	}
 
+	Info("path of workspace '%s' changed to %s\n", args[0], args[1])
+
 	return nil
 }
 
-func CmdServiceDestroy(homeConfigPath string, args []string) error {
-	if NeedHelp(args, "destroy [NAMES...]", []string{
-		"Stop and remove containers of one or more services.",
-		"By default destroys service found with current directory, but you can pass one or more service names instead.",
+func CmdWorkspaceShow(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "workspace show [OPTIONS]", []string{
+		"Print current workspace name.",
 		"",
 		"Available options:",
-		fmt.Sprintf("  %-20s - %s", Color("--all", CYellow), "destroy all services"),
+		fmt.Sprintf("  %-20s - %s", Color("--verbose", CHighlight), "print also path, config file and number of services of workspace"),
 	}) {
 		return nil
 	}
-	cfg, err := getWorkspaceConfig(homeConfigPath)
+	hc, err := checkAndLoadHC(homeConfigPath)
 	if err != nil {
 		return err
 	}
 
-	fs := flag.NewFlagSet("stop", flag.ContinueOnError)
-	all := fs.Bool("all", false, "stop all services")
+	fs := flag.NewFlagSet("workspace show", flag.ContinueOnError)
+	verbose := fs.Bool("verbose", false, "print details of workspace")
 	err = fs.Parse(args)
 	if err != nil {
 		return err
 	}
 
-	var svcNames []string
-	if *all {
-		svcNames = cfg.GetAllSvcNames()
-	} else {
-		svcNames = args
+	if !*verbose {
+		_, _ = Pc.Println(hc.CurrentWorkspace)
+		return nil
 	}
 
-	if len(svcNames) > 0 {
-		for _, svcName := range svcNames {
-			svc, err := CreateFromSvcName(cfg, svcName)
-			if err != nil {
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return err
+	}
+	configPath, _ := cfg.findConfigFile()
+
+	_, _ = Pc.Printf("%-10s %s\n", "name:", hc.CurrentWorkspace)
+	_, _ = Pc.Printf("%-10s %s\n", "path:", cfg.WorkspacePath)
+	_, _ = Pc.Printf("%-10s %s\n", "config:", configPath)
+	_, _ = Pc.Printf("%-10s %d\n", "services:", len(cfg.Services))
+
+	return nil
+}
+
+const workspaceConfigTemplate = `name: %s
+elc_min_version: %s
+variables:
+  NETWORK: ${NETWORK:-%s}
+services:
+  app:
+    path: ${WORKSPACE_PATH}/apps/app
+    variables:
+      APP_IMAGE: nginx:alpine
+`
+
+func CmdWorkspaceInit(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "workspace init [OPTIONS] [PATH]", []string{
+		"Create workspace config with example service in PATH and register it as new workspace.",
+		"By default uses current directory. Existing config will not be overwritten.",
+		"If workspace in PATH is already registered, only its config is created.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--name=NAME", CHighlight), "name of workspace, by default name of directory"),
+		fmt.Sprintf("  %-20s - %s", Color("--config=FILE", CHighlight), "create FILE, relative to PATH, instead of workspace.yaml and register workspace with it"),
+	}) {
+		return nil
+	}
+	fs := flag.NewFlagSet("workspace init", flag.ContinueOnError)
+	name := fs.String("name", "", "name of workspace")
+	configFile := fs.String("config", "", "config file of workspace")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() > 1 {
+		return errors.New("command accepts only 1 argument")
+	}
+
+	hc, err := checkAndLoadHC(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	wsPath, err := getCwd()
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 1 {
+		if path.IsAbs(fs.Arg(0)) {
+			wsPath = path.Clean(fs.Arg(0))
+		} else {
+			wsPath = path.Join(wsPath, fs.Arg(0))
+		}
+	}
+
+	if *name == "" {
+		*name = path.Base(wsPath)
+		for _, workspace := range hc.Workspaces {
+			if path.Clean(workspace.Path) == wsPath {
+				*name = workspace.Name
+			}
+		}
+	}
+
+	registered := hc.findWorkspace(*name)
+	if registered != nil && path.Clean(registered.Path) != wsPath {
+		return errors.New(fmt.Sprintf("workspace with name '%s' already exists", *name))
+	}
+	if registered != nil && *configFile != "" && *configFile != registered.Config {
+		return errors.New(fmt.Sprintf("workspace '%s' is already registered with another config", *name))
+	}
+	if registered != nil {
+		*configFile = registered.Config
+	}
+
+	cfg := NewConfig(wsPath, wsPath)
+	cfg.ConfigFile = *configFile
+	configPath, found := cfg.findConfigFile()
+	if found {
+		Info("config %s already exists, skipped\n", configPath)
+	} else {
+		data := fmt.Sprintf(workspaceConfigTemplate, *name, Version, *name)
+		err = Pc.WriteFile(configPath, []byte(data), 0644)
+		if err != nil {
+			return err
+		}
+		Info("config %s is created\n", configPath)
+	}
+
+	if registered != nil {
+		return nil
+	}
+
+	return addWorkspace(hc, *name, wsPath, *configFile)
+}
+
+type workspaceExport struct {
+	Workspaces []HomeConfigItem `yaml:"workspaces"`
+}
+
+func CmdWorkspaceExport(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "workspace export", []string{
+		"Print list of registered workspaces in format suitable for 'workspace import'.",
+		"Paths inside home directory are printed relative to it.",
+	}) {
+		return nil
+	}
+	hc, err := checkAndLoadHC(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	homeDir := path.Dir(hc.Path)
+	export := workspaceExport{Workspaces: make([]HomeConfigItem, 0, len(hc.Workspaces))}
+	for _, workspace := range hc.Workspaces {
+		export.Workspaces = append(export.Workspaces, HomeConfigItem{
+			Name:   workspace.Name,
+			Path:   shrinkHomePath(homeDir, workspace.Path),
+			Config: shrinkHomePath(homeDir, workspace.Config),
+		})
+	}
+
+	data, err := yaml.Marshal(export)
+	if err != nil {
+		return err
+	}
+	_, _ = Pc.Printf("%s", data)
+
+	return nil
+}
+
+func CmdWorkspaceImport(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "workspace import [OPTIONS] FILE", []string{
+		"Add workspaces from FILE created with 'workspace export'.",
+		"Workspaces with already registered names are skipped.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--replace", CHighlight), "replace path and config of already registered workspaces with the same name"),
+	}) {
+		return nil
+	}
+	fs := flag.NewFlagSet("workspace import", flag.ContinueOnError)
+	replace := fs.Bool("replace", false, "replace path of existing workspaces")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("command requires exactly 1 argument")
+	}
+
+	hc, err := checkAndLoadHC(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := Pc.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	export := workspaceExport{}
+	err = yaml.Unmarshal(data, &export)
+	if err != nil {
+		return err
+	}
+
+	homeDir := path.Dir(hc.Path)
+	for _, imported := range export.Workspaces {
+		wsPath := expandHomePath(homeDir, imported.Path)
+		configFile := expandHomePath(homeDir, imported.Config)
+		index := -1
+		for i, workspace := range hc.Workspaces {
+			if workspace.Name == imported.Name {
+				index = i
+			}
+		}
+
+		switch {
+		case index == -1:
+			hc.Workspaces = append(hc.Workspaces, HomeConfigItem{Name: imported.Name, Path: wsPath, Config: configFile})
+			Info("workspace '%s' is added\n", imported.Name)
+		case hc.Workspaces[index].Path == wsPath && hc.Workspaces[index].Config == configFile:
+			continue
+		case *replace:
+			hc.Workspaces[index].Path = wsPath
+			hc.Workspaces[index].Config = configFile
+			Info("workspace '%s' is replaced\n", imported.Name)
+		default:
+			Info("workspace '%s' already exists with path %s, skipped\n", imported.Name, hc.Workspaces[index].Path)
+		}
+	}
+
+	if hc.CurrentWorkspace == "" && len(hc.Workspaces) > 0 {
+		hc.CurrentWorkspace = hc.Workspaces[0].Name
+		Info("active workspace changed to '%s'\n", hc.CurrentWorkspace)
+	}
+
+	return SaveHomeConfig(hc)
+}
+
+func CmdWorkspaceHelp() error {
+	NeedHelp([]string{"--help"}, "workspace COMMAND", []string{
+		"Available commands:",
+		fmt.Sprintf("  %-18s - %s", Color("ls, list", CHighlight), "list available workspaces"),
+		fmt.Sprintf("  %-18s - %s", Color("show", CHighlight), "how current workspace name"),
+		fmt.Sprintf("  %-18s - %s", Color("add", CHighlight), "add new workspace"),
+		fmt.Sprintf("  %-18s - %s", Color("init", CHighlight), "create config for new workspace and add it"),
+		fmt.Sprintf("  %-18s - %s", Color("select", CHighlight), "select workspace as current"),
+		fmt.Sprintf("  %-18s - %s", Color("set-path", CHighlight), "change path of workspace"),
+		fmt.Sprintf("  %-18s - %s", Color("push", CHighlight), "add services of another workspace to current one"),
+		fmt.Sprintf("  %-18s - %s", Color("pop", CHighlight), "remove pushed workspace"),
+		fmt.Sprintf("  %-18s - %s", Color("export", CHighlight), "print list of workspaces for import on another machine"),
+		fmt.Sprintf("  %-18s - %s", Color("import", CHighlight), "add workspaces from exported file"),
+		fmt.Sprintf("  %-18s - %s", Color("doctor", CHighlight), "check that services and modules of current workspace can be run"),
+	})
+	return nil
+}
+
+func CmdConfigMigrate(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "config migrate", []string{
+		"Convert config of current workspace to actual format and raise its elc_min_version.",
+		"Original config is saved next to it with '.bak' suffix. Comments are not preserved.",
+	}) {
+		return nil
+	}
+	hc, err := checkAndLoadHC(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	wsPath, err := hc.GetCurrentWsPath()
+	if err != nil {
+		return err
+	}
+
+	cfg := NewConfig(wsPath, "")
+	cfg.ConfigFile = hc.getCurrentWsConfig()
+	configPath, found := cfg.findConfigFile()
+	if !found {
+		return cfg.configNotFoundError()
+	}
+	applied, err := migrateConfigFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		Info("config is up to date\n")
+		return nil
+	}
+
+	for _, description := range applied {
+		Info("- %s\n", description)
+	}
+	Info("config %s is migrated, backup is saved to %s.bak\n", configPath, configPath)
+
+	return nil
+}
+
+func CmdConfigValidate(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "config validate", []string{
+		"Check config of current workspace, eg. that every module is hosted in existing service.",
+		"All found problems are printed at once.",
+	}) {
+		return nil
+	}
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	problems := cfg.Validate()
+	if len(problems) > 0 {
+		return errors.New(fmt.Sprintf("config of workspace is invalid:\n  %s", strings.Join(problems, "\n  ")))
+	}
+
+	Info("config is valid\n")
+	return nil
+}
+
+func CmdConfigEdit(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "config edit", []string{
+		"Open config of current workspace in $EDITOR (vi by default) and validate it after editor is closed.",
+	}) {
+		return nil
+	}
+	hc, err := checkAndLoadHC(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	wsPath, err := hc.GetCurrentWsPath()
+	if err != nil {
+		return err
+	}
+
+	cfg := NewConfig(wsPath, "")
+	cfg.ConfigFile = hc.getCurrentWsConfig()
+	configPath, found := cfg.findConfigFile()
+	if !found {
+		return cfg.configNotFoundError()
+	}
+
+	editor, found := Pc.LookupEnv("EDITOR")
+	if !found || strings.TrimSpace(editor) == "" {
+		editor = "vi"
+	}
+	_, err = Pc.ExecInteractive(append(strings.Fields(editor), configPath), nil)
+	if err != nil {
+		return err
+	}
+
+	return CmdConfigValidate(homeConfigPath, []string{})
+}
+
+func CmdConfigGet(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "config get KEY", []string{
+		"Print value of option of home config, eg. update_command or current_workspace.",
+	}) {
+		return nil
+	}
+	if len(args) != 1 {
+		return errors.New("command requires exactly 1 argument")
+	}
+
+	hc, err := checkAndLoadHC(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	value, err := hc.GetOption(args[0])
+	if err != nil {
+		return err
+	}
+	_, _ = Pc.Println(value)
+
+	return nil
+}
+
+func CmdConfigSet(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "config set KEY VALUE", []string{
+		"Change value of option of home config, eg. update_command or current_workspace.",
+		"Empty value resets option to default.",
+	}) {
+		return nil
+	}
+	if len(args) != 2 {
+		return errors.New("command requires exactly 2 arguments")
+	}
+
+	hc, err := checkAndLoadHC(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	err = hc.SetOption(args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	return SaveHomeConfig(hc)
+}
+
+func CmdConfigHelp() error {
+	NeedHelp([]string{"--help"}, "config COMMAND", []string{
+		"Available commands:",
+		fmt.Sprintf("  %-18s - %s", Color("edit", CHighlight), "open workspace config in editor and validate it"),
+		fmt.Sprintf("  %-18s - %s", Color("get", CHighlight), "print option of home config"),
+		fmt.Sprintf("  %-18s - %s", Color("set", CHighlight), "change option of home config"),
+		fmt.Sprintf("  %-18s - %s", Color("migrate", CHighlight), "convert workspace config to actual format"),
+		fmt.Sprintf("  %-18s - %s", Color("validate", CHighlight), "check references between sections of workspace config"),
+	})
+	return nil
+}
+
+func CmdPaths(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "paths", []string{
+		"Print paths used by elc: home config, current workspace and its config, current directory,",
+		"and name of service found with current directory.",
+	}) {
+		return nil
+	}
+	_, _ = Pc.Printf("%-18s %s\n", "home config:", homeConfigPath)
+
+	hc, err := checkAndLoadHC(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	cwd, err := getCwd()
+	if err != nil {
+		return err
+	}
+
+	wsPath, err := hc.GetCurrentWsPath()
+	if err != nil {
+		_, _ = Pc.Printf("%-18s %s\n", "workspace:", err)
+		_, _ = Pc.Printf("%-18s %s\n", "cwd:", cwd)
+		return nil
+	}
+	_, _ = Pc.Printf("%-18s %s (%s)\n", "workspace:", hc.CurrentWorkspace, wsPath)
+
+	cfg := NewConfig(wsPath, cwd)
+	cfg.ConfigFile = hc.getCurrentWsConfig()
+	configPath, found := cfg.findConfigFile()
+	if !found {
+		configPath = "not found"
+	}
+	_, _ = Pc.Printf("%-18s %s\n", "workspace config:", configPath)
+	_, _ = Pc.Printf("%-18s %s\n", "cwd:", cwd)
+
+	svcName := "-"
+	if found && cfg.LoadFromFile() == nil {
+		name, err := cfg.FindServiceByPath()
+		if err == nil {
+			svcName = name
+		}
+	}
+	_, _ = Pc.Printf("%-18s %s\n", "service:", svcName)
+
+	return nil
+}
+
+// FindPlugin searches executable elc-NAME in PATH, like git does for its subcommands.
+func FindPlugin(name string) (string, bool) {
+	if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, "/\\") {
+		return "", false
+	}
+
+	pluginPath, err := Pc.LookPath("elc-" + name)
+	if err != nil {
+		return "", false
+	}
+
+	return pluginPath, true
+}
+
+// CmdPlugin runs external subcommand. Plugin gets context of elc with variables ELC_HOME_CONFIG,
+// ELC_WORKSPACE_NAME, ELC_WORKSPACE_PATH and ELC_SERVICE, the last three are set only if they are found.
+func CmdPlugin(homeConfigPath string, pluginPath string, args []string) (int, error) {
+	ctx := Context{{"ELC_HOME_CONFIG", homeConfigPath}}
+
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err == nil {
+		ctx = ctx.add("ELC_WORKSPACE_NAME", cfg.Name)
+		ctx = ctx.add("ELC_WORKSPACE_PATH", cfg.WorkspacePath)
+		svcName, err := cfg.FindServiceByPath()
+		if err == nil {
+			ctx = ctx.add("ELC_SERVICE", svcName)
+		}
+	}
+
+	return Pc.ExecInteractive(append([]string{pluginPath}, args...), ctx.renderMapToHostEnv())
+}
+
+func CmdVersion() {
+	fmt.Printf("v%s\n", Version)
+}
+
+func CmdServiceStart(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "start [OPTIONS] [NAMES...]", []string{
+		"Start one or more services.",
+		"By default starts service found with current directory, but you can pass one or more service names instead.",
+		"Names with '*' or '?' are patterns, eg. 'api-*' selects all services with prefix api-.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--force", CHighlight), "force start dependencies, even if service already started"),
+		fmt.Sprintf("  %-20s - %s", Color("--mode=MODE", CHighlight), "start only dependencies with specified mode or any of comma separated modes, by default uses ELC_MODE variable, default_mode from config or 'default'"),
+		fmt.Sprintf("  %-20s - %s", Color("--dep-timeout=DUR", CHighlight), "fail if dependencies are not started in DUR (eg. 30s, 2m), by default uses dep_timeout from config"),
+		fmt.Sprintf("  %-20s - %s", Color("--no-port-check", CHighlight), "do not check that published ports are free before start"),
+		fmt.Sprintf("  %-20s - %s", Color("--set KEY=VALUE", CHighlight), "override variable of service, can be used several times"),
+		fmt.Sprintf("  %-20s - %s", Color("--keep-going", CHighlight), "process all services even if some of them fail, errors are reported at the end"),
+		fmt.Sprintf("  %-20s - %s", Color("--rollback-on-failure", CHighlight), "stop services started by this command if start fails or is interrupted"),
+		fmt.Sprintf("  %-20s - %s", Color("--print-cmd", CHighlight), "print commands with their variables instead of running them"),
+		fmt.Sprintf("  %-20s - %s", Color("--show-secrets", CHighlight), "with --print-cmd print values of secret variables instead of ****"),
+	}) {
+		return nil
+	}
+	fs := flag.NewFlagSet("start", flag.ContinueOnError)
+	startParams := &SvcStartParams{}
+	addStartFlags(fs, startParams)
+	keepGoing := fs.Bool("keep-going", false, "do not stop on first error")
+	rollback := fs.Bool("rollback-on-failure", false, "stop started services on failure")
+	overrides := addSetFlag(fs)
+	printCmd := addPrintCmdFlag(fs)
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return err
+	}
+	cfg.Overrides = overrides.ctx
+	printCmd.apply(cfg)
+	err = applyStartDefaults(fs, cfg, startParams)
+	if err != nil {
+		return err
+	}
+
+	svcNames, err := getSvcNamesForGroupCommand(cfg, fs, false)
+	if err != nil {
+		return err
+	}
+
+	report := newBatchReport(svcNames)
+	defer report.print()
+
+	stopWatching := watchInterrupt()
+	defer stopWatching()
+
+	started := make([]string, 0)
+	startParams.started = &started
+	err = runSequential(cfg, svcNames, *keepGoing, func(svc *Service) error {
+		return svc.Start(startParams)
+	}, report)
+	if err == nil {
+		return nil
+	}
+
+	if isInterrupted() {
+		Info("start is interrupted, started services: [%s]\n", strings.Join(started, ", "))
+	}
+	if *rollback {
+		rollbackStart(cfg, started)
+	}
+
+	return err
+}
+
+// rollbackStart stops services and their dependencies in reverse order of their start. Errors are only printed,
+// because error of start is more important for user.
+func rollbackStart(cfg *MainConfig, started []string) {
+	for i := len(started) - 1; i >= 0; i-- {
+		Info("stopping service %s\n", started[i])
+		svc, err := CreateFromSvcName(cfg, started[i])
+		if err == nil {
+			err = svc.Stop(&SvcStopParams{})
+		}
+		if err != nil {
+			Error("failed to stop service %s: %s\n", started[i], err)
+		}
+	}
+}
+
+func CmdServiceStop(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "stop [OPTIONS] [NAMES...]", []string{
+		"Stop one or more services.",
+		"By default stops service found with current directory, but you can pass one or more service names instead.",
+		"Names with '*' or '?' are patterns, eg. 'api-*' selects all services with prefix api-.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--all", CHighlight), "stop all running services"),
+		fmt.Sprintf("  %-20s - %s", Color("--parallel=N", CHighlight), "stop up to N services at once, dependent services are stopped first"),
+		fmt.Sprintf("  %-20s - %s", Color("--keep-going", CHighlight), "process all services even if some of them fail, errors are reported at the end"),
+		fmt.Sprintf("  %-20s - %s", Color("--remove-orphans", CHighlight), "remove containers of services which are not defined in compose file anymore"),
+	}) {
+		return nil
+	}
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("stop", flag.ContinueOnError)
+	params := &SvcStopParams{}
+	fs.BoolVar(&params.RemoveOrphans, "remove-orphans", false, "remove containers of undefined services")
+	all := fs.Bool("all", false, "stop all services")
+	parallel := fs.Int("parallel", 1, "number of services stopped at once")
+	keepGoing := fs.Bool("keep-going", false, "do not stop on first error")
+	err = fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	svcNames, err := getSvcNamesForGroupCommand(cfg, fs, *all)
+	if err != nil {
+		return err
+	}
+
+	if *all {
+		svcNames, err = filterRunningServices(cfg, svcNames)
+		if err != nil {
+			return err
+		}
+	}
+
+	return shutdownServices(cfg, svcNames, *parallel, *keepGoing, func(svc *Service) error {
+		return svc.Stop(params)
+	})
+}
+
+func CmdServiceDestroy(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "destroy [OPTIONS] [NAMES...]", []string{
+		"Stop and remove containers of one or more services.",
+		"By default destroys service found with current directory, but you can pass one or more service names instead.",
+		"Names with '*' or '?' are patterns, eg. 'api-*' selects all services with prefix api-.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--all", CHighlight), "destroy all services"),
+		fmt.Sprintf("  %-20s - %s", Color("--parallel=N", CHighlight), "destroy up to N services at once, dependent services are destroyed first"),
+		fmt.Sprintf("  %-20s - %s", Color("--keep-going", CHighlight), "process all services even if some of them fail, errors are reported at the end"),
+		fmt.Sprintf("  %-20s - %s", Color("--remove-orphans", CHighlight), "remove containers of services which are not defined in compose file anymore"),
+	}) {
+		return nil
+	}
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("destroy", flag.ContinueOnError)
+	params := &SvcStopParams{}
+	fs.BoolVar(&params.RemoveOrphans, "remove-orphans", false, "remove containers of undefined services")
+	all := fs.Bool("all", false, "destroy all services")
+	parallel := fs.Int("parallel", 1, "number of services destroyed at once")
+	keepGoing := fs.Bool("keep-going", false, "do not stop on first error")
+	err = fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	svcNames, err := getSvcNamesForGroupCommand(cfg, fs, *all)
+	if err != nil {
+		return err
+	}
+
+	return shutdownServices(cfg, svcNames, *parallel, *keepGoing, func(svc *Service) error {
+		return svc.Destroy(params)
+	})
+}
+
+func CmdPrune(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "prune [OPTIONS]", []string{
+		"Remove stopped containers and unused networks of services of current workspace.",
+		"Only resources with compose labels of workspace projects are removed, resources of other projects are kept.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--volumes", CHighlight), "remove unused volumes too"),
+		fmt.Sprintf("  %-20s - %s", Color("--images", CHighlight), "remove unused images built for services too"),
+	}) {
+		return nil
+	}
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	volumes := fs.Bool("volumes", false, "remove volumes")
+	images := fs.Bool("images", false, "remove images")
+	err = fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	resources := []string{"container", "network"}
+	if *volumes {
+		resources = append(resources, "volume")
+	}
+	if *images {
+		resources = append(resources, "image")
+	}
+
+	svcNames := make([]string, 0, len(cfg.Services))
+	for name := range cfg.Services {
+		svcNames = append(svcNames, name)
+	}
+	sort.Strings(svcNames)
+
+	for _, svcName := range svcNames {
+		label := "label=com.docker.compose.project=" + cfg.composeProjectName(svcName)
+		for _, resource := range resources {
+			command := []string{resource, "prune", "-f", "--filter", label}
+			if resource == "image" {
+				command = []string{resource, "prune", "-a", "-f", "--filter", label}
+			}
+			_, err = Pc.ExecInteractive(cfg.Runner.EngineCommand(command), nil)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func CmdStatus(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "status [OPTIONS] [NAMES...]", []string{
+		"Print status of services and number of their running containers.",
+		"By default prints all services of workspace, but you can pass one or more service names instead.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--watch", CHighlight), "redraw table periodically until Ctrl+C, available only in terminal"),
+		fmt.Sprintf("  %-20s - %s", Color("--interval=DURATION", CHighlight), "interval of redraw in watch mode, eg. 5s, default is 2s"),
+	}) {
+		return nil
+	}
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	watch := fs.Bool("watch", false, "redraw status periodically")
+	interval := fs.Duration("interval", 2*time.Second, "interval of redraw")
+	err = fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	svcNames := cfg.GetAllSvcNames()
+	sort.Strings(svcNames)
+	if fs.NArg() > 0 {
+		svcNames, err = expandSvcNames(cfg, fs.Args())
+		if err != nil {
+			return err
+		}
+	}
+
+	if !*watch {
+		return printStatuses(cfg, svcNames)
+	}
+	if !Pc.IsTerminal() {
+		return errors.New("option --watch is available only when output is terminal")
+	}
+	if *interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	for {
+		_, _ = Pc.Printf("\033[H\033[2J")
+		_, _ = Pc.Printf("%s, every %s, press Ctrl+C to exit\n\n", time.Now().Format("15:04:05"), *interval)
+		err = printStatuses(cfg, svcNames)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-signals:
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// IsRunningErrorCode is exit code of is-running command when state of service can not be checked,
+// so scripts can tell errors from stopped service.
+const IsRunningErrorCode = 2
+
+func CmdIsRunning(homeConfigPath string, args []string) (int, error) {
+	if NeedHelp(args, "is-running [NAME]", []string{
+		"Check that service is running without any output, eg. if elc is-running api; then ...",
+		"Exit code is 0 if service is running, 1 if it is stopped and 2 if state can not be checked, eg. config is invalid.",
+		"By default checks service found with current directory, but you can pass name of another service instead.",
+	}) {
+		return 0, nil
+	}
+	if len(args) > 1 {
+		return 0, errors.New("command accepts only one argument")
+	}
+
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var svcName string
+	if len(args) > 0 {
+		svcName = args[0]
+	} else {
+		svcName, err = cfg.FindServiceByPath()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	svc, err := CreateFromSvcName(cfg, svcName)
+	if err != nil {
+		return 0, err
+	}
+
+	running, err := svc.isRunningForShutdown()
+	if err != nil {
+		return 0, err
+	}
+	if !running {
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+// printStatuses prints table of services with number of running containers, state of all containers
+// is fetched with one call of docker ps, so the table is cheap enough to redraw in watch mode.
+func printStatuses(cfg *MainConfig, svcNames []string) error {
+	command := cfg.Runner.EngineCommand([]string{"ps", "-a", "--filter", "label=com.docker.compose.project", "--format", "{{.Label \"com.docker.compose.project\"}} {{.State}}"})
+	_, out, err := Pc.ExecToString(command, nil)
+	if err != nil {
+		return err
+	}
+
+	total := make(map[string]int)
+	running := make(map[string]int)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		total[fields[0]]++
+		if fields[1] == "running" {
+			running[fields[0]]++
+		}
+	}
+
+	_, _ = Pc.Printf("%-20s %-10s %s\n", "SERVICE", "STATUS", "CONTAINERS")
+	for _, svcName := range svcNames {
+		project := cfg.findServiceOwner(svcName).composeProjectName(svcName)
+		status := "stopped"
+		switch {
+		case total[project] == 0:
+			status = "absent"
+		case running[project] == total[project]:
+			status = "running"
+		case running[project] > 0:
+			status = "partial"
+		}
+		_, _ = Pc.Printf("%-20s %-10s %d/%d\n", svcName, status, running[project], total[project])
+	}
+
+	return nil
+}
+
+func CmdServiceBuild(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "build [OPTIONS] [NAMES...]", []string{
+		"Build images of one or more services.",
+		"By default builds service found with current directory, but you can pass one or more service names instead.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--all", CHighlight), "build all services"),
+		fmt.Sprintf("  %-20s - %s", Color("--if-changed", CHighlight), "skip services whose compose config and files of build context are not changed since last build"),
+	}) {
+		return nil
+	}
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	all := fs.Bool("all", false, "build all services")
+	ifChanged := fs.Bool("if-changed", false, "build only changed services")
+	err = fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	svcNames, err := getSvcNamesForGroupCommand(cfg, fs, *all)
+	if err != nil {
+		return err
+	}
+	sort.Strings(svcNames)
+
+	state, err := LoadWorkspaceState(cfg.WorkspacePath)
+	if err != nil {
+		return err
+	}
+
+	for _, svcName := range svcNames {
+		svc, err := CreateFromSvcName(cfg, svcName)
+		if err != nil {
+			return err
+		}
+
+		if !*ifChanged {
+			err = svc.Build()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		checksum, err := svc.BuildChecksum()
+		if err != nil {
+			return err
+		}
+		if checksum == "" {
+			Info("service %s has nothing to build\n", svc.Name)
+			continue
+		}
+		if state.BuildChecksums[svc.Name] == checksum {
+			Info("service %s is not changed, build is skipped\n", svc.Name)
+			continue
+		}
+
+		err = svc.Build()
+		if err != nil {
+			return err
+		}
+
+		state.BuildChecksums[svc.Name] = checksum
+		err = SaveWorkspaceState(state)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getSvcNamesForGroupCommand returns all services, services passed as arguments or service found with current directory.
+func getSvcNamesForGroupCommand(cfg *MainConfig, fs *flag.FlagSet, all bool) ([]string, error) {
+	if all {
+		return cfg.GetAllSvcNames(), nil
+	}
+
+	if fs.NArg() > 0 {
+		return expandSvcNames(cfg, fs.Args())
+	}
+
+	svcName, err := cfg.FindServiceByPath()
+	if err != nil {
+		svcName, err = selectService(cfg, err)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return []string{svcName}, nil
+}
+
+// expandSvcNames replaces glob patterns containing '*' or '?' with names of matched services,
+// so 'api-*' selects all services with prefix 'api-'. Pattern without matches is an error.
+func expandSvcNames(cfg *MainConfig, names []string) ([]string, error) {
+	result := make([]string, 0, len(names))
+	var allNames []string
+	for _, name := range names {
+		if !strings.ContainsAny(name, "*?") {
+			if !contains(result, name) {
+				result = append(result, name)
+			}
+			continue
+		}
+
+		if allNames == nil {
+			allNames = cfg.GetAllSvcNames()
+			sort.Strings(allNames)
+		}
+
+		matched := false
+		for _, svcName := range allNames {
+			ok, err := path.Match(name, svcName)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid pattern '%s': %s", name, err))
+			}
+			if !ok {
+				continue
+			}
+			matched = true
+			if !contains(result, svcName) {
+				result = append(result, svcName)
+			}
+		}
+
+		if !matched {
+			return nil, errors.New(fmt.Sprintf("no services match pattern '%s'", name))
+		}
+	}
+
+	return result, nil
+}
+
+// filterRunningServices keeps only services which have running containers. All containers are requested
+// with one call of container engine, it is much faster than asking compose about each service.
+func filterRunningServices(cfg *MainConfig, svcNames []string) ([]string, error) {
+	command := cfg.Runner.EngineCommand([]string{"ps", "--filter", "label=com.docker.compose.project", "--format", "{{.Label \"com.docker.compose.project\"}}"})
+	_, out, err := Pc.ExecToString(command, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	projects := make(map[string]bool)
+	for _, line := range strings.Split(out, "\n") {
+		projects[strings.TrimSpace(line)] = true
+	}
+
+	running := make([]string, 0, len(svcNames))
+	for _, svcName := range svcNames {
+		if projects[cfg.findServiceOwner(svcName).composeProjectName(svcName)] {
+			running = append(running, svcName)
+		}
+	}
+
+	return running, nil
+}
+
+func CmdServiceRestart(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "restart [OPTIONS] [NAMES...]", []string{
+		"Restart one or more services.",
+		"By default restart service found with current directory, but you can pass one or more service names instead.",
+		"Names with '*' or '?' are patterns, eg. 'api-*' selects all services with prefix api-.",
+		"With --changed service without saved checksum is not restarted, its checksum is only saved to compare with next time.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--all", CHighlight), "restart all services"),
+		fmt.Sprintf("  %-20s - %s", Color("--changed", CHighlight), "restart only running services whose compose file or variables were changed since last restart"),
+		fmt.Sprintf("  %-20s - %s", Color("--hard", CHighlight), "destroy service instead of stopping it"),
+		fmt.Sprintf("  %-20s - %s", Color("--rolling", CHighlight), "restart containers of service one by one, waiting until each of them is healthy"),
+		fmt.Sprintf("  %-20s - %s", Color("--force", CHighlight), "force start dependencies, even if service already started"),
+		fmt.Sprintf("  %-20s - %s", Color("--mode=MODE", CHighlight), "start only dependencies with specified mode or any of comma separated modes, by default uses ELC_MODE variable, default_mode from config or 'default'"),
+		fmt.Sprintf("  %-20s - %s", Color("--dep-timeout=DUR", CHighlight), "fail if dependencies are not started in DUR (eg. 30s, 2m), by default uses dep_timeout from config"),
+		fmt.Sprintf("  %-20s - %s", Color("--no-port-check", CHighlight), "do not check that published ports are free before start"),
+	}) {
+		return nil
+	}
+	fs := flag.NewFlagSet("restart", flag.ContinueOnError)
+	restartParams := &SvcRestartParams{}
+	all := fs.Bool("all", false, "restart all services")
+	changed := fs.Bool("changed", false, "restart only changed services")
+	fs.BoolVar(&restartParams.Hard, "hard", false, "destroy container instead of stop it before start")
+	fs.BoolVar(&restartParams.Rolling, "rolling", false, "restart containers one by one")
+	addStartFlags(fs, &restartParams.Start)
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if restartParams.Rolling && restartParams.Hard {
+		return errors.New("options --rolling and --hard can not be used together")
+	}
+	if restartParams.Rolling && (*all || *changed) {
+		return errors.New("option --rolling can not be used with --all or --changed")
+	}
+
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return err
+	}
+	err = applyStartDefaults(fs, cfg, &restartParams.Start)
+	if err != nil {
+		return err
+	}
+
+	if *all {
+		return restartAll(cfg, restartParams)
+	}
+
+	svcNames, err := expandSvcNames(cfg, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	if *changed {
+		return restartChanged(cfg, svcNames, restartParams)
+	}
+
+	if len(svcNames) > 0 {
+		for _, svcName := range svcNames {
+			svc, err := CreateFromSvcName(cfg, svcName)
+			if err != nil {
+				return err
+			}
+
+			err = svc.Restart(restartParams)
+			if err != nil {
 				return err
 			}
+		}
+	} else {
+		svcName, err := cfg.FindServiceByPath()
+		if err != nil {
+			return err
+		}
+
+		svc, err := CreateFromSvcName(cfg, svcName)
+		if err != nil {
+			return err
+		}
+
+		err = svc.Restart(restartParams)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var logsPrefixColors = []string{CCyan, CYellow, CGreen, CMagenta, CBlue, CRed}
+
+func CmdServiceLogs(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "logs [OPTIONS] [NAMES...]", []string{
+		"Print logs of one or more services.",
+		"By default prints logs of service found with current directory, but you can pass one or more service names instead.",
+		"Logs of several services are printed together, every line is prefixed with name of its service.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("-f, --follow", CHighlight), "follow log output"),
+		fmt.Sprintf("  %-20s - %s", Color("--since=TIME", CHighlight), "show logs since timestamp (eg. 2022-01-02T13:23:37Z) or relative time (eg. 10m, 1h)"),
+		fmt.Sprintf("  %-20s - %s", Color("--until=TIME", CHighlight), "show logs before timestamp or relative time"),
+		fmt.Sprintf("  %-20s - %s", Color("--tail=N", CHighlight), "show only N last lines of logs of every service, by default shows all"),
+	}) {
+		return nil
+	}
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	logsParams := &SvcLogsParams{}
+	fs.BoolVar(&logsParams.Follow, "follow", false, "follow log output")
+	fs.BoolVar(&logsParams.Follow, "f", false, "follow log output")
+	fs.StringVar(&logsParams.Since, "since", "", "show logs since timestamp or relative time")
+	fs.StringVar(&logsParams.Until, "until", "", "show logs before timestamp or relative time")
+	fs.StringVar(&logsParams.Tail, "tail", "all", "number of lines to show from the end of logs")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if logsParams.Tail != "all" {
+		_, err = strconv.Atoi(logsParams.Tail)
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid value '%s' of option --tail, expected number or 'all'", logsParams.Tail))
+		}
+	}
+
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	svcNames, err := getSvcNamesForGroupCommand(cfg, fs, false)
+	if err != nil {
+		return err
+	}
+
+	services, err := createServices(cfg, svcNames)
+	if err != nil {
+		return err
+	}
+
+	if len(services) == 1 {
+		return services[0].Logs(logsParams, "")
+	}
+
+	width := 0
+	for _, svc := range services {
+		if len(svc.Name) > width {
+			width = len(svc.Name)
+		}
+	}
+
+	errs := make([]error, len(services))
+	var wg sync.WaitGroup
+	for i, svc := range services {
+		prefix := Color(fmt.Sprintf("%-*s |", width, svc.Name), logsPrefixColors[i%len(logsPrefixColors)]) + " "
+		wg.Add(1)
+		go func(i int, svc *Service) {
+			defer wg.Done()
+			defer HandlePanic()
+			err := svc.Logs(logsParams, prefix)
+			if err != nil {
+				errs[i] = errors.New(fmt.Sprintf("%s: %s", svc.Name, err))
+			}
+		}(i, svc)
+	}
+	wg.Wait()
+
+	return joinErrors(errs)
+}
+
+func CmdServiceRecreate(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "recreate [NAMES...]", []string{
+		"Recreate containers of one or more services, volumes are kept.",
+		"Unlike restart it always applies changes of container configuration, eg. new image.",
+		"By default recreates service found with current directory, but you can pass one or more service names instead.",
+	}) {
+		return nil
+	}
+	fs := flag.NewFlagSet("recreate", flag.ContinueOnError)
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	svcNames, err := getSvcNamesForGroupCommand(cfg, fs, false)
+	if err != nil {
+		return err
+	}
+
+	report := newBatchReport(svcNames)
+	defer report.print()
+
+	return runSequential(cfg, svcNames, false, func(svc *Service) error {
+		return svc.Recreate()
+	}, report)
+}
+
+func restartAll(cfg *MainConfig, params *SvcRestartParams) error {
+	services, err := createServices(cfg, cfg.SortByDependencies(cfg.GetAllSvcNames()))
+	if err != nil {
+		return err
+	}
+
+	for i := len(services) - 1; i >= 0; i-- {
+		err := services[i].Shutdown(params)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, svc := range services {
+		err := svc.Start(&params.Start)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func restartChanged(cfg *MainConfig, svcNames []string, params *SvcRestartParams) error {
+	if len(svcNames) == 0 {
+		svcNames = cfg.GetAllSvcNames()
+	}
+
+	state, err := LoadWorkspaceState(cfg.WorkspacePath)
+	if err != nil {
+		return err
+	}
+
+	services, err := createServices(cfg, cfg.SortByDependencies(svcNames))
+	if err != nil {
+		return err
+	}
+
+	for _, svc := range services {
+		checksum, err := svc.Checksum()
+		if err != nil {
+			return err
+		}
 
-			err = svc.Destroy()
+		previous, found := state.Checksums[svc.Name]
+		if previous == checksum {
+			continue
+		}
+		// without previous checksum it is unknown what was changed, so checksum is only recorded
+		// and service is restarted on next change
+		if !found {
+			Info("checksum of service %s is recorded, it will be restarted after next change\n", svc.Name)
+			state.Checksums[svc.Name] = checksum
+			err = SaveWorkspaceState(state)
 			if err != nil {
 				return err
 			}
+			continue
+		}
+
+		running, err := svc.IsRunning()
+		if err != nil {
+			return err
+		}
+		if !running {
+			continue
+		}
+
+		err = svc.Restart(params)
+		if err != nil {
+			return err
 		}
+
+		state.Checksums[svc.Name] = checksum
+		err = SaveWorkspaceState(state)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func CmdServiceVars(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "vars [OPTIONS] [NAME]", []string{
+		"Print all variables computed for service.",
+		"By default uses service found with current directory, but you can pass name of another service instead.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--all", CHighlight), "print variables of all services grouped by service"),
+		fmt.Sprintf("  %-20s - %s", Color("--format=FORMAT", CHighlight), "output format: plain (default), table or json"),
+		fmt.Sprintf("  %-20s - %s", Color("--show-secrets", CHighlight), "print values of secret variables instead of ****"),
+		fmt.Sprintf("  %-20s - %s", Color("--set KEY=VALUE", CHighlight), "override variable of service, can be used several times"),
+		"",
+		"Available commands:",
+		fmt.Sprintf("  %-20s - %s", Color("diff NAME1 NAME2", CHighlight), "print variables which differ between two services"),
+	}) {
+		return nil
+	}
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("vars", flag.ContinueOnError)
+	varsParams := &SvcVarsParams{}
+	all := fs.Bool("all", false, "print variables of all services")
+	addFormatFlag(fs, &varsParams.Format, FormatPlain)
+	fs.BoolVar(&varsParams.ShowSecrets, "show-secrets", false, "print values of secret variables")
+	overrides := addSetFlag(fs)
+	err = fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	cfg.Overrides = overrides.ctx
+
+	if *all {
+		return dumpAllVars(cfg, varsParams)
+	}
+
+	var svcName string
+
+	if fs.NArg() > 0 {
+		svcName = fs.Arg(0)
 	} else {
-		svcName, err := cfg.FindServiceByPath()
+		svcName, err = cfg.FindServiceByPath()
 		if err != nil {
 			return err
 		}
+	}
 
-		svc, err := CreateFromSvcName(cfg, svcName)
+	svc, err := CreateFromSvcName(cfg, svcName)
+	if err != nil {
+		return err
+	}
+
+	err = svc.DumpVars(varsParams)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func CmdServiceShow(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "service show [OPTIONS] [NAME]", []string{
+		"Print path, compose file, dependencies and modules of service.",
+		"By default uses service found with current directory, but you can pass name of another service instead.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--format=FORMAT", CHighlight), "output format: plain (default) or json"),
+	}) {
+		return nil
+	}
+	fs := flag.NewFlagSet("service show", flag.ContinueOnError)
+	var format string
+	addFormatFlag(fs, &format, FormatPlain)
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	svcName := fs.Arg(0)
+	if svcName == "" {
+		svcName, err = cfg.FindServiceByPath()
 		if err != nil {
 			return err
 		}
+	}
+
+	svc, err := CreateFromSvcName(cfg, svcName)
+	if err != nil {
+		return err
+	}
+
+	info, err := svc.Info()
+	if err != nil {
+		return err
+	}
 
-		err = svc.Destroy()
+	switch format {
+	case FormatPlain:
+		info.Print()
+	case FormatJson:
+		data, err := json.MarshalIndent(info, "", "  ")
 		if err != nil {
 			return err
 		}
+		_, _ = Pc.Println(string(data))
+	default:
+		return errors.New(fmt.Sprintf("unknown format %s, use one of: json, plain", format))
 	}
 
 	return nil
 }
 
-func CmdServiceRestart(homeConfigPath string, args []string) error {
-	if NeedHelp(args, "restart [OPTIONS] [NAMES...]", []string{
-		"Restart one or more services.",
-		"By default restart service found with current directory, but you can pass one or more service names instead.",
+func CmdServiceRename(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "service rename OLD NEW", []string{
+		"Rename service in workspace config and update references to it in dependencies, modules and aliases.",
+		"Comments of config are not preserved. Stop service before rename, because its containers are not renamed.",
+	}) {
+		return nil
+	}
+	if len(args) != 2 {
+		return errors.New("command requires exactly 2 arguments")
+	}
+
+	hc, err := checkAndLoadHC(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	wsPath, err := hc.GetCurrentWsPath()
+	if err != nil {
+		return err
+	}
+
+	configPath, cfg, err := loadEditableConfig(wsPath, hc.getCurrentWsConfig())
+	if err != nil {
+		return err
+	}
+
+	cfg, err = renameService(cfg, args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	err = saveEditableConfig(configPath, cfg)
+	if err != nil {
+		return err
+	}
+
+	Info("service %s renamed to %s\n", args[0], args[1])
+	return nil
+}
+
+func CmdModuleAdd(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "module add NAME [OPTIONS]", []string{
+		"Add module hosted in service to workspace config. Comments of config are not preserved.",
 		"",
 		"Available options:",
-		fmt.Sprintf("  %-20s - %s", Color("--hard", CYellow), "destroy service instead of stopping it"),
+		fmt.Sprintf("  %-20s - %s", Color("--hosted-in=SVC", CHighlight), "name of service which container is used for module, required"),
+		fmt.Sprintf("  %-20s - %s", Color("--exec-path=PATH", CHighlight), "working directory of module inside container"),
+		fmt.Sprintf("  %-20s - %s", Color("--path=PATH", CHighlight), "directory of module on host, eg. ${WORKSPACE_PATH}/apps/svc/packages/mdl"),
 	}) {
 		return nil
 	}
-	fs := flag.NewFlagSet("restart", flag.ContinueOnError)
-	restartParams := &SvcRestartParams{}
-	fs.BoolVar(&restartParams.Hard, "hard", false, "destroy container instead of stop it before start")
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return errors.New("name of module is required")
+	}
+	name := args[0]
+
+	fs := flag.NewFlagSet("module add", flag.ContinueOnError)
+	mdl := ModuleConfig{}
+	fs.StringVar(&mdl.HostedIn, "hosted-in", "", "name of service")
+	fs.StringVar(&mdl.ExecPath, "exec-path", "", "working directory inside container")
+	fs.StringVar(&mdl.Path, "path", "", "directory of module on host")
+	err := fs.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+	if mdl.HostedIn == "" {
+		return errors.New("option --hosted-in is required")
+	}
+
+	hc, err := checkAndLoadHC(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	wsPath, err := hc.GetCurrentWsPath()
+	if err != nil {
+		return err
+	}
+
+	configPath, cfg, err := loadEditableConfig(wsPath, hc.getCurrentWsConfig())
+	if err != nil {
+		return err
+	}
+
+	cfg, err = addModule(cfg, name, mdl)
+	if err != nil {
+		return err
+	}
+
+	err = saveEditableConfig(configPath, cfg)
+	if err != nil {
+		return err
+	}
+
+	Info("module %s added to service %s\n", name, mdl.HostedIn)
+	return nil
+}
+
+func CmdModuleHelp() error {
+	NeedHelp([]string{"--help"}, "module COMMAND", []string{
+		"Available commands:",
+		fmt.Sprintf("  %-18s - %s", Color("add", CHighlight), "add module to workspace config"),
+		fmt.Sprintf("  %-18s - %s", Color("exec", CHighlight), "execute command in directory of module"),
+	})
+	return nil
+}
+
+func CmdServiceTagsSet(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "service tags-set SERVICE DEPENDENCY MODES...", []string{
+		"Change modes of dependency of service in workspace config.",
+		"Mode with '+' prefix or without prefix is added, mode with '-' prefix is removed, eg. +hook -default.",
+		"Dependency is added to service if it is absent. Comments of config are not preserved.",
+	}) {
+		return nil
+	}
+	if len(args) < 3 {
+		return errors.New("command requires service, dependency and at least one mode")
+	}
+
+	add := make([]string, 0)
+	remove := make([]string, 0)
+	for _, arg := range args[2:] {
+		if strings.HasPrefix(arg, "-") {
+			remove = append(remove, strings.TrimPrefix(arg, "-"))
+		} else {
+			add = append(add, strings.TrimPrefix(arg, "+"))
+		}
+	}
+
+	hc, err := checkAndLoadHC(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	wsPath, err := hc.GetCurrentWsPath()
+	if err != nil {
+		return err
+	}
+
+	configPath, cfg, err := loadEditableConfig(wsPath, hc.getCurrentWsConfig())
+	if err != nil {
+		return err
+	}
+
+	cfg, modes, err := setDependencyModes(cfg, args[0], args[1], add, remove)
+	if err != nil {
+		return err
+	}
+
+	err = saveEditableConfig(configPath, cfg)
+	if err != nil {
+		return err
+	}
+
+	Info("dependency %s of service %s has modes: [%s]\n", args[1], args[0], strings.Join(modes, ", "))
+	return nil
+}
+
+func CmdServiceDeps(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "service deps [OPTIONS] [NAME]", []string{
+		"Print tree of dependencies of service and show which of them are started in mode.",
+		"Dependencies marked with '+' are started, marked with '-' are filtered out by mode.",
+		"By default uses service found with current directory, but you can pass name of another service instead.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--mode=MODE", CHighlight), "mode or comma separated modes, by default uses ELC_MODE variable, default_mode from config or 'default'"),
+	}) {
+		return nil
+	}
+	fs := flag.NewFlagSet("service deps", flag.ContinueOnError)
+	startParams := &SvcStartParams{}
+	fs.StringVar(&startParams.Mode, "mode", "default", "tag for dependencies selecting")
 	err := fs.Parse(args)
 	if err != nil {
 		return err
 	}
 
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return err
+	}
+	err = applyStartDefaults(fs, cfg, startParams)
+	if err != nil {
+		return err
+	}
+
+	svcName := fs.Arg(0)
+	if svcName == "" {
+		svcName, err = cfg.FindServiceByPath()
+		if err != nil {
+			return err
+		}
+	}
+	_, svcName, err = cfg.findServiceOwner(svcName).FindServiceByName(svcName)
+	if err != nil {
+		return err
+	}
+
+	_, _ = Pc.Printf("%-6s %s\n", "mode:", startParams.Mode)
+	_, _ = Pc.Println(svcName)
+	printDeps(cfg, svcName, startParams.Mode, "  ", []string{svcName})
+
+	return nil
+}
+
+// printDeps prints dependencies of service with their modes, only dependencies started in mode are expanded.
+func printDeps(cfg *MainConfig, svcName string, mode string, indent string, visited []string) []string {
+	svcCfg, _, err := cfg.findServiceOwner(svcName).FindServiceByName(svcName)
+	if err != nil {
+		return visited
+	}
+
+	active := svcCfg.GetDeps(mode)
+	depNames := make([]string, 0, len(svcCfg.Dependencies))
+	for depName := range svcCfg.Dependencies {
+		depNames = append(depNames, depName)
+	}
+	sort.Strings(depNames)
+
+	for _, depName := range depNames {
+		modes := strings.Join(svcCfg.Dependencies[depName], ", ")
+		if !contains(active, depName) {
+			_, _ = Pc.Printf("%s%s %s [%s]\n", indent, Color("-", CError), depName, modes)
+			continue
+		}
+		if contains(visited, depName) {
+			_, _ = Pc.Printf("%s%s %s [%s] (see above)\n", indent, Color("+", CSuccess), depName, modes)
+			continue
+		}
+		_, _ = Pc.Printf("%s%s %s [%s]\n", indent, Color("+", CSuccess), depName, modes)
+		visited = printDeps(cfg, depName, mode, indent+"  ", append(visited, depName))
+	}
+
+	return visited
+}
+
+func CmdServiceProject(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "service project [NAME]", []string{
+		"Print name of compose project used for service, eg. docker ps --filter label=com.docker.compose.project=$(elc service project NAME).",
+		"By default uses service found with current directory, but you can pass name of another service instead.",
+	}) {
+		return nil
+	}
+	if len(args) > 1 {
+		return errors.New("command accepts only one argument")
+	}
+
 	cfg, err := getWorkspaceConfig(homeConfigPath)
 	if err != nil {
 		return err
 	}
 
-	svcNames := fs.Args()
-	if len(svcNames) > 0 {
-		for _, svcName := range svcNames {
-			svc, err := CreateFromSvcName(cfg, svcName)
-			if err != nil {
-				return err
-			}
-
-			err = svc.Restart(restartParams)
-			if err != nil {
-				return err
-			}
-		}
+	var svcName string
+	if len(args) > 0 {
+		svcName = args[0]
 	} else {
-		svcName, err := cfg.FindServiceByPath()
+		svcName, err = cfg.FindServiceByPath()
 		if err != nil {
 			return err
 		}
+	}
 
-		svc, err := CreateFromSvcName(cfg, svcName)
-		if err != nil {
-			return err
-		}
+	svc, err := CreateFromSvcName(cfg, svcName)
+	if err != nil {
+		return err
+	}
 
-		err = svc.Restart(restartParams)
-		if err != nil {
-			return err
-		}
+	ctx, err := svc.GetEnv()
+	if err != nil {
+		return err
 	}
 
+	projectName, _ := ctx.find("COMPOSE_PROJECT_NAME")
+	_, _ = Pc.Println(projectName)
+
 	return nil
 }
 
-func CmdServiceVars(homeConfigPath string, args []string) error {
-	if NeedHelp(args, "vars [NAME]", []string{
-		"Print all variables computed for service.",
+func CmdServicePath(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "service path [NAME]", []string{
+		"Print absolute path to directory of service, eg. cd $(elc service path NAME).",
 		"By default uses service found with current directory, but you can pass name of another service instead.",
 	}) {
 		return nil
 	}
+	if len(args) > 1 {
+		return errors.New("command accepts only one argument")
+	}
+
 	cfg, err := getWorkspaceConfig(homeConfigPath)
 	if err != nil {
 		return err
 	}
 
 	var svcName string
-
 	if len(args) > 0 {
 		svcName = args[0]
 	} else {
@@ -448,27 +2294,94 @@ func CmdServiceVars(homeConfigPath string, args []string) error {
 		return err
 	}
 
-	err = svc.DumpVars()
+	ctx, err := svc.GetEnv()
 	if err != nil {
 		return err
 	}
 
+	svcPath, _ := ctx.find("SVC_PATH")
+	if !path.IsAbs(svcPath) {
+		svcPath = path.Join(cfg.WorkspacePath, svcPath)
+	}
+	_, _ = Pc.Println(svcPath)
+
+	return nil
+}
+
+func CmdServiceHelp() error {
+	NeedHelp([]string{"--help"}, "service COMMAND", []string{
+		"Available commands:",
+		fmt.Sprintf("  %-18s - %s", Color("show", CHighlight), "print information about service"),
+		fmt.Sprintf("  %-18s - %s", Color("path", CHighlight), "print directory of service"),
+		fmt.Sprintf("  %-18s - %s", Color("project", CHighlight), "print name of compose project of service"),
+		fmt.Sprintf("  %-18s - %s", Color("deps", CHighlight), "print dependencies of service started in mode"),
+		fmt.Sprintf("  %-18s - %s", Color("rename", CHighlight), "rename service in workspace config"),
+		fmt.Sprintf("  %-18s - %s", Color("tags-set", CHighlight), "add or remove modes of dependency of service"),
+	})
 	return nil
 }
 
+func CmdServiceVarsDiff(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "vars diff [OPTIONS] NAME1 NAME2", []string{
+		"Print variables which differ between two services.",
+		"Lines prefixed with '-' belong to NAME1, lines prefixed with '+' belong to NAME2.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--show-secrets", CHighlight), "print values of secret variables instead of ****"),
+	}) {
+		return nil
+	}
+	fs := flag.NewFlagSet("vars diff", flag.ContinueOnError)
+	varsParams := &SvcVarsParams{}
+	fs.BoolVar(&varsParams.ShowSecrets, "show-secrets", false, "print values of secret variables")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("command requires exactly 2 arguments")
+	}
+
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	svc, err := CreateFromSvcName(cfg, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	otherSvc, err := CreateFromSvcName(cfg, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	return svc.DiffVars(otherSvc, varsParams)
+}
+
 func CmdServiceCompose(homeConfigPath string, args []string) (int, error) {
 	if NeedHelp(args, "compose [OPTIONS] COMMAND [ARGS]", []string{
 		"Run docker-compose command.",
 		"By default uses service found with current directory.",
 		"",
 		"Available options:",
-		fmt.Sprintf("   %-20s - %s", Color("--svc=SVC", CYellow), "name of another service instead of current"),
+		fmt.Sprintf("   %-20s - %s", Color("--svc=SVC", CHighlight), "name of another service instead of current, or comma separated names of several services"),
+		fmt.Sprintf("   %-20s - %s", Color("--set KEY=VALUE", CHighlight), "override variable of service, can be used several times"),
+		fmt.Sprintf("   %-20s - %s", Color("--print-cmd", CHighlight), "print commands with their variables instead of running them"),
+		fmt.Sprintf("   %-20s - %s", Color("--show-secrets", CHighlight), "with --print-cmd print values of secret variables instead of ****"),
+		"",
+		"With several services command is run for each of them in turn, exit code is the first non-zero code.",
+		"If remember_last_service is enabled in home config, service passed with --svc is used",
+		"when current directory does not belong to any service.",
 	}) {
 		return 0, nil
 	}
 	fs := flag.NewFlagSet("compose", flag.ContinueOnError)
 	composeParams := &SvcComposeParams{}
 	addComposeFlags(fs, composeParams)
+	overrides := addSetFlag(fs)
+	printCmd := addPrintCmdFlag(fs)
 	err := fs.Parse(args)
 	if err != nil {
 		return 0, err
@@ -480,9 +2393,20 @@ func CmdServiceCompose(homeConfigPath string, args []string) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	cfg.Overrides = overrides.ctx
+	printCmd.apply(cfg)
+
+	if strings.Contains(composeParams.SvcName, ",") {
+		return composeInServices(cfg, strings.Split(composeParams.SvcName, ","), composeParams)
+	}
 
 	if composeParams.SvcName == "" {
-		composeParams.SvcName, err = cfg.FindServiceByPath()
+		composeParams.SvcName, err = findServiceByPathOrLast(cfg)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		err = rememberLastService(cfg, composeParams.SvcName)
 		if err != nil {
 			return 0, err
 		}
@@ -501,16 +2425,54 @@ func CmdServiceCompose(homeConfigPath string, args []string) (int, error) {
 	return returnCode, nil
 }
 
+// composeInServices runs compose command for each service, even if it fails for some of them.
+// Returned code is the first non-zero code.
+func composeInServices(cfg *MainConfig, svcNames []string, params *SvcComposeParams) (int, error) {
+	returnCode := 0
+	for _, svcName := range svcNames {
+		if svcName == "" {
+			continue
+		}
+
+		svc, err := CreateFromSvcName(cfg, svcName)
+		if err != nil {
+			return 0, err
+		}
+
+		code, err := svc.Compose(params)
+		if err != nil {
+			return 0, err
+		}
+		if returnCode == 0 {
+			returnCode = code
+		}
+	}
+
+	return returnCode, nil
+}
+
 func CmdServiceExec(homeConfigPath string, args []string) (int, error) {
 	if NeedHelp(args, "[OPTIONS] COMMAND [ARGS]", []string{
 		"Execute command in container. For module uses container of linked service.",
 		"By default uses service/module found with current directory. Starts service if it is not running.",
+		"If remember_last_service is enabled in home config, service passed with --svc is used",
+		"when current directory does not belong to any service.",
 		"",
 		"Available options:",
-		fmt.Sprintf("  %-20s - %s", Color("--force", CYellow), "force start dependencies, even if service already started"),
-		fmt.Sprintf("  %-20s - %s", Color("--svc=NAME", CYellow), "name of another service or module instead of current"),
-		fmt.Sprintf("  %-20s - %s", Color("--mode=MODE", CYellow), "start only dependencies wit specified tag, by default starts 'default' dependencies"),
-		fmt.Sprintf("  %-20s - %s", Color("--uid=UID", CYellow), "use another uid, by default uses uid of current user"),
+		fmt.Sprintf("  %-20s - %s", Color("--force", CHighlight), "force start dependencies, even if service already started"),
+		fmt.Sprintf("  %-20s - %s", Color("--svc=NAME", CHighlight), "name of another service or module instead of current"),
+		fmt.Sprintf("  %-20s - %s", Color("--mode=MODE", CHighlight), "start dependencies with specified mode even if service is already running, running dependencies are kept"),
+		fmt.Sprintf("  %-20s - %s", Color("--dep-timeout=DUR", CHighlight), "fail if dependencies are not started in DUR (eg. 30s, 2m), by default uses dep_timeout from config"),
+		fmt.Sprintf("  %-20s - %s", Color("--no-port-check", CHighlight), "do not check that published ports are free before start"),
+		fmt.Sprintf("  %-20s - %s", Color("--set KEY=VALUE", CHighlight), "override variable of service, can be used several times"),
+		fmt.Sprintf("  %-20s - %s", Color("--uid=UID", CHighlight), "use another uid, by default uses default_uid of service or uid of current user"),
+		fmt.Sprintf("  %-20s - %s", Color("--user=NAME", CHighlight), "use user with name NAME, can not be used with --uid"),
+		fmt.Sprintf("  %-20s - %s", Color("-d, --detach", CHighlight), "run command in background without tty"),
+		fmt.Sprintf("  %-20s - %s", Color("-T, --no-tty", CHighlight), "do not allocate tty even if output is a terminal"),
+		fmt.Sprintf("  %-20s - %s", Color("--detach-keys=KEYS", CHighlight), "override key sequence for detaching from container, eg. ctrl-x,x; command is run with docker exec"),
+		fmt.Sprintf("  %-20s - %s", Color("--workdir=PATH", CHighlight), "run command in directory PATH of container instead of exec_path of service or module"),
+		fmt.Sprintf("  %-20s - %s", Color("--print-cmd", CHighlight), "print commands with their variables instead of running them"),
+		fmt.Sprintf("  %-20s - %s", Color("--show-secrets", CHighlight), "with --print-cmd print values of secret variables instead of ****"),
 	}) {
 		return 0, nil
 	}
@@ -519,17 +2481,29 @@ func CmdServiceExec(homeConfigPath string, args []string) (int, error) {
 	addComposeFlags(fs, &execParams.SvcComposeParams)
 	addStartFlags(fs, &execParams.SvcStartParams)
 	addExecFlags(fs, execParams)
+	overrides := addSetFlag(fs)
+	printCmd := addPrintCmdFlag(fs)
 	err := fs.Parse(args)
 	if err != nil {
 		return 0, err
 	}
 
+	if isFlagPassed(fs, "user") && isFlagPassed(fs, "uid") {
+		return 0, errors.New("options --user and --uid can not be used together")
+	}
+
 	execParams.Cmd = fs.Args()
 
 	cfg, err := getWorkspaceConfig(homeConfigPath)
 	if err != nil {
 		return 0, err
 	}
+	cfg.Overrides = overrides.ctx
+	printCmd.apply(cfg)
+	err = applyStartDefaults(fs, cfg, &execParams.SvcStartParams)
+	if err != nil {
+		return 0, err
+	}
 
 	var mdl *ModuleConfig
 
@@ -538,30 +2512,59 @@ func CmdServiceExec(homeConfigPath string, args []string) (int, error) {
 		if err == nil {
 			execParams.SvcName = mdl.HostedIn
 		} else {
-			execParams.SvcName, err = cfg.FindServiceByPath()
+			execParams.SvcName, err = findServiceByPathOrLast(cfg)
 			if err != nil {
 				return 0, err
 			}
 		}
 	} else {
-		mdl, err := cfg.FindModuleByName(execParams.SvcName)
+		mdl, err = cfg.FindModuleByName(execParams.SvcName)
 		if err == nil {
 			execParams.SvcName = mdl.HostedIn
 		}
-	}
-
-	if mdl != nil {
-		execParams.WorkingDir, err = cfg.renderPath(mdl.ExecPath)
+		err = rememberLastService(cfg, execParams.SvcName)
 		if err != nil {
 			return 0, err
 		}
 	}
 
+	return execInService(fs, cfg, execParams, mdl)
+}
+
+// execInService runs command in container of service execParams.SvcName. Working directory is passed
+// with --workdir, or exec_path of module, if mdl is passed, otherwise exec_path of service.
+func execInService(fs *flag.FlagSet, cfg *MainConfig, execParams *SvcExecParams, mdl *ModuleConfig) (int, error) {
+	// Explicitly passed mode means that its dependencies are required for command, even if service
+	// was started earlier in another mode. Dependencies which are already running are not restarted.
+	if isFlagPassed(fs, "mode") {
+		execParams.Force = true
+	}
+
 	svc, err := CreateFromSvcName(cfg, execParams.SvcName)
 	if err != nil {
 		return 0, err
 	}
 
+	explicitWorkDir := isFlagPassed(fs, "workdir")
+
+	if mdl != nil && !explicitWorkDir {
+		execParams.WorkingDir, err = svc.moduleWorkingDir(mdl)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if mdl == nil && !explicitWorkDir && svc.SvcCfg.ExecPath != "" {
+		execParams.WorkingDir, err = svc.renderPath(svc.SvcCfg.ExecPath)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if !isFlagPassed(fs, "uid") && execParams.User == "" && svc.SvcCfg.DefaultUID != nil {
+		execParams.UID = *svc.SvcCfg.DefaultUID
+	}
+
 	returnCode, err := svc.Exec(execParams)
 	if err != nil {
 		return 0, err
@@ -570,20 +2573,152 @@ func CmdServiceExec(homeConfigPath string, args []string) (int, error) {
 	return returnCode, nil
 }
 
+func CmdModuleExec(homeConfigPath string, args []string) (int, error) {
+	if NeedHelp(args, "module exec NAME [OPTIONS] COMMAND [ARGS]", []string{
+		"Execute command in container of service which hosts module NAME, in exec_path of module.",
+		"Accepts the same options as exec command, except --svc.",
+	}) {
+		return 0, nil
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return 0, errors.New("name of module is required")
+	}
+	name := args[0]
+
+	fs := flag.NewFlagSet("module exec", flag.ContinueOnError)
+	execParams := &SvcExecParams{}
+	addStartFlags(fs, &execParams.SvcStartParams)
+	addExecFlags(fs, execParams)
+	overrides := addSetFlag(fs)
+	printCmd := addPrintCmdFlag(fs)
+	err := fs.Parse(args[1:])
+	if err != nil {
+		return 0, err
+	}
+
+	if isFlagPassed(fs, "user") && isFlagPassed(fs, "uid") {
+		return 0, errors.New("options --user and --uid can not be used together")
+	}
+
+	execParams.Cmd = fs.Args()
+
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return 0, err
+	}
+	cfg.Overrides = overrides.ctx
+	printCmd.apply(cfg)
+	err = applyStartDefaults(fs, cfg, &execParams.SvcStartParams)
+	if err != nil {
+		return 0, err
+	}
+
+	mdl, err := cfg.FindModuleByName(name)
+	if err != nil {
+		return 0, err
+	}
+	execParams.SvcName = mdl.HostedIn
+
+	return execInService(fs, cfg, execParams, mdl)
+}
+
+func CmdServiceEnter(homeConfigPath string, args []string) (int, error) {
+	if NeedHelp(args, "enter [OPTIONS]", []string{
+		"Open shell in container. Uses bash if it is available, otherwise sh.",
+		"Accepts the same options as exec command.",
+	}) {
+		return 0, nil
+	}
+
+	shellCmd := []string{"sh", "-c", "if command -v bash > /dev/null; then exec bash; else exec sh; fi"}
+	return CmdServiceExec(homeConfigPath, append(args, shellCmd...))
+}
+
+func CmdRunScript(homeConfigPath string, args []string) (int, error) {
+	if NeedHelp(args, "run-script [OPTIONS] [NAME] [ARGS]", []string{
+		"Run script defined in 'scripts' section of workspace config.",
+		"Script is executed with bash and gets variables of service found with current directory.",
+		"Without NAME prints list of available scripts.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--svc=NAME", CHighlight), "use variables of another service instead of current"),
+	}) {
+		return 0, nil
+	}
+	fs := flag.NewFlagSet("run-script", flag.ContinueOnError)
+	svcName := fs.String("svc", "", "name of service")
+	err := fs.Parse(args)
+	if err != nil {
+		return 0, err
+	}
+
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return 0, err
+	}
+
+	if fs.NArg() == 0 {
+		names := make([]string, 0, len(cfg.Scripts))
+		for name := range cfg.Scripts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			_, _ = Pc.Println(name)
+		}
+		return 0, nil
+	}
+
+	script, err := cfg.FindScriptByName(fs.Arg(0))
+	if err != nil {
+		return 0, err
+	}
+
+	var ctx Context
+	if *svcName == "" {
+		*svcName, _ = cfg.FindServiceByPath()
+	}
+
+	if *svcName != "" {
+		svc, err := CreateFromSvcName(cfg, *svcName)
+		if err != nil {
+			return 0, err
+		}
+		ctx, err = svc.GetEnv()
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		ctx, err = cfg.makeGlobalEnv()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	command := append([]string{"bash", "-c", script, fs.Arg(0)}, fs.Args()[1:]...)
+	returnCode, err := Pc.ExecInteractive(command, ctx.renderMapToHostEnv())
+	if err != nil {
+		return 0, err
+	}
+
+	return returnCode, nil
+}
+
 func CmdServiceSetHooks(args []string) error {
-	if NeedHelp(args, "set-hooks HOOKS_PATH", []string{
-		"Install hooks from specified folder to .git/hooks.",
+	if NeedHelp(args, "set-hooks HOOKS_PATH [HOOKS_PATH...]", []string{
+		"Install hooks from specified folders to .git/hooks.",
 		"HOOKS_PATH must contain subdirectories with names as git hooks, eg. 'pre-commit'.",
 		"One subdirectory can contain one or many scripts with .sh extension.",
+		"Scripts of the same hook from several folders are combined, they are run in order of folder paths",
+		"and then of script names.",
 		"Every script wil be wrapped with 'elc --tag=hook' command.",
 	}) {
 		return nil
 	}
-	if len(args) != 1 {
-		return errors.New("command requires exactly 1 argument")
+	if len(args) == 0 {
+		return errors.New("command requires at least 1 argument")
 	}
-	hooksFolder := args[0]
-	err := SetGitHooks(hooksFolder, os.Args[0])
+	err := SetGitHooks(args, os.Args[0])
 	if err != nil {
 		return err
 	}
@@ -591,22 +2726,130 @@ func CmdServiceSetHooks(args []string) error {
 	return nil
 }
 
+func CmdHooksRun(args []string) (int, error) {
+	if NeedHelp(args, "hooks run NAME [ARGS...]", []string{
+		"Run installed git hook NAME as git does it, eg. to test it without commit.",
+		"Hook is run in top level directory of work tree, like git does, so relative paths in arguments are resolved from it.",
+		"Arguments are passed to hook as is, stdin is passed too, eg.",
+		"  elc hooks run commit-msg .git/COMMIT_EDITMSG",
+		"  echo 'refs/heads/master 67890 refs/heads/master 12345' | elc hooks run pre-push origin URL",
+	}) {
+		return 0, nil
+	}
+	if len(args) == 0 {
+		return 0, errors.New("name of hook is required")
+	}
+	name := args[0]
+
+	_, topLevel, err := Pc.ExecToString([]string{"git", "rev-parse", "--show-toplevel"}, nil)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("can not find work tree of git repository: %s", err))
+	}
+	err = Pc.Chdir(strings.TrimSpace(topLevel))
+	if err != nil {
+		return 0, err
+	}
+
+	_, out, err := Pc.ExecToString([]string{"git", "rev-parse", "--git-path", "hooks/" + name}, nil)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("can not find hooks of git repository: %s", err))
+	}
+
+	hookPath := strings.TrimSpace(out)
+	if !Pc.FileExists(hookPath) {
+		return 0, errors.New(fmt.Sprintf("hook %s is not installed, install it with 'elc set-hooks HOOKS_PATH'", name))
+	}
+
+	return Pc.ExecInteractive(append([]string{hookPath}, args[1:]...), nil)
+}
+
+func CmdHooksHelp() error {
+	NeedHelp([]string{"--help"}, "hooks COMMAND", []string{
+		"Available commands:",
+		fmt.Sprintf("  %-18s - %s", Color("run", CHighlight), "run installed git hook"),
+	})
+	return nil
+}
+
+var updateChannels = []string{"stable", "beta"}
+
+var reSudo = regexp.MustCompile(`(^|[\s|;&])sudo\s`)
+
+// sudoDropsUpdateEnv checks that update command runs sudo, which resets environment, without keeping variables of update.
+func sudoDropsUpdateEnv(command string) bool {
+	return reSudo.MatchString(command) && !strings.Contains(command, "--preserve-env") && !strings.Contains(command, "sudo -E")
+}
+
 func CmdUpdate(homeConfigPath string, args []string) error {
-	if NeedHelp(args, "update", []string{
+	if NeedHelp(args, "update [OPTIONS]", []string{
 		"Download new version of ELC, place it to /opt/elc/ and update symlink at /usr/local/bin.",
+		"Downloaded binary is verified with checksum published with release or passed with --sha256.",
+		"Checksum is passed to update_command in ELC_EXPECTED_SHA256 variable, keep it if command uses sudo.",
+		"Channel is passed in ELC_UPDATE_CHANNEL variable and can be used in update_command as ${UPDATE_CHANNEL}.",
+		"Default update_command of previous versions, which drops these variables with sudo, is replaced with the current one.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--sha256=HASH", CHighlight), "expected sha256 checksum of new binary"),
+		fmt.Sprintf("  %-20s - %s", Color("--channel=NAME", CHighlight), "stable or beta, by default uses update_channel from home config or 'stable'"),
 	}) {
 		return nil
 	}
+	fs := flag.NewFlagSet("update", flag.ContinueOnError)
+	checksum := fs.String("sha256", "", "expected sha256 checksum of new binary")
+	channel := fs.String("channel", "", "update channel")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
 
 	hc, err := checkAndLoadHC(homeConfigPath)
 	if err != nil {
 		return err
 	}
 
-	_, err = Pc.ExecInteractive([]string{"bash", "-c", hc.UpdateCommand}, []string{})
+	if *channel == "" {
+		*channel = hc.UpdateChannel
+	}
+	if *channel == "" {
+		*channel = "stable"
+	}
+	if !contains(updateChannels, *channel) {
+		return errors.New(fmt.Sprintf("unknown update channel '%s', use one of: %s", *channel, strings.Join(updateChannels, ", ")))
+	}
+
+	if hc.UpdateCommand == legacyUpdateCommand {
+		hc.UpdateCommand = defaultUpdateCommand
+		err = SaveHomeConfig(hc)
+		if err != nil {
+			return err
+		}
+		Info("update_command in home config is changed to pass checksum and channel through sudo\n")
+	}
+
+	if sudoDropsUpdateEnv(hc.UpdateCommand) {
+		if *checksum != "" {
+			return errors.New("update_command runs sudo without --preserve-env=ELC_EXPECTED_SHA256, checksum would not be checked")
+		}
+		if *channel != "stable" && !strings.Contains(hc.UpdateCommand, "${UPDATE_CHANNEL}") {
+			return errors.New("update_command runs sudo without --preserve-env=ELC_UPDATE_CHANNEL and does not use ${UPDATE_CHANNEL}, channel would be ignored")
+		}
+	}
+
+	// other variables are left for bash, so only the channel is substituted
+	command := strings.ReplaceAll(hc.UpdateCommand, "${UPDATE_CHANNEL}", *channel)
+
+	env := []string{fmt.Sprintf("ELC_UPDATE_CHANNEL=%s", *channel)}
+	if *checksum != "" {
+		env = append(env, fmt.Sprintf("ELC_EXPECTED_SHA256=%s", strings.ToLower(*checksum)))
+	}
+
+	code, err := Pc.ExecInteractive([]string{"bash", "-c", command}, env)
 	if err != nil {
 		return err
 	}
+	if code != 0 {
+		return errors.New(fmt.Sprintf("update command failed with code %d", code))
+	}
 
 	return nil
 }
@@ -1,10 +1,18 @@
 package src
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/golang/mock/gomock"
+	"io/ioutil"
 	"os"
 	"path"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 const fakeHomeConfigPath = "/tmp/home/.elc.yaml"
@@ -48,10 +56,152 @@ func TestWorkspaceList(t *testing.T) {
 
 	expectReadHomeConfig(mockPC)
 
-	mockPC.EXPECT().Printf("%-10s %s\n", "project1", "/tmp/workspaces/project1")
-	mockPC.EXPECT().Printf("%-10s %s\n", "project2", "/tmp/workspaces/project2")
+	gomock.InOrder(
+		mockPC.EXPECT().Println("NAME     PATH"),
+		mockPC.EXPECT().Println("project1 /tmp/workspaces/project1"),
+		mockPC.EXPECT().Println("project2 /tmp/workspaces/project2"),
+	)
 
 	_ = CmdWorkspaceList(fakeHomeConfigPath, []string{})
+
+	// json
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().Println(`[
+  {
+    "name": "project1",
+    "path": "/tmp/workspaces/project1"
+  },
+  {
+    "name": "project2",
+    "path": "/tmp/workspaces/project2"
+  }
+]`)
+
+	_ = CmdWorkspaceList(fakeHomeConfigPath, []string{"--format=json"})
+
+	// plain
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().Println("project1 /tmp/workspaces/project1")
+	mockPC.EXPECT().Println("project2 /tmp/workspaces/project2")
+
+	_ = CmdWorkspaceList(fakeHomeConfigPath, []string{"--format", "plain"})
+
+	// unknown format
+	expectReadHomeConfig(mockPC)
+
+	err := CmdWorkspaceList(fakeHomeConfigPath, []string{"--format=xml"})
+	if err == nil || err.Error() != "unknown format xml, use one of: table, json, plain" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+const homeConfigWithHomeWorkspace = `
+current_workspace: project1
+update_command: update
+workspaces:
+- name: project1
+  path: /tmp/workspaces/project1
+- name: project2
+  path: /tmp/home/projects/project2
+- name: light
+  path: /tmp/home/projects/project2
+  config: light.yaml
+`
+
+func TestWorkspaceExport(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return([]byte(homeConfigWithHomeWorkspace), nil)
+	mockPC.EXPECT().Printf("%s", []byte(`workspaces:
+- name: project1
+  path: /tmp/workspaces/project1
+- name: project2
+  path: ~/projects/project2
+- name: light
+  path: ~/projects/project2
+  config: light.yaml
+`))
+
+	_ = CmdWorkspaceExport(fakeHomeConfigPath, []string{})
+}
+
+const workspacesForImport = `workspaces:
+- name: project1
+  path: /tmp/workspaces/project1
+- name: project2
+  path: ~/projects/project2
+- name: project3
+  path: ~/projects/project3
+`
+
+const homeConfigAfterImport = `current_workspace: project1
+update_command: update
+workspaces:
+- name: project1
+  path: /tmp/workspaces/project1
+- name: project2
+  path: %s
+- name: project3
+  path: /tmp/home/projects/project3
+`
+
+func TestWorkspaceImport(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// conflicts are skipped
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().ReadFile("/tmp/export.yaml").Return([]byte(workspacesForImport), nil)
+	mockPC.EXPECT().Printf("workspace '%s' already exists with path %s, skipped\n", "project2", "/tmp/workspaces/project2")
+	mockPC.EXPECT().Printf("workspace '%s' is added\n", "project3")
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, []byte(fmt.Sprintf(homeConfigAfterImport, "/tmp/workspaces/project2")), os.FileMode(0600))
+
+	_ = CmdWorkspaceImport(fakeHomeConfigPath, []string{"/tmp/export.yaml"})
+
+	// conflicts are replaced
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().ReadFile("/tmp/export.yaml").Return([]byte(workspacesForImport), nil)
+	mockPC.EXPECT().Printf("workspace '%s' is replaced\n", "project2")
+	mockPC.EXPECT().Printf("workspace '%s' is added\n", "project3")
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, []byte(fmt.Sprintf(homeConfigAfterImport, "/tmp/home/projects/project2")), os.FileMode(0600))
+
+	_ = CmdWorkspaceImport(fakeHomeConfigPath, []string{"--replace", "/tmp/export.yaml"})
+
+	// workspace with the same path and another config is a conflict too
+	configForImport := `workspaces:
+- name: project2
+  path: /tmp/workspaces/project2
+  config: light.yaml
+- name: light
+  path: /tmp/workspaces/project2
+  config: light.yaml
+`
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().ReadFile("/tmp/export.yaml").Return([]byte(configForImport), nil)
+	mockPC.EXPECT().Printf("workspace '%s' is replaced\n", "project2")
+	mockPC.EXPECT().Printf("workspace '%s' is added\n", "light")
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, []byte(`current_workspace: project1
+update_command: update
+workspaces:
+- name: project1
+  path: /tmp/workspaces/project1
+- name: project2
+  path: /tmp/workspaces/project2
+  config: light.yaml
+- name: light
+  path: /tmp/workspaces/project2
+  config: light.yaml
+`), os.FileMode(0600))
+
+	_ = CmdWorkspaceImport(fakeHomeConfigPath, []string{"--replace", "/tmp/export.yaml"})
 }
 
 const homeConfigForAdd = `current_workspace: project1
@@ -73,7 +223,7 @@ func TestWorkspaceAdd(t *testing.T) {
 	Pc = mockPC
 
 	expectReadHomeConfig(mockPC)
-	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, []byte(homeConfigForAdd), os.FileMode(0644))
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, []byte(homeConfigForAdd), os.FileMode(0600))
 	mockPC.EXPECT().Printf("workspace '%s' is added\n", "project3")
 
 	_ = CmdWorkspaceAdd(fakeHomeConfigPath, []string{"project3", "/tmp/workspaces/project3"})
@@ -96,7 +246,7 @@ func TestWorkspaceSelect(t *testing.T) {
 	Pc = mockPC
 
 	expectReadHomeConfig(mockPC)
-	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, []byte(homeConfigForSelect), os.FileMode(0644))
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, []byte(homeConfigForSelect), os.FileMode(0600))
 	mockPC.EXPECT().Printf("active workspace changed to '%s'\n", "project2")
 
 	_ = CmdWorkspaceSelect(fakeHomeConfigPath, []string{"project2"})
@@ -110,10 +260,19 @@ services:
 `
 
 func expectReadWorkspaceConfig(mockPC *MockPC, workspacePath string, config string, env string) {
+	expectReadWorkspaceConfigWithMode(mockPC, workspacePath, config, env, "")
+}
+
+// expectReadWorkspaceConfigWithMode is like expectReadWorkspaceConfig, but mode is set by ELC_MODE variable.
+func expectReadWorkspaceConfigWithMode(mockPC *MockPC, workspacePath string, config string, env string, mode string) {
 	configPath := path.Join(workspacePath, "workspace.yaml")
 	envPath := path.Join(workspacePath, "env.yaml")
+	mockPC.EXPECT().FileExists(workspacePath).
+		Return(true)
 	mockPC.EXPECT().Getwd().
 		Return(path.Join(workspacePath, "apps/test"), nil)
+	mockPC.EXPECT().FileExists(configPath).
+		Return(true)
 	mockPC.EXPECT().ReadFile(configPath).
 		Return([]byte(config), nil)
 
@@ -124,6 +283,12 @@ func expectReadWorkspaceConfig(mockPC *MockPC, workspacePath string, config stri
 		mockPC.EXPECT().ReadFile(envPath).
 			Return([]byte(env), nil)
 	}
+	mockPC.EXPECT().FileExists(path.Join(workspacePath, ".env")).
+		Return(false)
+	mockPC.EXPECT().LookupEnv("ELC_COMPOSE_ENGINE").
+		Return("", false)
+	mockPC.EXPECT().LookupEnv("ELC_MODE").
+		Return(mode, mode != "")
 }
 
 func TestServiceStart(t *testing.T) {
@@ -141,6 +306,7 @@ func TestServiceStart(t *testing.T) {
 	mockPC.EXPECT().
 		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
 		Return(0, "", nil)
+	expectPortCheck(mockPC, composeFilePath)
 
 	mockPC.EXPECT().
 		ExecInteractive([]string{"docker", "compose", "-f", composeFilePath, "up", "-d"}, gomock.Any()).
@@ -166,36 +332,63 @@ services:
       dep3: []
 `
 
-func expectStartService(mockPC *MockPC, composeFilePath string) {
+func expectPortCheck(mockPC *MockPC, composeFilePath string) *gomock.Call {
+	return mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "config"}, gomock.Any()).
+		Return(0, "services: {}", nil)
+}
+
+func expectStartService(mockPC *MockPC, composeFilePath string) *gomock.Call {
 	mockPC.EXPECT().
 		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
 		Return(0, "", nil)
+	expectPortCheck(mockPC, composeFilePath)
 
-	mockPC.EXPECT().
+	return mockPC.EXPECT().
 		ExecInteractive([]string{"docker", "compose", "-f", composeFilePath, "up", "-d"}, gomock.Any()).
 		Return(0, nil)
 }
 
-func expectStopService(mockPC *MockPC, composeFilePath string) {
+func expectTerminalTitle(mockPC *MockPC, title string) {
+	mockPC.EXPECT().Printf("\033]0;%s\007", title)
+	mockPC.EXPECT().Printf("\033]0;%s\007", "")
+}
+
+func expectStopService(mockPC *MockPC, composeFilePath string) *gomock.Call {
 	mockPC.EXPECT().
 		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
 		Return(0, "asdasd", nil)
 
-	mockPC.EXPECT().
+	return mockPC.EXPECT().
 		ExecInteractive([]string{"docker", "compose", "-f", composeFilePath, "stop"}, gomock.Any()).
 		Return(0, nil)
 }
 
-func expectDestroyService(mockPC *MockPC, composeFilePath string) {
+func expectDestroyService(mockPC *MockPC, composeFilePath string) *gomock.Call {
 	mockPC.EXPECT().
 		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
 		Return(0, "asdasd", nil)
 
-	mockPC.EXPECT().
+	return mockPC.EXPECT().
 		ExecInteractive([]string{"docker", "compose", "-f", composeFilePath, "down"}, gomock.Any()).
 		Return(0, nil)
 }
 
+func expectBatchReport(mockPC *MockPC, namesAndStatuses ...string) {
+	mockPC.EXPECT().Printf("%-20s %s\n", "SERVICE", "STATUS")
+	for i := 0; i < len(namesAndStatuses); i += 2 {
+		mockPC.EXPECT().Printf("%-20s %s\n", namesAndStatuses[i], namesAndStatuses[i+1])
+	}
+}
+
+// expectStartProgress expects progress of dependencies start printed as plain lines, when stdout is not a terminal.
+func expectStartProgress(mockPC *MockPC, lines ...string) {
+	mockPC.EXPECT().IsTerminal().Return(false)
+	for _, line := range lines {
+		mockPC.EXPECT().Printf("%s\n", line)
+	}
+}
+
 func TestServiceStartWithDeps(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -211,6 +404,7 @@ func TestServiceStartWithDeps(t *testing.T) {
 	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"))
 	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
 
+	expectStartProgress(mockPC, "[1/3] starting service test", "[2/3] starting service dep1", "[3/3] starting service dep2")
 	_ = CmdServiceStart(fakeHomeConfigPath, []string{})
 
 	// hook mode
@@ -220,6 +414,7 @@ func TestServiceStartWithDeps(t *testing.T) {
 	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"))
 	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
 
+	expectStartProgress(mockPC, "[1/2] starting service test", "[2/2] starting service dep2")
 	_ = CmdServiceStart(fakeHomeConfigPath, []string{"--mode=hook"})
 
 	// single mode
@@ -244,6 +439,7 @@ func TestServiceStartWithDeps(t *testing.T) {
 
 	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep3/docker-compose.yml"))
 	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"))
+	expectBatchReport(mockPC, "dep3", "done", "dep1", "done")
 
 	_ = CmdServiceStart(fakeHomeConfigPath, []string{"dep3", "dep1"})
 }
@@ -277,21 +473,28 @@ func TestServiceStop(t *testing.T) {
 
 	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"))
 	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"))
+	expectBatchReport(mockPC, "dep1", "done", "dep2", "done")
 
 	_ = CmdServiceStop(fakeHomeConfigPath, []string{"dep1", "dep2"})
 
-	// all
+	// all running
 	expectReadHomeConfig(mockPC)
 	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
 
+	expectRunningProjects(mockPC, "ensi-dep1\nensi-test\nensi-test\nother-project\n")
 	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"))
-	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"))
-	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/dep3/docker-compose.yml"))
 	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+	expectBatchReport(mockPC, "dep1", "done", "test", "done")
 
 	_ = CmdServiceStop(fakeHomeConfigPath, []string{"--all"})
 }
 
+func expectRunningProjects(mockPC *MockPC, projects string) {
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "ps", "--filter", "label=com.docker.compose.project", "--format", "{{.Label \"com.docker.compose.project\"}}"}, gomock.Any()).
+		Return(0, projects, nil)
+}
+
 func TestServiceDestroy(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -321,6 +524,7 @@ func TestServiceDestroy(t *testing.T) {
 
 	expectDestroyService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"))
 	expectDestroyService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"))
+	expectBatchReport(mockPC, "dep1", "done", "dep2", "done")
 
 	_ = CmdServiceDestroy(fakeHomeConfigPath, []string{"dep1", "dep2"})
 
@@ -332,10 +536,169 @@ func TestServiceDestroy(t *testing.T) {
 	expectDestroyService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"))
 	expectDestroyService(mockPC, path.Join(fakeWorkspacePath, "apps/dep3/docker-compose.yml"))
 	expectDestroyService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+	expectBatchReport(mockPC, "dep1", "done", "dep2", "done", "dep3", "done", "test", "done")
 
 	_ = CmdServiceDestroy(fakeHomeConfigPath, []string{"--all"})
 }
 
+func TestServiceRemoveOrphans(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	composeFilePath := path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")
+	expectOrphans := func() {
+		mockPC.EXPECT().FileExists(composeFilePath).Return(true)
+		mockPC.EXPECT().
+			ExecToString([]string{"docker", "compose", "-f", composeFilePath, "config", "--services"}, gomock.Any()).
+			Return(0, "app\nnginx\n", nil)
+		mockPC.EXPECT().
+			ExecToString([]string{"docker", "ps", "-a", "--filter", "label=com.docker.compose.project=ensi-test", "--format", "{{.ID}} {{.Label \"com.docker.compose.service\"}}"}, gomock.Any()).
+			Return(0, "aaa app\nbbb worker\nccc nginx\nddd redis\n", nil)
+		mockPC.EXPECT().
+			ExecInteractive([]string{"docker", "rm", "-f", "bbb", "ddd"}, gomock.Any()).
+			Return(0, nil)
+	}
+
+	// stop
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	expectStopService(mockPC, composeFilePath)
+	expectOrphans()
+
+	err := CmdServiceStop(fakeHomeConfigPath, []string{"--remove-orphans"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// destroy running service
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "asdasd", nil)
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", composeFilePath, "down", "--remove-orphans"}, gomock.Any()).
+		Return(0, nil)
+
+	err = CmdServiceDestroy(fakeHomeConfigPath, []string{"--remove-orphans"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// destroy stopped service
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "", nil)
+	expectOrphans()
+
+	err = CmdServiceDestroy(fakeHomeConfigPath, []string{"--remove-orphans"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// destroy not cloned service
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(1, "", errors.New("no such file"))
+	mockPC.EXPECT().FileExists(composeFilePath).Return(false).Times(2)
+
+	err = CmdServiceDestroy(fakeHomeConfigPath, []string{"--remove-orphans"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// all services
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "ps", "-a", "--filter", "label=com.docker.compose.project", "--format", "{{.Label \"com.docker.compose.project\"}} {{.State}}"}, gomock.Any()).
+		Return(0, "ensi-dep1 running\nensi-test running\nensi-test exited\nensi-dep2 exited\nother-project running\n", nil)
+	gomock.InOrder(
+		mockPC.EXPECT().Printf("%-20s %-10s %s\n", "SERVICE", "STATUS", "CONTAINERS"),
+		mockPC.EXPECT().Printf("%-20s %-10s %d/%d\n", "dep1", "running", 1, 1),
+		mockPC.EXPECT().Printf("%-20s %-10s %d/%d\n", "dep2", "stopped", 0, 1),
+		mockPC.EXPECT().Printf("%-20s %-10s %d/%d\n", "dep3", "absent", 0, 0),
+		mockPC.EXPECT().Printf("%-20s %-10s %d/%d\n", "test", "partial", 1, 2),
+	)
+
+	err := CmdStatus(fakeHomeConfigPath, []string{})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// watch without terminal
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().IsTerminal().Return(false)
+
+	err = CmdStatus(fakeHomeConfigPath, []string{"--watch", "test"})
+	if err == nil {
+		t.Errorf("watch must fail when output is not terminal")
+	}
+}
+
+func TestIsRunning(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectPs := func(svcName string, out string) {
+		mockPC.EXPECT().
+			ExecToString([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps", svcName, "docker-compose.yml"), "ps", "--status=running", "-q"}, gomock.Any()).
+			Return(0, out, nil)
+	}
+
+	// current is running
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	expectPs("test", "asdasd")
+
+	code, err := CmdIsRunning(fakeHomeConfigPath, []string{})
+	if err != nil || code != 0 {
+		t.Errorf("expected code 0, got %d, %v", code, err)
+	}
+
+	// stopped by name
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	expectPs("dep1", "")
+
+	code, err = CmdIsRunning(fakeHomeConfigPath, []string{"dep1"})
+	if err != nil || code != 1 {
+		t.Errorf("expected code 1, got %d, %v", code, err)
+	}
+
+	// error is not reported as stopped service
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"), "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(1, "", errors.New("docker is not running"))
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml")).Return(true)
+
+	_, err = CmdIsRunning(fakeHomeConfigPath, []string{"dep1"})
+	if err == nil {
+		t.Errorf("expected error")
+	}
+}
+
 func TestServiceRestart(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -348,8 +711,11 @@ func TestServiceRestart(t *testing.T) {
 	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
 
 	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"))
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"))
 	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
 
+	expectStartProgress(mockPC, "[1/3] starting service test", "[2/3] starting service dep1", "[3/3] starting service dep2")
 	_ = CmdServiceRestart(fakeHomeConfigPath, []string{})
 
 	// by name
@@ -366,9 +732,57 @@ func TestServiceRestart(t *testing.T) {
 	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
 
 	expectDestroyService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"))
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"))
 	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
 
+	expectStartProgress(mockPC, "[1/3] starting service test", "[2/3] starting service dep1", "[3/3] starting service dep2")
 	_ = CmdServiceRestart(fakeHomeConfigPath, []string{"--hard"})
+
+	// mode
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"))
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+
+	expectStartProgress(mockPC, "[1/2] starting service test", "[2/2] starting service dep2")
+	_ = CmdServiceRestart(fakeHomeConfigPath, []string{"--mode=hook"})
+
+	// all
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	gomock.InOrder(
+		expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")),
+		expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/dep3/docker-compose.yml")),
+		expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml")),
+		expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml")),
+		expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml")),
+		expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml")),
+		expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep3/docker-compose.yml")),
+		expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")),
+	)
+
+	_ = CmdServiceRestart(fakeHomeConfigPath, []string{"--all"})
+
+	// all hard
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	gomock.InOrder(
+		expectDestroyService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")),
+		expectDestroyService(mockPC, path.Join(fakeWorkspacePath, "apps/dep3/docker-compose.yml")),
+		expectDestroyService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml")),
+		expectDestroyService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml")),
+		expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml")),
+		expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml")),
+		expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep3/docker-compose.yml")),
+		expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")),
+	)
+
+	_ = CmdServiceRestart(fakeHomeConfigPath, []string{"--all", "--hard"})
 }
 
 func TestServiceCompose(t *testing.T) {
@@ -397,6 +811,27 @@ func TestServiceCompose(t *testing.T) {
 		Return(0, nil)
 
 	_, _ = CmdServiceCompose(fakeHomeConfigPath, []string{"--svc=dep1", "some", "command"})
+
+	// several services
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	gomock.InOrder(
+		mockPC.EXPECT().
+			ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"), "pull"}, gomock.Any()).
+			Return(0, nil),
+		mockPC.EXPECT().
+			ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"), "pull"}, gomock.Any()).
+			Return(3, nil),
+		mockPC.EXPECT().
+			ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/dep3/docker-compose.yml"), "pull"}, gomock.Any()).
+			Return(1, nil),
+	)
+
+	code, err := CmdServiceCompose(fakeHomeConfigPath, []string{"--svc=dep1,dep2,dep3", "pull"})
+	if err != nil || code != 3 {
+		t.Errorf("unexpected result: %d, %v", code, err)
+	}
 }
 
 func TestServiceExec(t *testing.T) {
@@ -415,9 +850,13 @@ func TestServiceExec(t *testing.T) {
 	mockPC.EXPECT().
 		IsTerminal().
 		Return(true)
-	mockPC.EXPECT().
-		ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"), "exec", "-u", "1000", "app", "some", "command"}, gomock.Any()).
-		Return(0, nil)
+	gomock.InOrder(
+		mockPC.EXPECT().Printf("\033]0;%s\007", "elc: ensi/test"),
+		mockPC.EXPECT().
+			ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"), "exec", "-u", "1000", "app", "some", "command"}, gomock.Any()).
+			Return(0, nil),
+		mockPC.EXPECT().Printf("\033]0;%s\007", ""),
+	)
 
 	_, _ = CmdServiceExec(fakeHomeConfigPath, []string{"some", "command"})
 
@@ -445,9 +884,13 @@ func TestServiceExec(t *testing.T) {
 	mockPC.EXPECT().
 		IsTerminal().
 		Return(true)
-	mockPC.EXPECT().
-		ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"), "exec", "-u", "0", "app", "some", "command"}, gomock.Any()).
-		Return(0, nil)
+	gomock.InOrder(
+		mockPC.EXPECT().Printf("\033]0;%s\007", "elc: ensi/test"),
+		mockPC.EXPECT().
+			ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"), "exec", "-u", "0", "app", "some", "command"}, gomock.Any()).
+			Return(0, nil),
+		mockPC.EXPECT().Printf("\033]0;%s\007", ""),
+	)
 
 	_, _ = CmdServiceExec(fakeHomeConfigPath, []string{"--uid=0", "some", "command"})
 }
@@ -529,3 +972,3986 @@ func TestServiceVars(t *testing.T) {
 
 	_ = CmdServiceVars(fakeHomeConfigPath, []string{"test1"})
 }
+
+func TestServiceRestartChanged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	statePath := path.Join(fakeWorkspacePath, ".elc-state.yaml")
+	composeFilePath := path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml")
+	var savedState []byte
+
+	// without saved state checksum is only recorded
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().FileExists(statePath).Return(false)
+	mockPC.EXPECT().FileExists(composeFilePath).Return(true)
+	mockPC.EXPECT().ReadFile(composeFilePath).Return([]byte("services: {}"), nil)
+	mockPC.EXPECT().Printf("checksum of service %s is recorded, it will be restarted after next change\n", "dep1")
+	mockPC.EXPECT().WriteFile(statePath, gomock.Any(), os.FileMode(0644)).
+		DoAndReturn(func(filename string, data []byte, perm os.FileMode) error {
+			savedState = data
+			return nil
+		})
+
+	_ = CmdServiceRestart(fakeHomeConfigPath, []string{"--changed", "dep1"})
+
+	// nothing changed
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().FileExists(statePath).Return(true)
+	mockPC.EXPECT().ReadFile(statePath).Return(savedState, nil)
+	mockPC.EXPECT().FileExists(composeFilePath).Return(true)
+	mockPC.EXPECT().ReadFile(composeFilePath).Return([]byte("services: {}"), nil)
+
+	_ = CmdServiceRestart(fakeHomeConfigPath, []string{"--changed", "dep1"})
+
+	// compose file changed
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().FileExists(statePath).Return(true)
+	mockPC.EXPECT().ReadFile(statePath).Return(savedState, nil)
+	mockPC.EXPECT().FileExists(composeFilePath).Return(true)
+	mockPC.EXPECT().ReadFile(composeFilePath).Return([]byte("services: {app: {}}"), nil)
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "asdasd", nil)
+	expectStopService(mockPC, composeFilePath)
+	expectStartService(mockPC, composeFilePath)
+	mockPC.EXPECT().WriteFile(statePath, gomock.Any(), os.FileMode(0644))
+
+	_ = CmdServiceRestart(fakeHomeConfigPath, []string{"--changed", "dep1"})
+}
+
+const workspaceConfigWithVarKeys = `
+name: ensi
+variables:
+  PREFIX: V
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+    variables:
+      V_X: a
+      ${PREFIX}_X: b
+      ${APP_NAME}_PORT: "80"
+      spring.profiles.active: dev
+  broken:
+    path: "${WORKSPACE_PATH}/apps/broken"
+    variables:
+      ${UNDEFINED}: a
+`
+
+func TestServiceVarsTemplatedKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// collision is resolved in favour of the last variable
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithVarKeys, "")
+	gomock.InOrder(
+		mockPC.EXPECT().Println("WORKSPACE_PATH=/tmp/workspaces/project1"),
+		mockPC.EXPECT().Println("WORKSPACE_NAME=ensi"),
+		mockPC.EXPECT().Println("PREFIX=V"),
+		mockPC.EXPECT().Println("APP_NAME=test"),
+		mockPC.EXPECT().Println("COMPOSE_PROJECT_NAME=ensi-test"),
+		mockPC.EXPECT().Println("SVC_PATH=/tmp/workspaces/project1/apps/test"),
+		mockPC.EXPECT().Println("COMPOSE_FILE=/tmp/workspaces/project1/apps/test/docker-compose.yml"),
+		mockPC.EXPECT().Println("V_X=b"),
+		mockPC.EXPECT().Println("test_PORT=80"),
+		mockPC.EXPECT().Println("spring.profiles.active=dev"),
+	)
+
+	err := CmdServiceVars(fakeHomeConfigPath, []string{})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// key rendered to empty name
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithVarKeys, "")
+
+	err = CmdServiceVars(fakeHomeConfigPath, []string{"broken"})
+	if err == nil || !strings.Contains(err.Error(), "invalid name") {
+		t.Errorf("expected error about invalid name of variable, got %v", err)
+	}
+}
+
+func TestServiceVarsDiff(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithVars, "")
+
+	mockPC.EXPECT().Printf("-%s=%s\n", "APP_NAME", "test")
+	mockPC.EXPECT().Printf("+%s=%s\n", "APP_NAME", "test1")
+	mockPC.EXPECT().Printf("-%s=%s\n", "COMPOSE_PROJECT_NAME", "ensi-test")
+	mockPC.EXPECT().Printf("+%s=%s\n", "COMPOSE_PROJECT_NAME", "ensi-test1")
+	mockPC.EXPECT().Printf("-%s=%s\n", "SVC_PATH", "/tmp/workspaces/project1/apps/test")
+	mockPC.EXPECT().Printf("+%s=%s\n", "SVC_PATH", "/tmp/workspaces/project1/apps/test1")
+	mockPC.EXPECT().Printf("-%s=%s\n", "COMPOSE_FILE", "/tmp/workspaces/project1/apps/test/docker-compose.yml")
+	mockPC.EXPECT().Printf("+%s=%s\n", "COMPOSE_FILE", "/tmp/workspaces/project1/templates/tpl1/docker-compose.yml")
+	mockPC.EXPECT().Printf("+%s=%s\n", "TPL_PATH", "/tmp/workspaces/project1/templates/tpl1")
+	mockPC.EXPECT().Printf("+%s=%s\n", "V_IN_TPL", "vintpl")
+
+	_ = CmdServiceVarsDiff(fakeHomeConfigPath, []string{"test", "test1"})
+}
+
+func TestGlobalCwd(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	args, err := ParseGlobalFlags([]string{"--cwd", "../dep1", "--mode=hook", "some", "command"})
+	defer func() { Globals.Cwd = "" }()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 3 || args[0] != "--mode=hook" {
+		t.Fatalf("unexpected args after global flags: %v", args)
+	}
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"))
+
+	_ = CmdServiceStart(fakeHomeConfigPath, []string{})
+}
+
+func TestServiceEnter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	mockPC.EXPECT().Getuid().Return(1000)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfig, "")
+
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+	mockPC.EXPECT().
+		IsTerminal().
+		Return(true)
+	gomock.InOrder(
+		mockPC.EXPECT().Printf("\033]0;%s\007", "elc: ensi/test"),
+		mockPC.EXPECT().
+			ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"), "exec", "-u", "0", "app",
+				"sh", "-c", "if command -v bash > /dev/null; then exec bash; else exec sh; fi"}, gomock.Any()).
+			Return(0, nil),
+		mockPC.EXPECT().Printf("\033]0;%s\007", ""),
+	)
+
+	_, _ = CmdServiceEnter(fakeHomeConfigPath, []string{"--uid=0"})
+}
+
+const workspaceConfigWithAliases = `
+name: ensi
+aliases:
+  t: test
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+  dep1:
+    path: "${WORKSPACE_PATH}/apps/dep1"
+`
+
+const envConfigWithAliases = `
+aliases:
+  d: dep1
+`
+
+func TestServiceAliases(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// alias from workspace config
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithAliases, envConfigWithAliases)
+
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+
+	_ = CmdServiceStart(fakeHomeConfigPath, []string{"t"})
+
+	// alias from env config
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithAliases, envConfigWithAliases)
+
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"), "ps"}, gomock.Any()).
+		Return(0, nil)
+
+	_, _ = CmdServiceCompose(fakeHomeConfigPath, []string{"--svc=d", "ps"})
+}
+
+func TestServiceNameSuggestions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	err := CmdServiceStart(fakeHomeConfigPath, []string{"dep"})
+	if err == nil || err.Error() != "service dep not found, did you mean: dep1, dep2, dep3?" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	err = CmdServiceStart(fakeHomeConfigPath, []string{"unknown"})
+	if err == nil || err.Error() != "service unknown not found" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+const workspaceConfigWithScripts = `
+name: ensi
+scripts:
+  hello: echo "hello from $APP_NAME"
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+  dep1:
+    path: "${WORKSPACE_PATH}/apps/dep1"
+`
+
+func TestRunScript(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// list
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithScripts, "")
+
+	mockPC.EXPECT().Println("hello")
+
+	_, _ = CmdRunScript(fakeHomeConfigPath, []string{})
+
+	// run
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithScripts, "")
+
+	mockPC.EXPECT().Environ().Return([]string{"PATH=/usr/bin"})
+	mockPC.EXPECT().
+		ExecInteractive([]string{"bash", "-c", `echo "hello from $APP_NAME"`, "hello", "arg"}, gomock.Any()).
+		DoAndReturn(func(command []string, env []string) (int, error) {
+			if !contains(env, "APP_NAME=dep1") || !contains(env, "PATH=/usr/bin") {
+				t.Errorf("service variables are not passed to script")
+			}
+			return 0, nil
+		})
+
+	_, _ = CmdRunScript(fakeHomeConfigPath, []string{"--svc=dep1", "hello", "arg"})
+}
+
+const workspaceConfigWithHooks = `
+name: ensi
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+    before_start:
+      - ./prepare.sh
+    after_start:
+      - ./migrate.sh
+      - ./warmup.sh
+`
+
+func TestServiceStartHooks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	composeFilePath := path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")
+
+	// success
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithHooks, "")
+
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "", nil)
+	expectPortCheck(mockPC, composeFilePath)
+	mockPC.EXPECT().Environ().Return([]string{"PATH=/usr/bin"}).Times(3)
+	gomock.InOrder(
+		mockPC.EXPECT().ExecInteractive([]string{"bash", "-c", "./prepare.sh"}, gomock.Any()).
+			DoAndReturn(func(command []string, env []string) (int, error) {
+				if env[0] != "PATH=/usr/bin" || !contains(env, "APP_NAME=test") {
+					t.Errorf("hook must get environment of elc with variables of service: %v", env)
+				}
+				return 0, nil
+			}),
+		mockPC.EXPECT().ExecInteractive([]string{"docker", "compose", "-f", composeFilePath, "up", "-d"}, gomock.Any()).Return(0, nil),
+		mockPC.EXPECT().ExecInteractive([]string{"bash", "-c", "./migrate.sh"}, gomock.Any()).Return(0, nil),
+		mockPC.EXPECT().ExecInteractive([]string{"bash", "-c", "./warmup.sh"}, gomock.Any()).Return(0, nil),
+	)
+
+	_ = CmdServiceStart(fakeHomeConfigPath, []string{})
+
+	// failed hook
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithHooks, "")
+
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "", nil)
+	expectPortCheck(mockPC, composeFilePath)
+	mockPC.EXPECT().Environ().Return([]string{"PATH=/usr/bin"})
+	mockPC.EXPECT().ExecInteractive([]string{"bash", "-c", "./prepare.sh"}, gomock.Any()).Return(1, nil)
+
+	err := CmdServiceStart(fakeHomeConfigPath, []string{})
+	if err == nil || err.Error() != "before_start hook './prepare.sh' of service test failed with code 1" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+const workspaceConfigWithExecPaths = `
+name: ensi
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+    exec_path: "/var/www/${APP_NAME}"
+  dep1:
+    path: "${WORKSPACE_PATH}/apps/dep1"
+modules:
+  mdl1:
+    path: "${WORKSPACE_PATH}/modules/mdl1"
+    hosted_in: dep1
+    exec_path: /var/www/mdl1
+`
+
+func TestServiceExecWorkingDir(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// service exec path
+	mockPC.EXPECT().Getuid().Return(1000)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithExecPaths, "")
+
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+	mockPC.EXPECT().IsTerminal().Return(true)
+	expectTerminalTitle(mockPC, "elc: ensi/test")
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"), "exec", "-w", "/var/www/test", "-u", "1000", "app", "some", "command"}, gomock.Any()).
+		Return(0, nil)
+
+	_, _ = CmdServiceExec(fakeHomeConfigPath, []string{"some", "command"})
+
+	// module by name
+	mockPC.EXPECT().Getuid().Return(1000)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithExecPaths, "")
+
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"))
+	mockPC.EXPECT().IsTerminal().Return(true)
+	expectTerminalTitle(mockPC, "elc: ensi/dep1")
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"), "exec", "-w", "/var/www/mdl1", "-u", "1000", "app", "some", "command"}, gomock.Any()).
+		Return(0, nil)
+
+	_, _ = CmdServiceExec(fakeHomeConfigPath, []string{"--svc=mdl1", "some", "command"})
+
+	// explicit working dir
+	mockPC.EXPECT().Getuid().Return(1000)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithExecPaths, "")
+
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"))
+	mockPC.EXPECT().IsTerminal().Return(true)
+	expectTerminalTitle(mockPC, "elc: ensi/dep1")
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"), "exec", "-w", "/tmp", "-u", "1000", "app", "some", "command"}, gomock.Any()).
+		Return(0, nil)
+
+	_, _ = CmdServiceExec(fakeHomeConfigPath, []string{"--svc=mdl1", "--workdir=/tmp", "some", "command"})
+}
+
+const workspaceConfigJson = `{
+  "name": "ensi",
+  "variables": {"V_B": "b", "V_A": "${V_B}-a"},
+  "services": {
+    "test": {"path": "${WORKSPACE_PATH}/apps/test"}
+  }
+}`
+
+func TestWorkspaceConfigJson(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(fakeWorkspacePath).Return(true)
+	mockPC.EXPECT().Getwd().Return(path.Join(fakeWorkspacePath, "apps/test"), nil)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "workspace.yaml")).Return(false)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "workspace.yml")).Return(false)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "workspace.json")).Return(true)
+	mockPC.EXPECT().ReadFile(path.Join(fakeWorkspacePath, "workspace.json")).Return([]byte(workspaceConfigJson), nil)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "env.yaml")).Return(false)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, ".env")).Return(false)
+	mockPC.EXPECT().LookupEnv("ELC_COMPOSE_ENGINE").Return("", false)
+	mockPC.EXPECT().LookupEnv("ELC_MODE").Return("", false)
+
+	mockPC.EXPECT().Println("WORKSPACE_PATH=/tmp/workspaces/project1")
+	mockPC.EXPECT().Println("WORKSPACE_NAME=ensi")
+	mockPC.EXPECT().Println("V_B=b")
+	mockPC.EXPECT().Println("V_A=b-a")
+	mockPC.EXPECT().Println("APP_NAME=test")
+	mockPC.EXPECT().Println("COMPOSE_PROJECT_NAME=ensi-test")
+	mockPC.EXPECT().Println("SVC_PATH=/tmp/workspaces/project1/apps/test")
+	mockPC.EXPECT().Println("COMPOSE_FILE=/tmp/workspaces/project1/apps/test/docker-compose.yml")
+
+	_ = CmdServiceVars(fakeHomeConfigPath, []string{})
+
+	// invalid json
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(fakeWorkspacePath).Return(true)
+	mockPC.EXPECT().Getwd().Return(path.Join(fakeWorkspacePath, "apps/test"), nil)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "workspace.yaml")).Return(false)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "workspace.yml")).Return(false)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "workspace.json")).Return(true)
+	mockPC.EXPECT().ReadFile(path.Join(fakeWorkspacePath, "workspace.json")).Return([]byte("name: ensi"), nil)
+
+	err := CmdServiceVars(fakeHomeConfigPath, []string{})
+	if err == nil {
+		t.Errorf("yaml content in json file must be rejected")
+	}
+}
+
+const workspaceConfigWithAnchors = `
+name: ensi
+x-common-variables: &common-variables
+  V_COMMON: common
+  V_OVERRIDDEN: common
+x-php-service: &php-service
+  extends: tpl1
+  dependencies:
+    dep1: [default]
+templates:
+  tpl1:
+    path: "${WORKSPACE_PATH}/templates/tpl1"
+services:
+  dep1:
+    path: "${WORKSPACE_PATH}/apps/dep1"
+  test:
+    <<: *php-service
+    path: "${WORKSPACE_PATH}/apps/test"
+    variables:
+      <<: *common-variables
+      V_OVERRIDDEN: own
+      V_OWN: ${V_COMMON}-own
+`
+
+func TestWorkspaceConfigAnchors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// merged service definition
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithAnchors, "")
+
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"))
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "templates/tpl1/docker-compose.yml"))
+
+	expectStartProgress(mockPC, "[1/2] starting service test", "[2/2] starting service dep1")
+	_ = CmdServiceStart(fakeHomeConfigPath, []string{})
+
+	// merged variables
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithAnchors, "")
+
+	mockPC.EXPECT().Println("WORKSPACE_PATH=/tmp/workspaces/project1")
+	mockPC.EXPECT().Println("WORKSPACE_NAME=ensi")
+	mockPC.EXPECT().Println("APP_NAME=test")
+	mockPC.EXPECT().Println("COMPOSE_PROJECT_NAME=ensi-test")
+	mockPC.EXPECT().Println("SVC_PATH=/tmp/workspaces/project1/apps/test")
+	mockPC.EXPECT().Println("TPL_PATH=/tmp/workspaces/project1/templates/tpl1")
+	mockPC.EXPECT().Println("COMPOSE_FILE=/tmp/workspaces/project1/templates/tpl1/docker-compose.yml")
+	gomock.InOrder(
+		mockPC.EXPECT().Println("V_COMMON=common"),
+		mockPC.EXPECT().Println("V_OVERRIDDEN=own"),
+		mockPC.EXPECT().Println("V_OWN=common-own"),
+	)
+
+	_ = CmdServiceVars(fakeHomeConfigPath, []string{})
+}
+
+func TestWorkspaceInit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	wsPath := "/tmp/workspaces/project3"
+	configPath := path.Join(wsPath, "workspace.yaml")
+	var configData []byte
+
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().Getwd().Return("/tmp", nil)
+	mockPC.EXPECT().FileExists(configPath).Return(false)
+	mockPC.EXPECT().FileExists(path.Join(wsPath, "workspace.yml")).Return(false)
+	mockPC.EXPECT().FileExists(path.Join(wsPath, "workspace.json")).Return(false)
+	mockPC.EXPECT().WriteFile(configPath, gomock.Any(), os.FileMode(0644)).
+		DoAndReturn(func(filename string, data []byte, perm os.FileMode) error {
+			configData = data
+			return nil
+		})
+	mockPC.EXPECT().Printf("config %s is created\n", configPath)
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, []byte(homeConfigForAdd), os.FileMode(0600))
+	mockPC.EXPECT().Printf("workspace '%s' is added\n", "project3")
+
+	_ = CmdWorkspaceInit(fakeHomeConfigPath, []string{"workspaces/project3"})
+
+	cfg := NewConfig(wsPath, wsPath)
+	err := unmarshalConfig(configPath, configData, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "project3" || len(cfg.Services) != 1 {
+		t.Errorf("unexpected config: %s", configData)
+	}
+	err = cfg.checkVersion()
+	if err != nil {
+		t.Errorf("generated config is not compatible with current version: %s", err)
+	}
+
+	// existing config
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().Getwd().Return("/tmp", nil)
+	mockPC.EXPECT().FileExists(configPath).Return(true)
+	mockPC.EXPECT().Printf("config %s already exists, skipped\n", configPath)
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, gomock.Any(), os.FileMode(0600))
+	mockPC.EXPECT().Printf("workspace '%s' is added\n", "custom")
+
+	_ = CmdWorkspaceInit(fakeHomeConfigPath, []string{"--name=custom", wsPath})
+
+	// registered workspace without config
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().Getwd().Return("/tmp", nil)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "workspace.yaml")).Return(false)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "workspace.yml")).Return(false)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "workspace.json")).Return(false)
+	mockPC.EXPECT().WriteFile(path.Join(fakeWorkspacePath, "workspace.yaml"), gomock.Any(), os.FileMode(0644))
+	mockPC.EXPECT().Printf("config %s is created\n", path.Join(fakeWorkspacePath, "workspace.yaml"))
+
+	err = CmdWorkspaceInit(fakeHomeConfigPath, []string{fakeWorkspacePath})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// custom config
+	customConfigPath := path.Join(wsPath, "light.yaml")
+	var homeConfigData []byte
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().Getwd().Return("/tmp", nil)
+	mockPC.EXPECT().FileExists(customConfigPath).Return(false)
+	mockPC.EXPECT().WriteFile(customConfigPath, gomock.Any(), os.FileMode(0644))
+	mockPC.EXPECT().Printf("config %s is created\n", customConfigPath)
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, gomock.Any(), os.FileMode(0600)).
+		DoAndReturn(func(filename string, data []byte, perm os.FileMode) error {
+			homeConfigData = data
+			return nil
+		})
+	mockPC.EXPECT().Printf("workspace '%s' is added\n", "light")
+
+	err = CmdWorkspaceInit(fakeHomeConfigPath, []string{"--name=light", "--config=light.yaml", wsPath})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(homeConfigData), "config: light.yaml") {
+		t.Errorf("workspace is registered without config:\n%s", homeConfigData)
+	}
+}
+
+func TestHomeConfigProfiles(t *testing.T) {
+	configPath, _ := GetHomeConfigPath("/tmp/home", "")
+	if configPath != fakeHomeConfigPath {
+		t.Errorf("unexpected path of default home config: %s", configPath)
+	}
+
+	configPath, _ = GetHomeConfigPath("/tmp/home", "work")
+	if configPath != "/tmp/home/.elc.work.yaml" {
+		t.Errorf("unexpected path of profile home config: %s", configPath)
+	}
+
+	_, err := GetHomeConfigPath("/tmp/home", "../work")
+	if err == nil {
+		t.Errorf("profile name with path separator must be rejected")
+	}
+}
+
+const workspaceConfigWithDefaultMode = workspaceConfigWithDeps + `
+default_mode: hook
+`
+
+func TestServiceStartDefaultMode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// mode from workspace config
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDefaultMode, "")
+
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"))
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+
+	expectStartProgress(mockPC, "[1/2] starting service test", "[2/2] starting service dep2")
+	_ = CmdServiceStart(fakeHomeConfigPath, []string{})
+
+	// mode from env config
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDefaultMode, "default_mode: single")
+
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+
+	_ = CmdServiceStart(fakeHomeConfigPath, []string{})
+
+	// mode from ELC_MODE variable
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfigWithMode(mockPC, fakeWorkspacePath, workspaceConfigWithDefaultMode, "default_mode: hook", "single")
+
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+
+	_ = CmdServiceStart(fakeHomeConfigPath, []string{})
+
+	// explicit mode overrides ELC_MODE
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfigWithMode(mockPC, fakeWorkspacePath, workspaceConfigWithDefaultMode, "", "single")
+
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"))
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"))
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+
+	expectStartProgress(mockPC, "[1/3] starting service test", "[2/3] starting service dep1", "[3/3] starting service dep2")
+	_ = CmdServiceStart(fakeHomeConfigPath, []string{"--mode=default"})
+
+	// mode from home config
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return([]byte(baseHomeConfig+"default_mode: hook\n"), nil)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"))
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+
+	expectStartProgress(mockPC, "[1/2] starting service test", "[2/2] starting service dep2")
+	_ = CmdServiceStart(fakeHomeConfigPath, []string{})
+}
+
+const workspaceConfigWithDefaultUid = `
+name: ensi
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+    default_uid: 0
+`
+
+func TestServiceExecDefaultUid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	composeFilePath := path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")
+
+	// uid from config
+	mockPC.EXPECT().Getuid().Return(1000)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDefaultUid, "")
+
+	expectStartService(mockPC, composeFilePath)
+	mockPC.EXPECT().IsTerminal().Return(true)
+	expectTerminalTitle(mockPC, "elc: ensi/test")
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", composeFilePath, "exec", "-u", "0", "app", "some", "command"}, gomock.Any()).
+		Return(0, nil)
+
+	_, _ = CmdServiceExec(fakeHomeConfigPath, []string{"some", "command"})
+
+	// explicit uid
+	mockPC.EXPECT().Getuid().Return(1000)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDefaultUid, "")
+
+	expectStartService(mockPC, composeFilePath)
+	mockPC.EXPECT().IsTerminal().Return(true)
+	expectTerminalTitle(mockPC, "elc: ensi/test")
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", composeFilePath, "exec", "-u", "1000", "app", "some", "command"}, gomock.Any()).
+		Return(0, nil)
+
+	_, _ = CmdServiceExec(fakeHomeConfigPath, []string{"--uid=1000", "some", "command"})
+}
+
+func TestServiceExecUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	composeFilePath := path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")
+
+	// user name
+	mockPC.EXPECT().Getuid().Return(1000)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDefaultUid, "")
+
+	expectStartService(mockPC, composeFilePath)
+	mockPC.EXPECT().IsTerminal().Return(true)
+	expectTerminalTitle(mockPC, "elc: ensi/test")
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", composeFilePath, "exec", "--user", "www-data", "app", "some", "command"}, gomock.Any()).
+		Return(0, nil)
+
+	_, _ = CmdServiceExec(fakeHomeConfigPath, []string{"--user=www-data", "some", "command"})
+
+	// user name with uid
+	mockPC.EXPECT().Getuid().Return(1000)
+
+	_, err := CmdServiceExec(fakeHomeConfigPath, []string{"--user=www-data", "--uid=0", "some", "command"})
+	if err == nil {
+		t.Errorf("--user and --uid must be mutually exclusive")
+	}
+}
+
+func TestServiceExecDetach(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	composeFilePath := path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")
+
+	mockPC.EXPECT().Getuid().Return(1000)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfig, "")
+
+	expectStartService(mockPC, composeFilePath)
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", composeFilePath, "exec", "-u", "1000", "-d", "-T", "app", "worker"}, gomock.Any()).
+		Return(0, nil)
+
+	_, _ = CmdServiceExec(fakeHomeConfigPath, []string{"-d", "worker"})
+}
+
+const workspaceConfigWithTwoDepTrees = `
+name: ensi
+services:
+  dep1:
+    path: "${WORKSPACE_PATH}/apps/dep1"
+  dep2:
+    path: "${WORKSPACE_PATH}/apps/dep2"
+  test1:
+    path: "${WORKSPACE_PATH}/apps/test1"
+    dependencies:
+      dep1: [default]
+  test2:
+    path: "${WORKSPACE_PATH}/apps/test2"
+    dependencies:
+      dep2: [default]
+`
+
+func TestServiceStartDepTimeoutPerService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithTwoDepTrees, "")
+
+	// every dependency takes most of timeout, so shared deadline would expire on the second service
+	for _, names := range [][]string{{"test1", "dep1"}, {"test2", "dep2"}} {
+		svcComposeFilePath := path.Join(fakeWorkspacePath, "apps", names[0], "docker-compose.yml")
+		depComposeFilePath := path.Join(fakeWorkspacePath, "apps", names[1], "docker-compose.yml")
+		mockPC.EXPECT().
+			ExecToString([]string{"docker", "compose", "-f", svcComposeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+			Return(0, "", nil)
+		mockPC.EXPECT().
+			ExecToString([]string{"docker", "compose", "-f", depComposeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+			Return(0, "", nil)
+		expectPortCheck(mockPC, depComposeFilePath)
+		mockPC.EXPECT().
+			ExecInteractiveContext(gomock.Any(), []string{"docker", "compose", "-f", depComposeFilePath, "up", "-d"}, gomock.Any()).
+			DoAndReturn(func(ctx context.Context, command []string, env []string) (int, error) {
+				time.Sleep(300 * time.Millisecond)
+				return 0, ctx.Err()
+			})
+		expectPortCheck(mockPC, svcComposeFilePath)
+		mockPC.EXPECT().
+			ExecInteractive([]string{"docker", "compose", "-f", svcComposeFilePath, "up", "-d"}, gomock.Any()).
+			Return(0, nil)
+	}
+	mockPC.EXPECT().IsTerminal().Return(false).Times(2)
+	mockPC.EXPECT().Printf("%s\n", gomock.Any()).Times(4)
+	expectBatchReport(mockPC, "test1", "done", "test2", "done")
+
+	err := CmdServiceStart(fakeHomeConfigPath, []string{"--dep-timeout=500ms", "test1", "test2"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServiceStartDepTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	dep2ComposeFilePath := path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml")
+
+	// timeout from option
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"), "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "", nil)
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", dep2ComposeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "", nil)
+	expectPortCheck(mockPC, dep2ComposeFilePath)
+	mockPC.EXPECT().
+		ExecInteractiveContext(gomock.Any(), []string{"docker", "compose", "-f", dep2ComposeFilePath, "up", "-d"}, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, command []string, env []string) (int, error) {
+			<-ctx.Done()
+			return -1, ctx.Err()
+		})
+
+	expectStartProgress(mockPC, "[1/2] starting service test", "[2/2] starting service dep2")
+	err := CmdServiceStart(fakeHomeConfigPath, []string{"--mode=hook", "--dep-timeout=10ms"})
+	if err == nil || err.Error() != "dependencies of service test are not started in 10ms: dep2" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// invalid timeout in config
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "dep_timeout: soon")
+
+	err = CmdServiceStart(fakeHomeConfigPath, []string{})
+	if err == nil {
+		t.Errorf("invalid dep_timeout must be rejected")
+	}
+}
+
+func TestServiceStopParallel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// stop
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	expectRunningProjects(mockPC, "ensi-dep1\nensi-dep2\nensi-dep3\nensi-test\n")
+	testStopped := expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml")).After(testStopped)
+	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml")).After(testStopped)
+	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/dep3/docker-compose.yml")).After(testStopped)
+	expectBatchReport(mockPC, "dep1", "done", "dep2", "done", "dep3", "done", "test", "done")
+
+	_ = CmdServiceStop(fakeHomeConfigPath, []string{"--all", "--parallel=2"})
+
+	// destroy with errors
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"), "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(1, "", errors.New("docker is not running"))
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"), "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(1, "", errors.New("docker is not running"))
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml")).Return(true)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml")).Return(true)
+	expectDestroyService(mockPC, path.Join(fakeWorkspacePath, "apps/dep3/docker-compose.yml"))
+	expectBatchReport(mockPC,
+		"dep1", "failed: docker is not running",
+		"dep2", "failed: docker is not running",
+		"dep3", "done",
+	)
+
+	err := CmdServiceDestroy(fakeHomeConfigPath, []string{"--parallel=3", "dep1", "dep2", "dep3"})
+	if err == nil || err.Error() != "dep1: docker is not running\ndep2: docker is not running" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServiceStopTimings(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	Globals.Timings = true
+	defer func() { Globals.Timings = false }()
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"))
+	mockPC.EXPECT().Eprintf("%-40s %s\n", "dep1: compose ps --status=running -q", gomock.Any())
+	mockPC.EXPECT().Eprintf("%-40s %s\n", "dep1: compose stop", gomock.Any())
+	mockPC.EXPECT().Eprintf("%-40s %s\n", "dep1: stop", gomock.Any())
+
+	_ = CmdServiceStop(fakeHomeConfigPath, []string{"dep1"})
+}
+
+const composeConfigWithPorts = `
+services:
+  app:
+    ports:
+    - mode: ingress
+      target: 80
+      published: "8080"
+      protocol: tcp
+  db:
+    ports:
+    - mode: ingress
+      host_ip: 127.0.0.1
+      target: 5432
+      published: 5432
+      protocol: tcp
+`
+
+func TestServiceStartPortConflict(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	composeFilePath := path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")
+
+	// port is busy
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfig, "")
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "", nil)
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "config"}, gomock.Any()).
+		Return(0, composeConfigWithPorts, nil)
+	mockPC.EXPECT().IsPortFree("", "8080").Return(true)
+	mockPC.EXPECT().IsPortFree("127.0.0.1", "5432").Return(false)
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "ps", "--filter", "publish=5432", "--format", "{{.Names}}"}, gomock.Any()).
+		Return(0, "other-db-1\n", nil)
+
+	err := CmdServiceStart(fakeHomeConfigPath, []string{})
+	if err == nil || err.Error() != "port 5432 required by service test is already in use by other-db-1" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// check is disabled
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfig, "")
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "", nil)
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", composeFilePath, "up", "-d"}, gomock.Any()).
+		Return(0, nil)
+
+	_ = CmdServiceStart(fakeHomeConfigPath, []string{"--no-port-check"})
+}
+
+const workspaceConfigWithWaitFor = `
+name: ensi
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+    dependencies:
+      db: [default]
+  db:
+    path: "${WORKSPACE_PATH}/apps/db"
+    wait_for: "${APP_NAME}:5432"
+`
+
+func TestServiceStartWaitFor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	waitForInterval = time.Millisecond
+	defer func() { waitForInterval = time.Second }()
+
+	// port is opened
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithWaitFor, "")
+
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"), "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "", nil)
+	dbStarted := expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/db/docker-compose.yml"))
+	gomock.InOrder(
+		mockPC.EXPECT().IsPortOpen("db:5432").Return(false).After(dbStarted),
+		mockPC.EXPECT().IsPortOpen("db:5432").Return(true),
+	)
+	expectPortCheck(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"), "up", "-d"}, gomock.Any()).
+		Return(0, nil)
+
+	expectStartProgress(mockPC, "[1/2] starting service test", "[2/2] starting service db")
+	_ = CmdServiceStart(fakeHomeConfigPath, []string{})
+
+	// timeout
+	waitForTimeout = 10 * time.Millisecond
+	defer func() { waitForTimeout = time.Minute }()
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithWaitFor, "")
+
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/db/docker-compose.yml"))
+	mockPC.EXPECT().IsPortOpen("db:5432").Return(false).MinTimes(1)
+
+	err := CmdServiceStart(fakeHomeConfigPath, []string{"db"})
+	if err == nil || err.Error() != "service db is not available at db:5432" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServiceRecreate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// current
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"), "up", "-d", "--force-recreate"}, gomock.Any()).
+		Return(0, nil)
+
+	_ = CmdServiceRecreate(fakeHomeConfigPath, []string{})
+
+	// by names
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	gomock.InOrder(
+		mockPC.EXPECT().
+			ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"), "up", "-d", "--force-recreate"}, gomock.Any()).
+			Return(0, nil),
+		mockPC.EXPECT().
+			ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"), "up", "-d", "--force-recreate"}, gomock.Any()).
+			Return(0, nil),
+	)
+	expectBatchReport(mockPC, "dep1", "done", "dep2", "done")
+
+	_ = CmdServiceRecreate(fakeHomeConfigPath, []string{"dep1", "dep2"})
+}
+
+const workspaceConfigWithDotEnv = `
+name: ensi
+variables:
+  DB_HOST: ${DB_HOST:-localhost}
+  DB_URL: postgres://${DB_HOST}:${DB_PORT:-5432}
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+`
+
+const dotEnv = `
+# database
+DB_HOST=db.local
+export DB_PORT="6432"
+DB_USER='user'
+`
+
+func TestDotEnv(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(fakeWorkspacePath).Return(true)
+	mockPC.EXPECT().Getwd().Return(path.Join(fakeWorkspacePath, "apps/test"), nil)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "workspace.yaml")).Return(true)
+	mockPC.EXPECT().ReadFile(path.Join(fakeWorkspacePath, "workspace.yaml")).Return([]byte(workspaceConfigWithDotEnv), nil)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "env.yaml")).Return(false)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, ".env")).Return(true)
+	mockPC.EXPECT().ReadFile(path.Join(fakeWorkspacePath, ".env")).Return([]byte(dotEnv), nil)
+	mockPC.EXPECT().LookupEnv("DB_HOST").Return("", false)
+	mockPC.EXPECT().LookupEnv("DB_PORT").Return("7432", true)
+	mockPC.EXPECT().LookupEnv("DB_USER").Return("", false)
+	mockPC.EXPECT().LookupEnv("ELC_COMPOSE_ENGINE").Return("", false)
+	mockPC.EXPECT().LookupEnv("ELC_MODE").Return("", false)
+
+	gomock.InOrder(
+		mockPC.EXPECT().Println("WORKSPACE_PATH=/tmp/workspaces/project1"),
+		mockPC.EXPECT().Println("WORKSPACE_NAME=ensi"),
+		mockPC.EXPECT().Println("DB_PORT=7432"),
+		mockPC.EXPECT().Println("DB_USER=user"),
+		mockPC.EXPECT().Println("DB_HOST=db.local"),
+		mockPC.EXPECT().Println("DB_URL=postgres://db.local:7432"),
+		mockPC.EXPECT().Println("APP_NAME=test"),
+		mockPC.EXPECT().Println("COMPOSE_PROJECT_NAME=ensi-test"),
+		mockPC.EXPECT().Println("SVC_PATH=/tmp/workspaces/project1/apps/test"),
+		mockPC.EXPECT().Println("COMPOSE_FILE=/tmp/workspaces/project1/apps/test/docker-compose.yml"),
+	)
+
+	_ = CmdServiceVars(fakeHomeConfigPath, []string{})
+}
+
+const workspaceConfigWithSecrets = `
+name: ensi
+secrets_file: secrets.yaml
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+    variables:
+      DB_URL: postgres://user:${DB_PASSWORD}@db
+`
+
+func TestServiceVarsSecrets(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	secretsPath := path.Join(fakeWorkspacePath, "secrets.yaml")
+
+	// masked
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithSecrets, "")
+	mockPC.EXPECT().FileExists(secretsPath).Return(true)
+	mockPC.EXPECT().ReadFile(secretsPath).Return([]byte("DB_PASSWORD: qwerty"), nil)
+
+	gomock.InOrder(
+		mockPC.EXPECT().Println("WORKSPACE_PATH=/tmp/workspaces/project1"),
+		mockPC.EXPECT().Println("WORKSPACE_NAME=ensi"),
+		mockPC.EXPECT().Println("DB_PASSWORD=****"),
+		mockPC.EXPECT().Println("APP_NAME=test"),
+		mockPC.EXPECT().Println("COMPOSE_PROJECT_NAME=ensi-test"),
+		mockPC.EXPECT().Println("SVC_PATH=/tmp/workspaces/project1/apps/test"),
+		mockPC.EXPECT().Println("COMPOSE_FILE=/tmp/workspaces/project1/apps/test/docker-compose.yml"),
+		mockPC.EXPECT().Println("DB_URL=postgres://user:qwerty@db"),
+	)
+
+	_ = CmdServiceVars(fakeHomeConfigPath, []string{})
+
+	// shown
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithSecrets, "")
+	mockPC.EXPECT().FileExists(secretsPath).Return(true)
+	mockPC.EXPECT().ReadFile(secretsPath).Return([]byte("DB_PASSWORD: qwerty"), nil)
+
+	mockPC.EXPECT().Println("DB_PASSWORD=qwerty")
+	mockPC.EXPECT().Println(gomock.Any()).AnyTimes()
+
+	_ = CmdServiceVars(fakeHomeConfigPath, []string{"--show-secrets"})
+}
+
+const workspaceConfigWithOverriddenSecret = `
+name: ensi
+secrets_file: secrets.yaml
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+  test1:
+    path: "${WORKSPACE_PATH}/apps/test"
+    variables:
+      DB_PASSWORD: local
+`
+
+func TestServiceVarsDiffSecrets(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	secretsPath := path.Join(fakeWorkspacePath, "secrets.yaml")
+	expectSecrets := func() {
+		expectReadHomeConfig(mockPC)
+		expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithOverriddenSecret, "")
+		mockPC.EXPECT().FileExists(secretsPath).Return(true)
+		mockPC.EXPECT().ReadFile(secretsPath).Return([]byte("DB_PASSWORD: qwerty"), nil)
+		mockPC.EXPECT().Printf("-%s=%s\n", "APP_NAME", "test")
+		mockPC.EXPECT().Printf("+%s=%s\n", "APP_NAME", "test1")
+		mockPC.EXPECT().Printf("-%s=%s\n", "COMPOSE_PROJECT_NAME", "ensi-test")
+		mockPC.EXPECT().Printf("+%s=%s\n", "COMPOSE_PROJECT_NAME", "ensi-test1")
+	}
+
+	// masked
+	expectSecrets()
+	mockPC.EXPECT().Printf("-%s=%s\n", "DB_PASSWORD", "****")
+	mockPC.EXPECT().Printf("+%s=%s\n", "DB_PASSWORD", "****")
+
+	err := CmdServiceVarsDiff(fakeHomeConfigPath, []string{"test", "test1"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// shown
+	expectSecrets()
+	mockPC.EXPECT().Printf("-%s=%s\n", "DB_PASSWORD", "qwerty")
+	mockPC.EXPECT().Printf("+%s=%s\n", "DB_PASSWORD", "local")
+
+	err = CmdServiceVarsDiff(fakeHomeConfigPath, []string{"--show-secrets", "test", "test1"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+const workspaceConfigWithSecretVars = `
+name: ensi
+secret_vars: ["*_PASSWORD"]
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+    variables:
+      DB_PASSWORD: qwerty
+      DB_USER: user
+`
+
+func TestServiceVarsSecretPatterns(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithSecretVars, "secret_vars: [\"*_USER\"]")
+
+	mockPC.EXPECT().Println("DB_PASSWORD=****")
+	mockPC.EXPECT().Println("DB_USER=****")
+	mockPC.EXPECT().Println("DB_PASSWORD=qwerty")
+	mockPC.EXPECT().Println("DB_USER=user")
+	mockPC.EXPECT().Println(gomock.Any()).AnyTimes()
+
+	_ = CmdServiceVars(fakeHomeConfigPath, []string{})
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithSecretVars, "")
+
+	_ = CmdServiceVars(fakeHomeConfigPath, []string{"--show-secrets"})
+}
+
+func TestServiceVarsDiffSecretPatterns(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	config := workspaceConfigWithSecretVars + `  test1:
+    path: "${WORKSPACE_PATH}/apps/test"
+    variables:
+      DB_PASSWORD: other
+      DB_USER: user
+`
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, config, "")
+	mockPC.EXPECT().Printf("-%s=%s\n", "APP_NAME", "test")
+	mockPC.EXPECT().Printf("+%s=%s\n", "APP_NAME", "test1")
+	mockPC.EXPECT().Printf("-%s=%s\n", "COMPOSE_PROJECT_NAME", "ensi-test")
+	mockPC.EXPECT().Printf("+%s=%s\n", "COMPOSE_PROJECT_NAME", "ensi-test1")
+	mockPC.EXPECT().Printf("-%s=%s\n", "DB_PASSWORD", "****")
+	mockPC.EXPECT().Printf("+%s=%s\n", "DB_PASSWORD", "****")
+
+	err := CmdServiceVarsDiff(fakeHomeConfigPath, []string{"test", "test1"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServiceStopIdempotent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	dep1ComposeFilePath := path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml")
+	dep2ComposeFilePath := path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml")
+	dep3ComposeFilePath := path.Join(fakeWorkspacePath, "apps/dep3/docker-compose.yml")
+
+	// already stopped
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", dep1ComposeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "", nil)
+
+	err := CmdServiceStop(fakeHomeConfigPath, []string{"dep1"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// compose file does not exist
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", dep1ComposeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "", nil)
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", dep2ComposeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(1, "", errors.New("exit status 1"))
+	mockPC.EXPECT().FileExists(dep2ComposeFilePath).Return(false)
+	expectStopService(mockPC, dep3ComposeFilePath)
+	expectBatchReport(mockPC, "dep1", "done", "dep2", "done", "dep3", "done")
+
+	err = CmdServiceStop(fakeHomeConfigPath, []string{"dep1", "dep2", "dep3"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// real error
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", dep1ComposeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(1, "", errors.New("docker is not running"))
+	mockPC.EXPECT().FileExists(dep1ComposeFilePath).Return(true)
+
+	err = CmdServiceStop(fakeHomeConfigPath, []string{"dep1"})
+	if err == nil || err.Error() != "docker is not running" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServiceStopKeepGoing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	dep1ComposeFilePath := path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml")
+
+	// stops on first error
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", dep1ComposeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(1, "", errors.New("docker is not running"))
+	mockPC.EXPECT().FileExists(dep1ComposeFilePath).Return(true)
+	expectBatchReport(mockPC, "dep1", "failed: docker is not running", "dep2", "skipped")
+
+	err := CmdServiceStop(fakeHomeConfigPath, []string{"dep1", "dep2"})
+	if err == nil || err.Error() != "docker is not running" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// keep going
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", dep1ComposeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(1, "", errors.New("docker is not running"))
+	mockPC.EXPECT().FileExists(dep1ComposeFilePath).Return(true)
+	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"))
+	expectBatchReport(mockPC, "dep1", "failed: docker is not running", "dep2", "done")
+
+	err = CmdServiceStop(fakeHomeConfigPath, []string{"--keep-going", "dep1", "dep2"})
+	if err == nil || err.Error() != "dep1: docker is not running" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+const oldWorkspaceConfig = `name: ensi
+templates:
+- name: tpl1
+  path: ${WORKSPACE_PATH}/templates/tpl1
+services:
+- name: test
+  extends: tpl1
+  path: ${WORKSPACE_PATH}/apps/test
+`
+
+const migratedWorkspaceConfig = `name: ensi
+templates:
+  tpl1:
+    path: ${WORKSPACE_PATH}/templates/tpl1
+services:
+  test:
+    extends: tpl1
+    path: ${WORKSPACE_PATH}/apps/test
+elc_min_version: ` + Version + `
+`
+
+func TestConfigMigrate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	configPath := path.Join(fakeWorkspacePath, "workspace.yaml")
+
+	// old config
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(configPath).Return(true)
+	mockPC.EXPECT().ReadFile(configPath).Return([]byte(oldWorkspaceConfig), nil)
+	gomock.InOrder(
+		mockPC.EXPECT().WriteFile(configPath+".bak", []byte(oldWorkspaceConfig), os.FileMode(0644)),
+		mockPC.EXPECT().WriteFile(configPath, []byte(migratedWorkspaceConfig), os.FileMode(0644)),
+	)
+	mockPC.EXPECT().Printf("- %s\n", "convert list of templates to mapping")
+	mockPC.EXPECT().Printf("- %s\n", "convert list of services to mapping")
+	mockPC.EXPECT().Printf("- %s\n", "set elc_min_version to "+Version)
+	mockPC.EXPECT().Printf("config %s is migrated, backup is saved to %s.bak\n", configPath, configPath)
+
+	_ = CmdConfigMigrate(fakeHomeConfigPath, []string{})
+
+	// actual config
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(configPath).Return(true)
+	mockPC.EXPECT().ReadFile(configPath).Return([]byte(migratedWorkspaceConfig), nil)
+	mockPC.EXPECT().Printf("config is up to date\n")
+
+	_ = CmdConfigMigrate(fakeHomeConfigPath, []string{})
+}
+
+func TestCheckVersion(t *testing.T) {
+	cfg := NewConfig(fakeWorkspacePath, fakeWorkspacePath)
+
+	cfg.ElcMinVersion = "100.0.0"
+	err := cfg.checkVersion()
+	expected := "This workspace requires elc version 100.0.0 or newer, but current version is " + Version + ". Please, update elc with 'elc update' or use another binary."
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	cfg.ElcMinVersion = "latest"
+	err = cfg.checkVersion()
+	expected = "invalid elc_min_version 'latest' in workspace config: Malformed version: latest. Run 'elc config migrate' to fix it."
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	cfg.ElcMinVersion = Version
+	err = cfg.checkVersion()
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWorkspaceMissingPath(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(fakeWorkspacePath).Return(false)
+
+	err := CmdServiceStart(fakeHomeConfigPath, []string{})
+	expected := "directory of workspace 'project1' is not found at /tmp/workspaces/project1, fix it with 'elc workspace set-path project1 PATH'"
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, []byte(`current_workspace: project1
+update_command: update
+workspaces:
+- name: project1
+  path: /tmp/moved/project1
+- name: project2
+  path: /tmp/workspaces/project2
+`), os.FileMode(0600))
+	mockPC.EXPECT().Printf("path of workspace '%s' changed to %s\n", "project1", "/tmp/moved/project1")
+
+	_ = CmdWorkspaceSetPath(fakeHomeConfigPath, []string{"project1", "/tmp/moved/project1"})
+}
+
+func TestWorkspaceMissingConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(fakeWorkspacePath).Return(true)
+	mockPC.EXPECT().Getwd().Return(path.Join(fakeWorkspacePath, "apps/test"), nil)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "workspace.yaml")).Return(false)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "workspace.yml")).Return(false)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "workspace.json")).Return(false)
+
+	err := CmdServiceStart(fakeHomeConfigPath, []string{})
+	expected := "config of workspace is not found in /tmp/workspaces/project1, expected one of: workspace.yaml, workspace.yml, workspace.json. " +
+		"Create it with 'elc workspace init /tmp/workspaces/project1'"
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	args, err := ParseGlobalFlags([]string{"-q", "workspace", "add"})
+	defer func() { Globals.Quiet = false }()
+	if err != nil || !Globals.Quiet || len(args) != 2 {
+		t.Fatalf("unexpected result of parsing: %v, %v", args, err)
+	}
+
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, []byte(homeConfigForAdd), os.FileMode(0600))
+
+	_ = CmdWorkspaceAdd(fakeHomeConfigPath, []string{"project3", "/tmp/workspaces/project3"})
+}
+
+const homeConfigWithRememberLast = `
+current_workspace: project1
+remember_last_service: true
+workspaces:
+- name: project1
+  path: /tmp/workspaces/project1
+`
+
+func TestRememberLastService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	statePath := path.Join(fakeWorkspacePath, ".elc-state.yaml")
+	dep1ComposeFilePath := path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml")
+
+	// remember
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return([]byte(homeConfigWithRememberLast), nil)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().FileExists(statePath).Return(false)
+	mockPC.EXPECT().WriteFile(statePath, []byte("checksums: {}\nlast_service: dep1\n"), os.FileMode(0644))
+	mockPC.EXPECT().ExecInteractive([]string{"docker", "compose", "-f", dep1ComposeFilePath, "ps"}, gomock.Any())
+
+	_, _ = CmdServiceCompose(fakeHomeConfigPath, []string{"--svc=dep1", "ps"})
+
+	// use outside of service directory
+	Globals.Cwd = "/tmp"
+	defer func() { Globals.Cwd = "" }()
+
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return([]byte(homeConfigWithRememberLast), nil)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().FileExists(statePath).Return(true)
+	mockPC.EXPECT().ReadFile(statePath).Return([]byte("last_service: dep1\n"), nil)
+	mockPC.EXPECT().ExecInteractive([]string{"docker", "compose", "-f", dep1ComposeFilePath, "ps"}, gomock.Any())
+
+	_, _ = CmdServiceCompose(fakeHomeConfigPath, []string{"ps"})
+
+	// disabled
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	mockPC.EXPECT().IsStdinTerminal().Return(false)
+
+	_, err := CmdServiceCompose(fakeHomeConfigPath, []string{"ps"})
+	if err == nil || err.Error() != "you are not in folder of workspace ensi (/tmp/workspaces/project1), select another workspace with 'elc workspace select NAME' or pass service with --svc" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// inside workspace, but outside of services
+	Globals.Cwd = fakeWorkspacePath
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	mockPC.EXPECT().IsStdinTerminal().Return(false)
+
+	_, err = CmdServiceCompose(fakeHomeConfigPath, []string{"ps"})
+	if err == nil || err.Error() != "you are not in service folder" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+const workspaceConfigForShow = `
+name: ensi
+aliases:
+  t: test
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+    dependencies:
+      dep1: [default, hook]
+  dep1:
+    path: "${WORKSPACE_PATH}/apps/dep1"
+modules:
+  mdl1:
+    path: "${WORKSPACE_PATH}/modules/mdl1"
+    hosted_in: test
+`
+
+func TestServiceShow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// plain
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigForShow, "")
+
+	gomock.InOrder(
+		mockPC.EXPECT().Printf("%-14s %s\n", "name:", "test"),
+		mockPC.EXPECT().Printf("%-14s %s\n", "path:", "/tmp/workspaces/project1/apps/test"),
+		mockPC.EXPECT().Printf("%-14s %s\n", "compose file:", "/tmp/workspaces/project1/apps/test/docker-compose.yml"),
+		mockPC.EXPECT().Printf("%-14s %s\n", "aliases:", "t"),
+		mockPC.EXPECT().Println("dependencies:"),
+		mockPC.EXPECT().Printf("  %-12s %s\n", "dep1", "default, hook"),
+		mockPC.EXPECT().Println("modules:"),
+		mockPC.EXPECT().Printf("  %s\n", "mdl1"),
+	)
+
+	_ = CmdServiceShow(fakeHomeConfigPath, []string{})
+
+	// json
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigForShow, "")
+
+	mockPC.EXPECT().Println(`{
+  "name": "dep1",
+  "path": "/tmp/workspaces/project1/apps/dep1",
+  "compose_file": "/tmp/workspaces/project1/apps/dep1/docker-compose.yml",
+  "aliases": [],
+  "dependencies": {},
+  "modules": []
+}`)
+
+	_ = CmdServiceShow(fakeHomeConfigPath, []string{"--format=json", "dep1"})
+}
+
+const workspaceConfigForOverrides = `
+name: ensi
+variables:
+  DB_HOST: ${DB_HOST:-localhost}
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+    variables:
+      DB_URL: postgres://${DB_HOST}/db
+      DEBUG: "false"
+`
+
+func TestServiceVarsOverrides(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigForOverrides, "")
+
+	gomock.InOrder(
+		mockPC.EXPECT().Println("WORKSPACE_PATH=/tmp/workspaces/project1"),
+		mockPC.EXPECT().Println("WORKSPACE_NAME=ensi"),
+		mockPC.EXPECT().Println("APP_NAME=test"),
+		mockPC.EXPECT().Println("COMPOSE_PROJECT_NAME=ensi-test"),
+		mockPC.EXPECT().Println("SVC_PATH=/tmp/workspaces/project1/apps/test"),
+		mockPC.EXPECT().Println("COMPOSE_FILE=/tmp/workspaces/project1/apps/test/docker-compose.yml"),
+		mockPC.EXPECT().Println("DB_URL=postgres://db.local/db"),
+		mockPC.EXPECT().Println("DB_HOST=db.local"),
+		mockPC.EXPECT().Println("DEBUG=true"),
+	)
+
+	_ = CmdServiceVars(fakeHomeConfigPath, []string{"--set", "DB_HOST=db.local", "--set=DEBUG=true"})
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigForOverrides, "")
+
+	err := CmdServiceVars(fakeHomeConfigPath, []string{"--set", "DEBUG"})
+	if err == nil || err.Error() != "invalid value \"DEBUG\" for flag -set: invalid value 'DEBUG' of option --set, expected KEY=VALUE" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+const workspaceConfigForLiteralOverrides = `
+name: ensi
+variables:
+  DB_HOST: localhost
+  DB_URL: ${DB_HOST}:5432
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+    variables:
+      DB_HOST: svc-localhost
+      DB_DSN: pgsql:${DB_HOST}
+`
+
+func TestServiceVarsOverridesLiteral(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigForLiteralOverrides, "")
+
+	gomock.InOrder(
+		mockPC.EXPECT().Println("WORKSPACE_PATH=/tmp/workspaces/project1"),
+		mockPC.EXPECT().Println("WORKSPACE_NAME=ensi"),
+		mockPC.EXPECT().Println("DB_URL=db:5432"),
+		mockPC.EXPECT().Println("APP_NAME=test"),
+		mockPC.EXPECT().Println("COMPOSE_PROJECT_NAME=ensi-test"),
+		mockPC.EXPECT().Println("SVC_PATH=/tmp/workspaces/project1/apps/test"),
+		mockPC.EXPECT().Println("COMPOSE_FILE=/tmp/workspaces/project1/apps/test/docker-compose.yml"),
+		mockPC.EXPECT().Println("DB_DSN=pgsql:db"),
+		mockPC.EXPECT().Println("DB_HOST=db"),
+	)
+
+	err := CmdServiceVars(fakeHomeConfigPath, []string{"--set", "DB_HOST=db"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPaths(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	configPath := path.Join(fakeWorkspacePath, "workspace.yaml")
+
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().Getwd().Return(path.Join(fakeWorkspacePath, "apps/test/src"), nil)
+	mockPC.EXPECT().FileExists(configPath).Return(true).Times(2)
+	mockPC.EXPECT().ReadFile(configPath).Return([]byte(workspaceConfigWithDeps), nil)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "env.yaml")).Return(false)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, ".env")).Return(false)
+
+	gomock.InOrder(
+		mockPC.EXPECT().Printf("%-18s %s\n", "home config:", fakeHomeConfigPath),
+		mockPC.EXPECT().Printf("%-18s %s (%s)\n", "workspace:", "project1", fakeWorkspacePath),
+		mockPC.EXPECT().Printf("%-18s %s\n", "workspace config:", configPath),
+		mockPC.EXPECT().Printf("%-18s %s\n", "cwd:", path.Join(fakeWorkspacePath, "apps/test/src")),
+		mockPC.EXPECT().Printf("%-18s %s\n", "service:", "test"),
+	)
+
+	_ = CmdPaths(fakeHomeConfigPath, []string{})
+}
+
+func TestCreateServices(t *testing.T) {
+	cfg := NewConfig(fakeWorkspacePath, fakeWorkspacePath)
+	cfg.Services["dep1"] = ServiceConfig{}
+	cfg.Services["dep2"] = ServiceConfig{}
+	cfg.Services["test"] = ServiceConfig{}
+
+	services, err := createServices(cfg, []string{"test", "dep1", "dep2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"test", "dep1", "dep2"} {
+		if services[i].Name != name {
+			t.Errorf("expected service %s at position %d, got %s", name, i, services[i].Name)
+		}
+	}
+
+	_, err = createServices(cfg, []string{"test", "unknown"})
+	if err == nil {
+		t.Errorf("expected error for unknown service")
+	}
+}
+
+const workspaceConfigWithNestedDeps = `
+name: ensi
+services:
+  dep1:
+    path: "${WORKSPACE_PATH}/apps/dep1"
+    dependencies:
+      dep3: [hook]
+  dep2:
+    path: "${WORKSPACE_PATH}/apps/dep2"
+  dep3:
+    path: "${WORKSPACE_PATH}/apps/dep3"
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+    dependencies:
+      dep1: [default, hook]
+      dep2: [extra]
+`
+
+func TestServiceStartNestedModes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// default mode is not inherited by dep3
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithNestedDeps, "")
+
+	gomock.InOrder(
+		expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml")),
+		expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")),
+	)
+
+	expectStartProgress(mockPC, "[1/2] starting service test", "[2/2] starting service dep1")
+	_ = CmdServiceStart(fakeHomeConfigPath, []string{})
+
+	// hook mode is inherited by dep3
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithNestedDeps, "")
+
+	gomock.InOrder(
+		expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep3/docker-compose.yml")),
+		expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml")),
+		expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")),
+	)
+
+	expectStartProgress(mockPC, "[1/3] starting service test", "[2/3] starting service dep1", "[3/3] starting service dep3")
+	_ = CmdServiceStart(fakeHomeConfigPath, []string{"--mode=hook"})
+
+	// several modes
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithNestedDeps, "")
+
+	gomock.InOrder(
+		expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep3/docker-compose.yml")),
+		expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml")),
+		expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml")),
+		expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")),
+	)
+
+	expectStartProgress(mockPC, "[1/4] starting service test", "[2/4] starting service dep1", "[3/4] starting service dep3", "[4/4] starting service dep2")
+	_ = CmdServiceStart(fakeHomeConfigPath, []string{"--mode=hook,extra"})
+}
+
+const homeConfigWithPushed = `current_workspace: project1
+update_command: update
+pushed_workspaces:
+- project2
+workspaces:
+- name: project1
+  path: /tmp/workspaces/project1
+- name: project2
+  path: /tmp/workspaces/project2
+`
+
+func TestWorkspacePushPop(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, []byte(homeConfigWithPushed), os.FileMode(0600))
+	mockPC.EXPECT().Printf("workspace '%s' pushed\n", "project2")
+
+	_ = CmdWorkspacePush(fakeHomeConfigPath, []string{"project2"})
+
+	// unknown
+	expectReadHomeConfig(mockPC)
+
+	err := CmdWorkspacePush(fakeHomeConfigPath, []string{"project3"})
+	if err == nil || err.Error() != "workspace with name 'project3' is not defined" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// pop
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return([]byte(homeConfigWithPushed), nil)
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, []byte(homeConfigForPop), os.FileMode(0600))
+	mockPC.EXPECT().Printf("workspace '%s' popped\n", "project2")
+
+	_ = CmdWorkspacePop(fakeHomeConfigPath, []string{})
+
+	// nothing to pop
+	expectReadHomeConfig(mockPC)
+
+	err = CmdWorkspacePop(fakeHomeConfigPath, []string{})
+	if err == nil || err.Error() != "there are no pushed workspaces" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+const homeConfigForPop = `current_workspace: project1
+update_command: update
+workspaces:
+- name: project1
+  path: /tmp/workspaces/project1
+- name: project2
+  path: /tmp/workspaces/project2
+`
+
+const workspaceConfigOfProject2 = `
+name: other
+services:
+  api:
+    path: "${WORKSPACE_PATH}/apps/api"
+  worker:
+    path: "${WORKSPACE_PATH}/apps/worker"
+`
+
+func TestServiceStartFromPushedWorkspace(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	project2Path := "/tmp/workspaces/project2"
+
+	expectReadConfigsWithPushed(mockPC, workspaceConfig)
+	expectStartService(mockPC, path.Join(project2Path, "apps/api/docker-compose.yml"))
+
+	err := CmdServiceStart(fakeHomeConfigPath, []string{"api"})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// expectReadConfigsWithPushed expects reading of current workspace config and of config of pushed workspace project2.
+func expectReadConfigsWithPushed(mockPC *MockPC, config string) {
+	project2Path := "/tmp/workspaces/project2"
+
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return([]byte(homeConfigWithPushed), nil)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, config, "")
+	mockPC.EXPECT().FileExists(path.Join(project2Path, "workspace.yaml")).Return(true)
+	mockPC.EXPECT().ReadFile(path.Join(project2Path, "workspace.yaml")).Return([]byte(workspaceConfigOfProject2), nil)
+	mockPC.EXPECT().FileExists(path.Join(project2Path, "env.yaml")).Return(false)
+	mockPC.EXPECT().FileExists(path.Join(project2Path, ".env")).Return(false)
+}
+
+func TestStackedConfigLookups(t *testing.T) {
+	cwd := "/tmp/workspaces/project2/apps/api/src"
+	cfg := NewConfig(fakeWorkspacePath, cwd)
+	cfg.Services["test"] = ServiceConfig{
+		TemplateConfig: TemplateConfig{Path: "${WORKSPACE_PATH}/apps/test"},
+		Dependencies:   map[string][]string{"api": {"default"}},
+	}
+	stacked := NewConfig("/tmp/workspaces/project2", cwd)
+	stacked.Services["api"] = ServiceConfig{
+		TemplateConfig: TemplateConfig{Path: "${WORKSPACE_PATH}/apps/api"},
+		Dependencies:   map[string][]string{"db": {"default"}},
+	}
+	stacked.Services["db"] = ServiceConfig{TemplateConfig: TemplateConfig{Path: "${WORKSPACE_PATH}/apps/db"}}
+	stacked.runOptions = cfg.runOptions
+	cfg.Stacked = append(cfg.Stacked, stacked)
+
+	svcName, err := cfg.FindServiceByPath()
+	if err != nil || svcName != "api" {
+		t.Errorf("expected service api of pushed workspace, got %s, %v", svcName, err)
+	}
+
+	sorted := cfg.SortByDependencies([]string{"test", "api", "db"})
+	if strings.Join(sorted, ",") != "db,api,test" {
+		t.Errorf("dependencies of pushed workspace are not sorted: %v", sorted)
+	}
+
+	cfg.PrintCmd = true
+	cfg.Overrides = Context{{"APP_DEBUG", "true"}}
+	owner := cfg.findServiceOwner("api")
+	if owner != stacked || !owner.PrintCmd || len(owner.Overrides) != 1 {
+		t.Errorf("options of run are not passed to pushed workspace")
+	}
+
+	owner.WillStart = append(owner.WillStart, "api")
+	if !contains(cfg.WillStart, "api") {
+		t.Errorf("services started by pushed workspace are not shared with current one")
+	}
+}
+
+// TestServiceStopParallelWithPushedWorkspace is meant to be run with -race too,
+// services of pushed workspace are created by several goroutines at once.
+func TestServiceStopParallelWithPushedWorkspace(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadConfigsWithPushed(mockPC, workspaceConfig)
+	expectRunningProjects(mockPC, "ensi-test\nother-api\nother-worker\n")
+	expectStopService(mockPC, "/tmp/workspaces/project2/apps/api/docker-compose.yml")
+	expectStopService(mockPC, "/tmp/workspaces/project2/apps/worker/docker-compose.yml")
+	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+	expectBatchReport(mockPC, "api", "done", "test", "done", "worker", "done")
+
+	err := CmdServiceStop(fakeHomeConfigPath, []string{"--all", "--parallel=3"})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServiceStopAllWithPushedWorkspace(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadConfigsWithPushed(mockPC, workspaceConfig)
+	expectRunningProjects(mockPC, "ensi-test\nother-api\n")
+	expectStopService(mockPC, "/tmp/workspaces/project2/apps/api/docker-compose.yml")
+	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+	expectBatchReport(mockPC, "api", "done", "test", "done")
+
+	err := CmdServiceStop(fakeHomeConfigPath, []string{"--all"})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServiceLogs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// current
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"), "logs", "--follow"}, gomock.Any()).
+		Return(0, nil)
+
+	_ = CmdServiceLogs(fakeHomeConfigPath, []string{"-f"})
+
+	// time window
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"), "logs", "--since", "1h", "--until", "2022-01-02T13:23:37Z"}, gomock.Any()).
+		Return(0, nil)
+
+	_ = CmdServiceLogs(fakeHomeConfigPath, []string{"--since=1h", "--until=2022-01-02T13:23:37Z"})
+
+	// tail
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"), "logs", "--tail", "100"}, gomock.Any()).
+		Return(0, nil)
+
+	_ = CmdServiceLogs(fakeHomeConfigPath, []string{"--tail=100"})
+
+	err := CmdServiceLogs(fakeHomeConfigPath, []string{"--tail=many"})
+	if err == nil || err.Error() != "invalid value 'many' of option --tail, expected number or 'all'" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// several
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	mockPC.EXPECT().
+		ExecWithPrefix([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"), "logs"}, gomock.Any(), Color("dep1 |", CCyan)+" ").
+		Return(0, nil)
+	mockPC.EXPECT().
+		ExecWithPrefix([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"), "logs"}, gomock.Any(), Color("test |", CYellow)+" ").
+		Return(0, nil)
+
+	err = CmdServiceLogs(fakeHomeConfigPath, []string{"dep1", "test"})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServiceStartWithPodman(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	composeFilePath := path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")
+
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(fakeWorkspacePath).Return(true)
+	mockPC.EXPECT().Getwd().Return(path.Join(fakeWorkspacePath, "apps/test"), nil)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "workspace.yaml")).Return(true)
+	mockPC.EXPECT().ReadFile(path.Join(fakeWorkspacePath, "workspace.yaml")).Return([]byte(workspaceConfig), nil)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "env.yaml")).Return(false)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, ".env")).Return(false)
+	mockPC.EXPECT().LookupEnv("ELC_COMPOSE_ENGINE").Return("podman", true)
+	mockPC.EXPECT().LookupEnv("ELC_MODE").Return("", false)
+
+	mockPC.EXPECT().
+		ExecToString([]string{"podman-compose", "-f", composeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "", nil)
+	mockPC.EXPECT().
+		ExecToString([]string{"podman-compose", "-f", composeFilePath, "config"}, gomock.Any()).
+		Return(0, "services: {}", nil)
+	mockPC.EXPECT().
+		ExecInteractive([]string{"podman-compose", "-f", composeFilePath, "up", "-d"}, gomock.Any()).
+		Return(0, nil)
+
+	err := CmdServiceStart(fakeHomeConfigPath, []string{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// unknown engine
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(fakeWorkspacePath).Return(true)
+	mockPC.EXPECT().Getwd().Return(path.Join(fakeWorkspacePath, "apps/test"), nil)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "workspace.yaml")).Return(true)
+	mockPC.EXPECT().ReadFile(path.Join(fakeWorkspacePath, "workspace.yaml")).Return([]byte(workspaceConfig), nil)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "env.yaml")).Return(false)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, ".env")).Return(false)
+	mockPC.EXPECT().LookupEnv("ELC_COMPOSE_ENGINE").Return("rkt", true)
+
+	err = CmdServiceStart(fakeHomeConfigPath, []string{})
+	if err == nil || err.Error() != "unknown compose engine 'rkt', use one of: docker, podman" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPlugin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	mockPC.EXPECT().LookPath("elc-foo").Return("/usr/local/bin/elc-foo", nil)
+	mockPC.EXPECT().LookPath("elc-composer").Return("", errors.New("not found"))
+
+	pluginPath, found := FindPlugin("foo")
+	if !found || pluginPath != "/usr/local/bin/elc-foo" {
+		t.Errorf("plugin is not found: %s", pluginPath)
+	}
+	if _, found = FindPlugin("composer"); found {
+		t.Errorf("unexpected plugin")
+	}
+	if _, found = FindPlugin("--svc=test"); found {
+		t.Errorf("option is treated as plugin")
+	}
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfig, "")
+	mockPC.EXPECT().Environ().Return([]string{"PATH=/usr/bin"})
+	mockPC.EXPECT().
+		ExecInteractive([]string{"/usr/local/bin/elc-foo", "bar"}, gomock.Any()).
+		DoAndReturn(func(command []string, env []string) (int, error) {
+			for _, expected := range []string{
+				"ELC_HOME_CONFIG=" + fakeHomeConfigPath,
+				"ELC_WORKSPACE_NAME=ensi",
+				"ELC_WORKSPACE_PATH=" + fakeWorkspacePath,
+				"ELC_SERVICE=test",
+			} {
+				if !contains(env, expected) {
+					t.Errorf("variable %s is not passed to plugin", expected)
+				}
+			}
+			return 3, nil
+		})
+
+	code, err := CmdPlugin(fakeHomeConfigPath, "/usr/local/bin/elc-foo", []string{"bar"})
+	if err != nil || code != 3 {
+		t.Errorf("unexpected result %d, %v", code, err)
+	}
+}
+
+func TestExecLog(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	logDir, err := ioutil.TempDir("", "elc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(logDir)
+	logFile := path.Join(logDir, "elc.log")
+
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return([]byte(baseHomeConfig+"log_file: "+logFile+"\n"), nil)
+	mockPC.EXPECT().HomeDir().Return("/tmp/home", nil)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfig, "")
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+
+	err = CmdServiceStart(fakeHomeConfigPath, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var record execLogRecord
+	err = json.Unmarshal(data, &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"), "up", "-d"}
+	if fmt.Sprint(record.Command) != fmt.Sprint(expected) || record.Code != 0 || record.Time == "" {
+		t.Errorf("unexpected record: %s", data)
+	}
+}
+
+func TestServiceComposePrintCmd(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfig, "")
+
+	composeFile := path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")
+	mockPC.EXPECT().Println("WORKSPACE_PATH=/tmp/workspaces/project1 WORKSPACE_NAME=ensi APP_NAME=test COMPOSE_PROJECT_NAME=ensi-test " +
+		"SVC_PATH=/tmp/workspaces/project1/apps/test COMPOSE_FILE=" + composeFile + " docker compose -f " + composeFile + " run app 'echo $HOME'")
+
+	_, err := CmdServiceCompose(fakeHomeConfigPath, []string{"--print-cmd", "run", "app", "echo $HOME"})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServiceComposePrintCmdSecrets(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	composeFile := path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")
+	expectCommand := func(password string) {
+		expectReadHomeConfig(mockPC)
+		expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithSecretVars, "")
+		mockPC.EXPECT().Println("WORKSPACE_PATH=/tmp/workspaces/project1 WORKSPACE_NAME=ensi APP_NAME=test COMPOSE_PROJECT_NAME=ensi-test " +
+			"SVC_PATH=/tmp/workspaces/project1/apps/test COMPOSE_FILE=" + composeFile + " DB_PASSWORD=" + password + " DB_USER=user " +
+			"docker compose -f " + composeFile + " ps")
+	}
+
+	// masked
+	expectCommand("'****'")
+
+	_, err := CmdServiceCompose(fakeHomeConfigPath, []string{"--print-cmd", "ps"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// shown
+	expectCommand("qwerty")
+
+	_, err = CmdServiceCompose(fakeHomeConfigPath, []string{"--print-cmd", "--show-secrets", "ps"})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckForUpdate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	cachePath := "/tmp/home/.elc-update-check.yaml"
+	homeConfig := []byte(baseHomeConfig + "update_check: true\n")
+
+	// disabled with variable
+	mockPC.EXPECT().LookupEnv("ELC_NO_UPDATE_CHECK").Return("1", true)
+
+	notice, err := checkForUpdate(mockPC, fakeHomeConfigPath)
+	if err != nil || notice != "" {
+		t.Errorf("unexpected result %s, %v", notice, err)
+	}
+
+	// new version from github
+	mockPC.EXPECT().LookupEnv("ELC_NO_UPDATE_CHECK").Return("", false)
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return(homeConfig, nil)
+	mockPC.EXPECT().FileExists(cachePath).Return(false)
+	mockPC.EXPECT().HttpGet(latestReleaseURL).Return([]byte(`{"tag_name": "v9.9.9"}`), nil)
+	mockPC.EXPECT().WriteFile(cachePath, gomock.Any(), os.FileMode(0644))
+
+	notice, err = checkForUpdate(mockPC, fakeHomeConfigPath)
+	if err != nil || notice != "New version of elc 9.9.9 is available, current version is "+Version+". Run 'elc update' to install it." {
+		t.Errorf("unexpected result %s, %v", notice, err)
+	}
+
+	// fresh cache
+	cache := fmt.Sprintf("checked_at: %s\nlatest_version: %s\n", time.Now().Format(time.RFC3339), Version)
+	mockPC.EXPECT().LookupEnv("ELC_NO_UPDATE_CHECK").Return("", false)
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return(homeConfig, nil)
+	mockPC.EXPECT().FileExists(cachePath).Return(true)
+	mockPC.EXPECT().ReadFile(cachePath).Return([]byte(cache), nil)
+
+	notice, err = checkForUpdate(mockPC, fakeHomeConfigPath)
+	if err != nil || notice != "" {
+		t.Errorf("unexpected result %s, %v", notice, err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().ExecInteractive([]string{"bash", "-c", "update"}, []string{"ELC_UPDATE_CHANNEL=stable"}).Return(0, nil)
+
+	_ = CmdUpdate(fakeHomeConfigPath, []string{})
+
+	// with checksum
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().ExecInteractive([]string{"bash", "-c", "update"}, []string{"ELC_UPDATE_CHANNEL=stable", "ELC_EXPECTED_SHA256=abc123"}).Return(1, nil)
+
+	err := CmdUpdate(fakeHomeConfigPath, []string{"--sha256=ABC123"})
+	if err == nil || err.Error() != "update command failed with code 1" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// channel
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return([]byte(`
+update_command: get.sh --channel=${UPDATE_CHANNEL}
+update_channel: beta
+`), nil)
+	mockPC.EXPECT().ExecInteractive([]string{"bash", "-c", "get.sh --channel=beta"}, []string{"ELC_UPDATE_CHANNEL=beta"}).Return(0, nil)
+
+	_ = CmdUpdate(fakeHomeConfigPath, []string{})
+
+	expectReadHomeConfig(mockPC)
+
+	err = CmdUpdate(fakeHomeConfigPath, []string{"--channel=nightly"})
+	if err == nil || err.Error() != "unknown update channel 'nightly', use one of: stable, beta" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// legacy default command is migrated
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return([]byte("update_command: "+legacyUpdateCommand+"\n"), nil)
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, gomock.Any(), os.FileMode(0600)).
+		DoAndReturn(func(_ string, data []byte, _ os.FileMode) error {
+			if !strings.Contains(string(data), "--preserve-env") {
+				t.Errorf("update_command is not migrated: %s", data)
+			}
+			return nil
+		})
+	mockPC.EXPECT().Printf("update_command in home config is changed to pass checksum and channel through sudo\n")
+	mockPC.EXPECT().
+		ExecInteractive([]string{"bash", "-c", defaultUpdateCommand}, []string{"ELC_UPDATE_CHANNEL=beta"}).
+		Return(0, nil)
+
+	err = CmdUpdate(fakeHomeConfigPath, []string{"--channel=beta"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// custom command with sudo loses variables
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return([]byte("update_command: curl -sSL get.sh | sudo bash\n"), nil)
+
+	err = CmdUpdate(fakeHomeConfigPath, []string{"--sha256=abc"})
+	if err == nil || !strings.Contains(err.Error(), "checksum would not be checked") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+const workspaceConfigForRename = `name: ensi
+aliases:
+  t: test
+services:
+  dep1:
+    path: ${WORKSPACE_PATH}/apps/dep1
+  test:
+    path: ${WORKSPACE_PATH}/apps/test
+    dependencies:
+      dep1: [default]
+modules:
+  mdl1:
+    path: ${WORKSPACE_PATH}/apps/test/mdl1
+    hosted_in: test
+`
+
+const renamedWorkspaceConfig = `name: ensi
+aliases:
+  t: app
+services:
+  dep1:
+    path: ${WORKSPACE_PATH}/apps/dep1
+  app:
+    path: ${WORKSPACE_PATH}/apps/test
+    dependencies:
+      dep1:
+      - default
+modules:
+  mdl1:
+    path: ${WORKSPACE_PATH}/apps/test/mdl1
+    hosted_in: app
+`
+
+func TestServiceRename(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	configPath := path.Join(fakeWorkspacePath, "workspace.yaml")
+
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(configPath).Return(true)
+	mockPC.EXPECT().ReadFile(configPath).Return([]byte(workspaceConfigForRename), nil)
+	mockPC.EXPECT().WriteFile(configPath, []byte(renamedWorkspaceConfig), os.FileMode(0644))
+	mockPC.EXPECT().Printf("service %s renamed to %s\n", "test", "app")
+
+	err := CmdServiceRename(fakeHomeConfigPath, []string{"test", "app"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// dependency renamed
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(configPath).Return(true)
+	mockPC.EXPECT().ReadFile(configPath).Return([]byte(workspaceConfigForRename), nil)
+	mockPC.EXPECT().WriteFile(configPath, gomock.Any(), os.FileMode(0644)).
+		DoAndReturn(func(filename string, data []byte, perm os.FileMode) error {
+			if !strings.Contains(string(data), "    dependencies:\n      base:\n") {
+				t.Errorf("dependency is not renamed:\n%s", data)
+			}
+			return nil
+		})
+	mockPC.EXPECT().Printf("service %s renamed to %s\n", "dep1", "base")
+
+	_ = CmdServiceRename(fakeHomeConfigPath, []string{"dep1", "base"})
+
+	// name is taken
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(configPath).Return(true)
+	mockPC.EXPECT().ReadFile(configPath).Return([]byte(workspaceConfigForRename), nil)
+
+	err = CmdServiceRename(fakeHomeConfigPath, []string{"test", "dep1"})
+	if err == nil || err.Error() != "service dep1 already exists" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestModuleAdd(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	configPath := path.Join(fakeWorkspacePath, "workspace.yaml")
+
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(configPath).Return(true)
+	mockPC.EXPECT().ReadFile(configPath).Return([]byte(workspaceConfig), nil)
+	mockPC.EXPECT().WriteFile(configPath, []byte(`name: ensi
+services:
+  test:
+    path: ${WORKSPACE_PATH}/apps/test
+modules:
+  mdl1:
+    hosted_in: test
+    exec_path: /var/www/mdl1
+`), os.FileMode(0644))
+	mockPC.EXPECT().Printf("module %s added to service %s\n", "mdl1", "test")
+
+	err := CmdModuleAdd(fakeHomeConfigPath, []string{"mdl1", "--hosted-in=test", "--exec-path=/var/www/mdl1"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// unknown service
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(configPath).Return(true)
+	mockPC.EXPECT().ReadFile(configPath).Return([]byte(workspaceConfig), nil)
+
+	err = CmdModuleAdd(fakeHomeConfigPath, []string{"mdl1", "--hosted-in=api"})
+	if err == nil || err.Error() != "service api is not found in workspace config" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// existing module
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(configPath).Return(true)
+	mockPC.EXPECT().ReadFile(configPath).Return([]byte(workspaceConfigForRename), nil)
+
+	err = CmdModuleAdd(fakeHomeConfigPath, []string{"mdl1", "--hosted-in=test"})
+	if err == nil || err.Error() != "module mdl1 already exists" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestModuleExec(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	mockPC.EXPECT().Getuid().Return(1000)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithExecPaths, "")
+
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"))
+	mockPC.EXPECT().IsTerminal().Return(true)
+	expectTerminalTitle(mockPC, "elc: ensi/dep1")
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"), "exec", "-w", "/var/www/mdl1", "-u", "0", "app", "composer", "install"}, gomock.Any()).
+		Return(0, nil)
+
+	_, err := CmdModuleExec(fakeHomeConfigPath, []string{"mdl1", "--uid=0", "composer", "install"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// unknown module
+	mockPC.EXPECT().Getuid().Return(1000)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithExecPaths, "")
+
+	_, err = CmdModuleExec(fakeHomeConfigPath, []string{"test", "ls"})
+	if err == nil || err.Error() != "module test not found" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+const workspaceConfigWithBrokenModules = `
+name: ensi
+aliases:
+  t: test
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+modules:
+  mdl1:
+    hosted_in: t
+  mdl2:
+    hosted_in: api
+  mdl3:
+    hosted_in: web
+`
+
+func TestConfigValidate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithExecPaths, "")
+	mockPC.EXPECT().Printf("config is valid\n")
+
+	err := CmdConfigValidate(fakeHomeConfigPath, []string{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithBrokenModules, "")
+
+	err = CmdConfigValidate(fakeHomeConfigPath, []string{})
+	expected := "config of workspace is invalid:\n  module mdl2 is hosted in unknown service api\n  module mdl3 is hosted in unknown service web"
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServiceExecWithMode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	testComposeFile := path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")
+	dep2ComposeFile := path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml")
+	expectRunning := func(composeFile string, running bool) {
+		out := ""
+		if running {
+			out = "asdasd"
+		}
+		mockPC.EXPECT().
+			ExecToString([]string{"docker", "compose", "-f", composeFile, "ps", "--status=running", "-q"}, gomock.Any()).
+			Return(0, out, nil)
+	}
+	expectExec := func() {
+		mockPC.EXPECT().IsTerminal().Return(false)
+		mockPC.EXPECT().
+			ExecInteractive([]string{"docker", "compose", "-f", testComposeFile, "exec", "-u", "1000", "-T", "app", "ls"}, gomock.Any()).
+			Return(0, nil)
+	}
+
+	// running service without mode, dependencies are not checked
+	mockPC.EXPECT().Getuid().Return(1000)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	expectRunning(testComposeFile, true)
+	expectExec()
+
+	_, _ = CmdServiceExec(fakeHomeConfigPath, []string{"ls"})
+
+	// running service with mode, missing dependency is started
+	mockPC.EXPECT().Getuid().Return(1000)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	expectRunning(testComposeFile, true)
+	expectStartService(mockPC, dep2ComposeFile)
+	expectExec()
+
+	expectStartProgress(mockPC, "[2/2] starting service dep2")
+	_, _ = CmdServiceExec(fakeHomeConfigPath, []string{"--mode=hook", "ls"})
+
+	// running service with mode, running dependency is kept
+	mockPC.EXPECT().Getuid().Return(1000)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	expectRunning(testComposeFile, true)
+	expectRunning(dep2ComposeFile, true)
+	expectExec()
+
+	_, _ = CmdServiceExec(fakeHomeConfigPath, []string{"--mode=hook", "ls"})
+}
+
+func TestPrune(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	label := "label=com.docker.compose.project=ensi-test"
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfig, "")
+	gomock.InOrder(
+		mockPC.EXPECT().ExecInteractive([]string{"docker", "container", "prune", "-f", "--filter", label}, gomock.Any()).Return(0, nil),
+		mockPC.EXPECT().ExecInteractive([]string{"docker", "network", "prune", "-f", "--filter", label}, gomock.Any()).Return(0, nil),
+	)
+
+	_ = CmdPrune(fakeHomeConfigPath, []string{})
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfig, "")
+	gomock.InOrder(
+		mockPC.EXPECT().ExecInteractive([]string{"docker", "container", "prune", "-f", "--filter", label}, gomock.Any()).Return(0, nil),
+		mockPC.EXPECT().ExecInteractive([]string{"docker", "network", "prune", "-f", "--filter", label}, gomock.Any()).Return(0, nil),
+		mockPC.EXPECT().ExecInteractive([]string{"docker", "volume", "prune", "-f", "--filter", label}, gomock.Any()).Return(0, nil),
+		mockPC.EXPECT().ExecInteractive([]string{"docker", "image", "prune", "-a", "-f", "--filter", label}, gomock.Any()).Return(0, nil),
+	)
+
+	_ = CmdPrune(fakeHomeConfigPath, []string{"--volumes", "--images"})
+}
+
+func TestColorTheme(t *testing.T) {
+	defer func() { _ = setColorTheme("default", nil) }()
+
+	if Color("text", CHighlight) != CYellow+"text"+CReset {
+		t.Errorf("default theme must highlight with yellow")
+	}
+
+	_ = setColorTheme("light", nil)
+	if Color("text", CHighlight) != CBlue+"text"+CReset {
+		t.Errorf("light theme must highlight with blue")
+	}
+
+	_ = setColorTheme("plain", nil)
+	if Color("text", CError) != "text" || Color("text", CCyan) != "text" {
+		t.Errorf("plain theme must disable colors")
+	}
+
+	_ = setColorTheme("", map[string]string{"highlight": "green", "error": "none"})
+	if Color("text", CHighlight) != CGreen+"text"+CReset || Color("text", CError) != "text" {
+		t.Errorf("colors must be overridden by home config")
+	}
+
+	if setColorTheme("dark", nil) == nil {
+		t.Errorf("unknown theme must be reported")
+	}
+	if setColorTheme("", map[string]string{"highlight": "pink"}) == nil {
+		t.Errorf("unknown color must be reported")
+	}
+	if setColorTheme("", map[string]string{"yellow": "blue"}) == nil {
+		t.Errorf("unknown role must be reported")
+	}
+}
+
+func TestLoadColorTheme(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	defer func() { _ = setColorTheme("default", nil) }()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// home config is read once for theme and command
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true).Times(2)
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return([]byte("color_theme: light\n"), nil)
+
+	err := LoadColorTheme(fakeHomeConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Color("text", CHighlight) != CBlue+"text"+CReset {
+		t.Errorf("theme from home config is not applied")
+	}
+	hc, err := checkAndLoadHC(fakeHomeConfigPath)
+	if err != nil || hc.ColorTheme != "light" {
+		t.Errorf("preloaded home config is not used: %v", err)
+	}
+
+	// invalid home config is reported only by command
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return([]byte("workspaces: {"), nil)
+
+	err = LoadColorTheme(fakeHomeConfigPath)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServiceStartProgress(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// terminal
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"))
+	mockPC.EXPECT().IsTerminal().Return(true)
+	gomock.InOrder(
+		mockPC.EXPECT().Printf("\r\033[K%s", "[1/2] starting service test"),
+		mockPC.EXPECT().Printf("\r\033[K%s", "[2/2] starting service dep2"),
+		mockPC.EXPECT().Printf("\n"),
+	)
+
+	_ = CmdServiceStart(fakeHomeConfigPath, []string{"--mode=hook"})
+
+	// quiet
+	Globals.Quiet = true
+	defer func() { Globals.Quiet = false }()
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"))
+	expectStartService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"))
+
+	_ = CmdServiceStart(fakeHomeConfigPath, []string{"--mode=hook"})
+}
+
+func TestServiceRestartRolling(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	waitForInterval = time.Millisecond
+	defer func() { waitForInterval = time.Second }()
+
+	expectInspect := func(container string, status string) *gomock.Call {
+		return mockPC.EXPECT().
+			ExecToString([]string{"docker", "inspect", "-f", containerStatusFormat, container}, gomock.Any()).
+			Return(0, status+"\n", nil)
+	}
+
+	// containers are restarted one by one
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfig, "")
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml"), "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "c1\nc2\n", nil)
+	gomock.InOrder(
+		mockPC.EXPECT().ExecInteractive([]string{"docker", "restart", "c1"}, gomock.Any()).Return(0, nil),
+		expectInspect("c1", "starting"),
+		expectInspect("c1", "healthy"),
+		mockPC.EXPECT().ExecInteractive([]string{"docker", "restart", "c2"}, gomock.Any()).Return(0, nil),
+		expectInspect("c2", "running"),
+	)
+
+	err := CmdServiceRestart(fakeHomeConfigPath, []string{"--rolling"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// incompatible options
+	err = CmdServiceRestart(fakeHomeConfigPath, []string{"--rolling", "--hard"})
+	if err == nil || err.Error() != "options --rolling and --hard can not be used together" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServiceVarsAll(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	var out string
+	mockPC.EXPECT().Println(gomock.Any()).DoAndReturn(func(a ...interface{}) (int, error) {
+		out = a[0].(string)
+		return 0, nil
+	})
+
+	err := CmdServiceVars(fakeHomeConfigPath, []string{"--all", "--format=json"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	result := make(map[string]map[string]string)
+	err = json.Unmarshal([]byte(out), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 4 {
+		t.Errorf("unexpected number of services: %d", len(result))
+	}
+	if result["dep1"]["APP_NAME"] != "dep1" || result["test"]["SVC_PATH"] != path.Join(fakeWorkspacePath, "apps/test") {
+		t.Errorf("unexpected variables: %v", result)
+	}
+}
+
+const homeConfigWithCustomConfig = `current_workspace: project1
+update_command: update
+workspaces:
+- name: project1
+  path: /tmp/workspaces/project1
+  config: custom.yaml
+`
+
+func TestWorkspaceCustomConfig(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	customConfigPath := path.Join(fakeWorkspacePath, "custom.yaml")
+	expectReadCustomHomeConfig := func() {
+		mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+		mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return([]byte(homeConfigWithCustomConfig), nil)
+		mockPC.EXPECT().FileExists(fakeWorkspacePath).Return(true)
+		mockPC.EXPECT().Getwd().Return(path.Join(fakeWorkspacePath, "apps/test"), nil)
+	}
+
+	// config is read from custom file
+	expectReadCustomHomeConfig()
+	mockPC.EXPECT().FileExists(customConfigPath).Return(true)
+	mockPC.EXPECT().ReadFile(customConfigPath).Return([]byte(workspaceConfig), nil)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "env.yaml")).Return(false)
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, ".env")).Return(false)
+	mockPC.EXPECT().LookupEnv("ELC_COMPOSE_ENGINE").Return("", false)
+	mockPC.EXPECT().LookupEnv("ELC_MODE").Return("", false)
+
+	cfg, err := getWorkspaceConfig(fakeHomeConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "ensi" {
+		t.Errorf("unexpected name of workspace: %s", cfg.Name)
+	}
+
+	// custom file is not found
+	expectReadCustomHomeConfig()
+	mockPC.EXPECT().FileExists(customConfigPath).Return(false)
+
+	_, err = getWorkspaceConfig(fakeHomeConfigPath)
+	if err == nil || err.Error() != "config of workspace is not found at /tmp/workspaces/project1/custom.yaml" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// workspace is registered with custom config
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, []byte(homeConfigForAdd+"  config: custom.yaml\n"), os.FileMode(0600))
+	mockPC.EXPECT().Printf("workspace '%s' is added\n", "project3")
+
+	_ = CmdWorkspaceAdd(fakeHomeConfigPath, []string{"--config=custom.yaml", "project3", "/tmp/workspaces/project3"})
+}
+
+func TestConfigEdit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	configPath := path.Join(fakeWorkspacePath, "workspace.yaml")
+
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(configPath).Return(true)
+	mockPC.EXPECT().LookupEnv("EDITOR").Return("code -w", true)
+	mockPC.EXPECT().ExecInteractive([]string{"code", "-w", configPath}, gomock.Any()).Return(0, nil)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithExecPaths+"  mdl2:\n    hosted_in: unknown\n", "")
+
+	err := CmdConfigEdit(fakeHomeConfigPath, []string{})
+	if err == nil || err.Error() != "config of workspace is invalid:\n  module mdl2 is hosted in unknown service unknown" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWorkspaceShowVerbose(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "workspace.yaml")).Return(true)
+	gomock.InOrder(
+		mockPC.EXPECT().Printf("%-10s %s\n", "name:", "project1"),
+		mockPC.EXPECT().Printf("%-10s %s\n", "path:", fakeWorkspacePath),
+		mockPC.EXPECT().Printf("%-10s %s\n", "config:", path.Join(fakeWorkspacePath, "workspace.yaml")),
+		mockPC.EXPECT().Printf("%-10s %d\n", "services:", 4),
+	)
+
+	_ = CmdWorkspaceShow(fakeHomeConfigPath, []string{"--verbose"})
+}
+
+const workspaceConfigWithExecPathBases = `
+name: ensi
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+    exec_path: /var/www
+  dep1:
+    path: "${WORKSPACE_PATH}/apps/dep1"
+modules:
+  container:
+    path: "${WORKSPACE_PATH}/modules/container"
+    hosted_in: test
+    exec_path: /opt/container
+  service:
+    path: "${WORKSPACE_PATH}/apps/test/packages/service"
+    hosted_in: test
+    exec_path: packages/service
+    exec_path_base: service
+  module:
+    path: "${WORKSPACE_PATH}/apps/test/packages/nested/module"
+    hosted_in: test
+    exec_path: src
+    exec_path_base: module
+  outside:
+    path: "${WORKSPACE_PATH}/modules/outside"
+    hosted_in: test
+    exec_path_base: module
+  no-service-path:
+    path: "${WORKSPACE_PATH}/apps/dep1/module"
+    hosted_in: dep1
+    exec_path: src
+    exec_path_base: service
+`
+
+func TestModuleExecPathBase(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithExecPathBases, "")
+
+	cfg, err := getWorkspaceConfig(fakeHomeConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		module     string
+		workingDir string
+		err        string
+	}{
+		{"container", "/opt/container", ""},
+		{"service", "/var/www/packages/service", ""},
+		{"module", "/var/www/packages/nested/module/src", ""},
+		{"outside", "", "module at /tmp/workspaces/project1/modules/outside is not inside of service test, so it has no directory in container"},
+		{"no-service-path", "", "exec_path of service dep1 is required to resolve exec_path of module from service"},
+	}
+
+	for _, c := range cases {
+		mdl := cfg.Modules[c.module]
+		svc, err := CreateFromSvcName(cfg, mdl.HostedIn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		workingDir, err := svc.moduleWorkingDir(&mdl)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("%s: unexpected error: %v", c.module, err)
+			}
+			continue
+		}
+		if err != nil || workingDir != c.workingDir {
+			t.Errorf("%s: unexpected working dir %s, error: %v", c.module, workingDir, err)
+		}
+	}
+}
+
+func TestServiceExecRunning(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	Globals.Timings = true
+	defer func() { Globals.Timings = false }()
+
+	composeFilePath := path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")
+
+	mockPC.EXPECT().Getuid().Return(1000)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "asdasd", nil)
+	mockPC.EXPECT().IsTerminal().Return(false)
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", composeFilePath, "exec", "-u", "1000", "-T", "app", "ls"}, gomock.Any()).
+		Return(0, nil)
+
+	// start phase is skipped, so only compose calls are measured
+	mockPC.EXPECT().Eprintf("%-40s %s\n", "test: compose ps --status=running -q", gomock.Any())
+	mockPC.EXPECT().Eprintf("%-40s %s\n", "test: compose exec -u 1000 -T app ls", gomock.Any())
+
+	_, _ = CmdServiceExec(fakeHomeConfigPath, []string{"ls"})
+}
+
+func TestServiceExecDetachKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	composeFilePath := path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")
+
+	// docker exec with detach keys
+	mockPC.EXPECT().Getuid().Return(1000)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfig, "")
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "c1", nil)
+	mockPC.EXPECT().IsTerminal().Return(true)
+	expectTerminalTitle(mockPC, "elc: ensi/test")
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "ps", "-q", "app"}, gomock.Any()).
+		Return(0, "c1\n", nil)
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "exec", "--detach-keys", "ctrl-x,x", "-u", "1000", "-i", "-t", "c1", "bash"}, gomock.Any()).
+		Return(0, nil)
+
+	_, _ = CmdServiceExec(fakeHomeConfigPath, []string{"--detach-keys=ctrl-x,x", "bash"})
+
+	// tty is disabled
+	mockPC.EXPECT().Getuid().Return(1000)
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfig, "")
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", composeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "c1", nil)
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", composeFilePath, "exec", "-u", "1000", "-T", "app", "bash"}, gomock.Any()).
+		Return(0, nil)
+
+	_, _ = CmdServiceExec(fakeHomeConfigPath, []string{"-T", "bash"})
+}
+
+func TestServiceTagsSet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	configPath := path.Join(fakeWorkspacePath, "workspace.yaml")
+	expectSave := func(expected string) {
+		mockPC.EXPECT().WriteFile(configPath, gomock.Any(), os.FileMode(0644)).
+			DoAndReturn(func(filename string, data []byte, perm os.FileMode) error {
+				if !strings.Contains(string(data), expected) {
+					t.Errorf("unexpected config:\n%s", data)
+				}
+				return nil
+			})
+	}
+
+	// modes of existing dependency are changed
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(configPath).Return(true)
+	mockPC.EXPECT().ReadFile(configPath).Return([]byte(workspaceConfigForRename), nil)
+	expectSave("    dependencies:\n      dep1:\n      - hook\n      - extra\n")
+	mockPC.EXPECT().Printf("dependency %s of service %s has modes: [%s]\n", "dep1", "test", "hook, extra")
+
+	err := CmdServiceTagsSet(fakeHomeConfigPath, []string{"test", "dep1", "+hook", "-default", "extra"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// new dependency is added
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(configPath).Return(true)
+	mockPC.EXPECT().ReadFile(configPath).Return([]byte(workspaceConfigForRename), nil)
+	expectSave("  dep1:\n    path: ${WORKSPACE_PATH}/apps/dep1\n    dependencies:\n      test:\n      - hook\n")
+	mockPC.EXPECT().Printf("dependency %s of service %s has modes: [%s]\n", "test", "dep1", "hook")
+
+	_ = CmdServiceTagsSet(fakeHomeConfigPath, []string{"dep1", "test", "hook"})
+
+	// unknown dependency
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(configPath).Return(true)
+	mockPC.EXPECT().ReadFile(configPath).Return([]byte(workspaceConfigForRename), nil)
+
+	err = CmdServiceTagsSet(fakeHomeConfigPath, []string{"test", "db", "hook"})
+	if err == nil || err.Error() != "service db is not found in workspace config" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+const workspaceConfigWithDuplicates = `
+name: ensi
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+  dep1:
+    path: "${WORKSPACE_PATH}/apps/dep1"
+  test:
+    path: "${WORKSPACE_PATH}/apps/test2"
+`
+
+func TestWorkspaceConfigDuplicateServices(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	configPath := path.Join(fakeWorkspacePath, "workspace.yaml")
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().FileExists(fakeWorkspacePath).Return(true)
+	mockPC.EXPECT().Getwd().Return(path.Join(fakeWorkspacePath, "apps/test"), nil)
+	mockPC.EXPECT().FileExists(configPath).Return(true)
+	mockPC.EXPECT().ReadFile(configPath).Return([]byte(workspaceConfigWithDuplicates), nil)
+
+	err := CmdConfigValidate(fakeHomeConfigPath, []string{})
+	if err == nil || err.Error() != "services are defined several times in /tmp/workspaces/project1/workspace.yaml: test" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+type fakeFileInfo struct {
+	name  string
+	dir   bool
+	size  int64
+	mtime time.Time
+}
+
+func (fi fakeFileInfo) Name() string       { return fi.name }
+func (fi fakeFileInfo) Size() int64        { return fi.size }
+func (fi fakeFileInfo) Mode() os.FileMode  { return 0644 }
+func (fi fakeFileInfo) ModTime() time.Time { return fi.mtime }
+func (fi fakeFileInfo) IsDir() bool        { return fi.dir }
+func (fi fakeFileInfo) Sys() interface{}   { return nil }
+
+func TestServiceBuildIfChanged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	statePath := path.Join(fakeWorkspacePath, ".elc-state.yaml")
+	composeFilePath := path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")
+	contextPath := path.Join(fakeWorkspacePath, "apps/test")
+	composeConfig := "services:\n  app:\n    build:\n      context: " + contextPath + "\n"
+	mtime := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	expectContext := func(size int64) {
+		mockPC.EXPECT().
+			ExecToString([]string{"docker", "compose", "-f", composeFilePath, "config"}, gomock.Any()).
+			Return(0, composeConfig, nil)
+		mockPC.EXPECT().ReadDir(contextPath).Return([]os.FileInfo{
+			fakeFileInfo{name: ".git", dir: true},
+			fakeFileInfo{name: "Dockerfile", size: size, mtime: mtime},
+		}, nil)
+	}
+
+	// first build
+	var savedState []byte
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfig, "")
+	mockPC.EXPECT().FileExists(statePath).Return(false)
+	expectContext(10)
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", composeFilePath, "build"}, gomock.Any()).
+		Return(0, nil)
+	mockPC.EXPECT().WriteFile(statePath, gomock.Any(), os.FileMode(0644)).
+		DoAndReturn(func(_ string, data []byte, _ os.FileMode) error {
+			savedState = data
+			return nil
+		})
+
+	err := CmdServiceBuild(fakeHomeConfigPath, []string{"--if-changed", "test"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// not changed
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfig, "")
+	mockPC.EXPECT().FileExists(statePath).Return(true)
+	mockPC.EXPECT().ReadFile(statePath).Return(savedState, nil)
+	expectContext(10)
+	mockPC.EXPECT().Printf("service %s is not changed, build is skipped\n", "test")
+
+	err = CmdServiceBuild(fakeHomeConfigPath, []string{"--if-changed", "test"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// changed
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfig, "")
+	mockPC.EXPECT().FileExists(statePath).Return(true)
+	mockPC.EXPECT().ReadFile(statePath).Return(savedState, nil)
+	expectContext(20)
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", composeFilePath, "build"}, gomock.Any()).
+		Return(0, nil)
+	mockPC.EXPECT().WriteFile(statePath, gomock.Any(), os.FileMode(0644))
+
+	err = CmdServiceBuild(fakeHomeConfigPath, []string{"--if-changed", "test"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSelectServiceInteractive(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	Globals.Cwd = fakeWorkspacePath
+	defer func() { Globals.Cwd = "" }()
+
+	expectMenu := func(answer string) {
+		gomock.InOrder(
+			mockPC.EXPECT().IsStdinTerminal().Return(true),
+			mockPC.EXPECT().Eprintf("%s, select service:\n", gomock.Any()),
+			mockPC.EXPECT().Eprintf("%3d) %s\n", 1, "dep1"),
+			mockPC.EXPECT().Eprintf("%3d) %s\n", 2, "dep2"),
+			mockPC.EXPECT().Eprintf("%3d) %s\n", 3, "dep3"),
+			mockPC.EXPECT().Eprintf("%3d) %s\n", 4, "test"),
+			mockPC.EXPECT().Eprintf("number of service: "),
+			mockPC.EXPECT().ReadLine().Return(answer, nil),
+		)
+	}
+
+	// selected
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	expectMenu("2")
+	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"))
+
+	err := CmdServiceStop(fakeHomeConfigPath, []string{})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// invalid number
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	expectMenu("5")
+
+	err = CmdServiceStop(fakeHomeConfigPath, []string{})
+	if err == nil || err.Error() != "invalid number of service '5'" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// not a terminal
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().IsStdinTerminal().Return(false)
+
+	err = CmdServiceStop(fakeHomeConfigPath, []string{})
+	if err == nil || err.Error() != "you are not in service folder" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServiceStartRollback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	dep1ComposeFilePath := path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml")
+	dep3ComposeFilePath := path.Join(fakeWorkspacePath, "apps/dep3/docker-compose.yml")
+
+	// failure
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	expectStartService(mockPC, dep1ComposeFilePath)
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", dep3ComposeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "", nil)
+	expectPortCheck(mockPC, dep3ComposeFilePath)
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", dep3ComposeFilePath, "up", "-d"}, gomock.Any()).
+		Return(1, errors.New("exit status 1"))
+	gomock.InOrder(
+		mockPC.EXPECT().Printf("stopping service %s\n", "dep3"),
+		mockPC.EXPECT().
+			ExecToString([]string{"docker", "compose", "-f", dep3ComposeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+			Return(0, "", nil),
+		mockPC.EXPECT().Printf("stopping service %s\n", "dep1"),
+	)
+	expectStopService(mockPC, dep1ComposeFilePath)
+	expectBatchReport(mockPC, "dep1", "done", "dep3", "failed: exit status 1")
+
+	err := CmdServiceStart(fakeHomeConfigPath, []string{"--rollback-on-failure", "dep1", "dep3"})
+	if err == nil || err.Error() != "exit status 1" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// interruption
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	expectStartService(mockPC, dep1ComposeFilePath).
+		DoAndReturn(func(_ []string, _ []string) (int, error) {
+			atomic.StoreInt32(&interrupted, 1)
+			return 0, nil
+		})
+	mockPC.EXPECT().Printf("start is interrupted, started services: [%s]\n", "dep1")
+	mockPC.EXPECT().Printf("stopping service %s\n", "dep1")
+	expectStopService(mockPC, dep1ComposeFilePath)
+	expectBatchReport(mockPC, "dep1", "done", "dep3", "skipped")
+
+	err = CmdServiceStart(fakeHomeConfigPath, []string{"--rollback-on-failure", "dep1", "dep3"})
+	if err == nil || err.Error() != "interrupted" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if isInterrupted() {
+		t.Errorf("interruption must be reset after command")
+	}
+}
+
+func TestServiceStartRollbackDependencies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	dep1ComposeFilePath := path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml")
+	dep2ComposeFilePath := path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml")
+	testComposeFilePath := path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	mockPC.EXPECT().
+		ExecToString([]string{"docker", "compose", "-f", testComposeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+		Return(0, "", nil)
+	expectStartService(mockPC, dep1ComposeFilePath)
+	expectStartService(mockPC, dep2ComposeFilePath)
+	expectPortCheck(mockPC, testComposeFilePath)
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", testComposeFilePath, "up", "-d"}, gomock.Any()).
+		Return(1, errors.New("exit status 1"))
+	expectStartProgress(mockPC, "[1/3] starting service test", "[2/3] starting service dep1", "[3/3] starting service dep2")
+	gomock.InOrder(
+		mockPC.EXPECT().Printf("stopping service %s\n", "test"),
+		mockPC.EXPECT().
+			ExecToString([]string{"docker", "compose", "-f", testComposeFilePath, "ps", "--status=running", "-q"}, gomock.Any()).
+			Return(0, "", nil),
+		mockPC.EXPECT().Printf("stopping service %s\n", "dep2"),
+		expectStopService(mockPC, dep2ComposeFilePath),
+		mockPC.EXPECT().Printf("stopping service %s\n", "dep1"),
+		expectStopService(mockPC, dep1ComposeFilePath),
+	)
+
+	err := CmdServiceStart(fakeHomeConfigPath, []string{"--rollback-on-failure"})
+	if err == nil || err.Error() != "exit status 1" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServicePath(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// current
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().Println(path.Join(fakeWorkspacePath, "apps/test"))
+
+	_ = CmdServicePath(fakeHomeConfigPath, []string{})
+
+	// by name
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().Println(path.Join(fakeWorkspacePath, "apps/dep2"))
+
+	_ = CmdServicePath(fakeHomeConfigPath, []string{"dep2"})
+}
+
+func TestServiceProject(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// current
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().Println("ensi-test")
+
+	_ = CmdServiceProject(fakeHomeConfigPath, []string{})
+
+	// by name
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+	mockPC.EXPECT().Println("ensi-dep2")
+
+	_ = CmdServiceProject(fakeHomeConfigPath, []string{"dep2"})
+}
+
+const workspaceConfigWithComposeFiles = `
+name: ensi
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+    compose_files:
+      - "${SVC_PATH}/docker-compose.yml"
+      - "${SVC_PATH}/docker-compose.override.yml"
+`
+
+func TestServiceComposeFiles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	svcPath := path.Join(fakeWorkspacePath, "apps/test")
+	composeFile := path.Join(svcPath, "docker-compose.yml")
+	overrideFile := path.Join(svcPath, "docker-compose.override.yml")
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithComposeFiles, "")
+
+	mockPC.EXPECT().
+		ExecInteractive([]string{"docker", "compose", "-f", composeFile, "-f", overrideFile, "ps"}, gomock.Any()).
+		DoAndReturn(func(_ []string, env []string) (int, error) {
+			expected := "COMPOSE_FILE=" + composeFile + string(os.PathListSeparator) + overrideFile
+			for _, item := range env {
+				if item == expected {
+					return 0, nil
+				}
+			}
+			t.Errorf("environment does not contain %s", expected)
+			return 0, nil
+		})
+
+	_, _ = CmdServiceCompose(fakeHomeConfigPath, []string{"ps"})
+}
+
+func TestDoctor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// no problems
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+	mockPC.EXPECT().FileMode(fakeHomeConfigPath).Return(os.FileMode(0600), nil)
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return([]byte(baseHomeConfig), nil)
+	mockPC.EXPECT().FileExists("/tmp/workspaces/project1").Return(true)
+	mockPC.EXPECT().FileExists("/tmp/workspaces/project2").Return(true)
+	mockPC.EXPECT().Println("no problems found")
+
+	err := CmdDoctor(fakeHomeConfigPath, []string{})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// problems without fix
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+	mockPC.EXPECT().FileMode(fakeHomeConfigPath).Return(os.FileMode(0666), nil)
+	mockPC.EXPECT().Printf("%s %s\n", gomock.Any(), "home config /tmp/home/.elc.yaml has permissions 0666")
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return([]byte(baseHomeConfig), nil)
+	mockPC.EXPECT().FileExists("/tmp/workspaces/project1").Return(true)
+	mockPC.EXPECT().FileExists("/tmp/workspaces/project2").Return(false)
+	mockPC.EXPECT().Printf("%s %s\n", gomock.Any(), "path /tmp/workspaces/project2 of workspace project2 does not exist")
+
+	err = CmdDoctor(fakeHomeConfigPath, []string{})
+	if err == nil || err.Error() != "found 2 problems, 2 of them are not fixed" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// fix
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+	mockPC.EXPECT().FileMode(fakeHomeConfigPath).Return(os.FileMode(0666), nil)
+	mockPC.EXPECT().Printf("%s %s\n", gomock.Any(), "home config /tmp/home/.elc.yaml has permissions 0666")
+	mockPC.EXPECT().Chmod(fakeHomeConfigPath, os.FileMode(0644))
+	mockPC.EXPECT().Printf("%s %s\n", gomock.Any(), "permissions of home config are changed to 0644")
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return([]byte(baseHomeConfig), nil)
+	mockPC.EXPECT().FileExists("/tmp/workspaces/project1").Return(true)
+	mockPC.EXPECT().FileExists("/tmp/workspaces/project2").Return(false)
+	mockPC.EXPECT().Printf("%s %s\n", gomock.Any(), "path /tmp/workspaces/project2 of workspace project2 does not exist")
+	mockPC.EXPECT().IsStdinTerminal().Return(true)
+	mockPC.EXPECT().Eprintf("%s [y/N] ", "remove workspace project2 from home config?")
+	mockPC.EXPECT().ReadLine().Return("y", nil)
+	mockPC.EXPECT().Printf("%s %s\n", gomock.Any(), "workspace project2 is removed")
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ string, data []byte, _ os.FileMode) error {
+			if strings.Contains(string(data), "project2") {
+				t.Errorf("workspace project2 must be removed from home config")
+			}
+			return nil
+		})
+
+	err = CmdDoctor(fakeHomeConfigPath, []string{"--fix"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestHomeConfigMode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// default
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(false)
+	mockPC.EXPECT().LookupEnv("ELC_HOME_CONFIG_MODE").Return("", false)
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, gomock.Any(), os.FileMode(0600))
+
+	_ = CheckHomeConfigIsEmpty(fakeHomeConfigPath)
+
+	// from variable
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(false)
+	mockPC.EXPECT().LookupEnv("ELC_HOME_CONFIG_MODE").Return("0640", true)
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, gomock.Any(), os.FileMode(0640))
+
+	_ = CheckHomeConfigIsEmpty(fakeHomeConfigPath)
+
+	// invalid
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(false)
+	mockPC.EXPECT().LookupEnv("ELC_HOME_CONFIG_MODE").Return("rw", true)
+
+	err := CheckHomeConfigIsEmpty(fakeHomeConfigPath)
+	if err == nil || err.Error() != "invalid ELC_HOME_CONFIG_MODE 'rw', permissions must be octal number, eg. 0600" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// existing config is not changed
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+
+	_ = CheckHomeConfigIsEmpty(fakeHomeConfigPath)
+}
+
+const workspaceConfigForDoctor = `
+name: ensi
+services:
+  test:
+    path: "${WORKSPACE_PATH}/apps/test"
+  broken:
+    path: "${WORKSPACE_PATH}/apps/${UNKNOWN_VAR}"
+modules:
+  mdl1:
+    path: "${WORKSPACE_PATH}/modules/mdl1"
+    hosted_in: test
+`
+
+func TestWorkspaceDoctor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigForDoctor, "")
+
+	gomock.InOrder(
+		mockPC.EXPECT().Printf("%s %s\n", gomock.Any(), "service broken: variable UNKNOWN_VAR is not set"),
+		mockPC.EXPECT().FileExists("/tmp/workspaces/project1/apps//docker-compose.yml").Return(false),
+		mockPC.EXPECT().Printf("%s %s\n", gomock.Any(), "service broken: compose file /tmp/workspaces/project1/apps//docker-compose.yml does not exist"),
+		mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "apps/test/docker-compose.yml")).Return(true),
+		mockPC.EXPECT().FileExists(path.Join(fakeWorkspacePath, "modules/mdl1")).Return(false),
+		mockPC.EXPECT().Printf("%s %s\n", gomock.Any(), "module mdl1: path /tmp/workspaces/project1/modules/mdl1 does not exist"),
+	)
+
+	err := CmdWorkspaceDoctor(fakeHomeConfigPath, []string{})
+	if err == nil || err.Error() != "found 3 problems in workspace ensi" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServiceNamePatterns(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// matched
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/dep1/docker-compose.yml"))
+	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/dep2/docker-compose.yml"))
+	expectStopService(mockPC, path.Join(fakeWorkspacePath, "apps/dep3/docker-compose.yml"))
+	expectBatchReport(mockPC, "dep1", "done", "dep2", "done", "dep3", "done")
+
+	err := CmdServiceStop(fakeHomeConfigPath, []string{"dep?", "dep1"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// nothing matched
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithDeps, "")
+
+	err = CmdServiceStop(fakeHomeConfigPath, []string{"api-*"})
+	if err == nil || err.Error() != "no services match pattern 'api-*'" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestConfigGetSet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// get
+	expectReadHomeConfig(mockPC)
+	mockPC.EXPECT().Println("update")
+
+	_ = CmdConfigGet(fakeHomeConfigPath, []string{"update_command"})
+
+	// set
+	mockPC.EXPECT().FileExists(fakeHomeConfigPath).Return(true)
+	mockPC.EXPECT().ReadFile(fakeHomeConfigPath).Return([]byte(baseHomeConfig+"remember_last_service: true\n"), nil)
+	mockPC.EXPECT().WriteFile(fakeHomeConfigPath, gomock.Any(), os.FileMode(0600)).
+		DoAndReturn(func(_ string, data []byte, _ os.FileMode) error {
+			if !strings.Contains(string(data), "current_workspace: project2\n") || !strings.Contains(string(data), "remember_last_service: true\n") {
+				t.Errorf("options are not saved: %s", data)
+			}
+			return nil
+		})
+
+	err := CmdConfigSet(fakeHomeConfigPath, []string{"current_workspace", "project2"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// invalid values
+	expectReadHomeConfig(mockPC)
+	err = CmdConfigSet(fakeHomeConfigPath, []string{"update_check", "sometimes"})
+	if err == nil || err.Error() != "value of update_check must be true or false" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	expectReadHomeConfig(mockPC)
+	err = CmdConfigSet(fakeHomeConfigPath, []string{"current_workspace", "project3"})
+	if err == nil || err.Error() != "workspace with name 'project3' is not defined" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	expectReadHomeConfig(mockPC)
+	err = CmdConfigGet(fakeHomeConfigPath, []string{"workspaces"})
+	if err == nil || !strings.HasPrefix(err.Error(), "unknown option 'workspaces', use one of: color_theme, current_workspace") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSetGitHooksFromSeveralFolders(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	mockPC.EXPECT().ReadDir("/tmp/hooks1").Return([]os.FileInfo{fakeFileInfo{name: "pre-commit", dir: true}}, nil)
+	mockPC.EXPECT().ReadDir("/tmp/hooks1/pre-commit").Return([]os.FileInfo{fakeFileInfo{name: "lint.sh"}}, nil)
+	mockPC.EXPECT().ReadDir("/tmp/hooks2").Return([]os.FileInfo{
+		fakeFileInfo{name: "README.md"},
+		fakeFileInfo{name: "commit-msg", dir: true},
+		fakeFileInfo{name: "pre-commit", dir: true},
+	}, nil)
+	mockPC.EXPECT().ReadDir("/tmp/hooks2/commit-msg").Return([]os.FileInfo{fakeFileInfo{name: "check.sh"}}, nil)
+	mockPC.EXPECT().ReadDir("/tmp/hooks2/pre-commit").Return([]os.FileInfo{fakeFileInfo{name: "test.sh"}, fakeFileInfo{name: "format.sh"}}, nil)
+
+	header := "#!/bin/bash\nset -e\nprintf \"\\x1b[0;34m%s\\x1b[39;49;00m\\n\" \"Run hook in ELC\"\n"
+	gomock.InOrder(
+		mockPC.EXPECT().WriteFile(".git/hooks/commit-msg", []byte(header+"elc --mode=hook /tmp/hooks2/commit-msg/check.sh"), os.FileMode(0755)),
+		mockPC.EXPECT().WriteFile(".git/hooks/pre-commit", []byte(header+
+			"elc --mode=hook /tmp/hooks1/pre-commit/lint.sh\n"+
+			"elc --mode=hook /tmp/hooks2/pre-commit/format.sh\n"+
+			"elc --mode=hook /tmp/hooks2/pre-commit/test.sh"), os.FileMode(0755)),
+	)
+
+	err := SetGitHooks([]string{"/tmp/hooks2", "/tmp/hooks1"}, "elc")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestHooksRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// installed, run from top level of work tree
+	gomock.InOrder(
+		mockPC.EXPECT().ExecToString([]string{"git", "rev-parse", "--show-toplevel"}, gomock.Any()).
+			Return(0, "/tmp/repo\n", nil),
+		mockPC.EXPECT().Chdir("/tmp/repo").Return(nil),
+		mockPC.EXPECT().ExecToString([]string{"git", "rev-parse", "--git-path", "hooks/commit-msg"}, gomock.Any()).
+			Return(0, ".git/hooks/commit-msg\n", nil),
+		mockPC.EXPECT().FileExists(".git/hooks/commit-msg").Return(true),
+		mockPC.EXPECT().ExecInteractive([]string{".git/hooks/commit-msg", ".git/COMMIT_EDITMSG"}, gomock.Any()).Return(1, nil),
+	)
+
+	code, err := CmdHooksRun([]string{"commit-msg", ".git/COMMIT_EDITMSG"})
+	if err != nil || code != 1 {
+		t.Errorf("unexpected result: %d, %v", code, err)
+	}
+
+	// not installed
+	mockPC.EXPECT().ExecToString([]string{"git", "rev-parse", "--show-toplevel"}, gomock.Any()).
+		Return(0, "/tmp/repo\n", nil)
+	mockPC.EXPECT().Chdir("/tmp/repo").Return(nil)
+	mockPC.EXPECT().ExecToString([]string{"git", "rev-parse", "--git-path", "hooks/pre-push"}, gomock.Any()).
+		Return(0, ".git/hooks/pre-push\n", nil)
+	mockPC.EXPECT().FileExists(".git/hooks/pre-push").Return(false)
+
+	_, err = CmdHooksRun([]string{"pre-push"})
+	if err == nil || err.Error() != "hook pre-push is not installed, install it with 'elc set-hooks HOOKS_PATH'" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLogLevels(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	defer func() { Globals.Quiet, Globals.Verbose = false, false }()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	log := func() {
+		Debug("debug\n")
+		Info("info\n")
+		Warn("warn\n")
+		Error("error\n")
+	}
+
+	// default
+	gomock.InOrder(
+		mockPC.EXPECT().Printf("info\n"),
+		mockPC.EXPECT().Eprintf("warn\n"),
+		mockPC.EXPECT().Eprintf("error\n"),
+	)
+	log()
+
+	// verbose
+	Globals.Verbose = true
+	gomock.InOrder(
+		mockPC.EXPECT().Eprintf("debug\n"),
+		mockPC.EXPECT().Printf("info\n"),
+		mockPC.EXPECT().Eprintf("warn\n"),
+		mockPC.EXPECT().Eprintf("error\n"),
+	)
+	log()
+
+	// quiet wins over verbose
+	Globals.Quiet = true
+	mockPC.EXPECT().Eprintf("error\n")
+	log()
+}
+
+func TestHandlePanic(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	crash := func() {
+		defer HandlePanic()
+		var services map[string]string
+		services["test"] = "test"
+	}
+
+	// short message
+	gomock.InOrder(
+		mockPC.EXPECT().Eprintf("internal error: %v\n", gomock.Any()),
+		mockPC.EXPECT().LookupEnv("ELC_DEBUG").Return("", false),
+		mockPC.EXPECT().Eprintf("run command with --verbose option or %s=1 to see details\n", "ELC_DEBUG"),
+		mockPC.EXPECT().Eprintf("please report it at %s\n", "https://github.com/MadridianFox/ensi-local-ctl/issues"),
+		mockPC.EXPECT().Exit(2),
+	)
+
+	crash()
+
+	// trace
+	gomock.InOrder(
+		mockPC.EXPECT().Eprintf("internal error: %v\n", gomock.Any()),
+		mockPC.EXPECT().LookupEnv("ELC_DEBUG").Return("1", true),
+		mockPC.EXPECT().Eprintf("%s\n", gomock.Any()),
+		mockPC.EXPECT().Eprintf("please report it at %s\n", "https://github.com/MadridianFox/ensi-local-ctl/issues"),
+		mockPC.EXPECT().Exit(2),
+	)
+
+	crash()
+
+	// panic in goroutine of batch command
+	cfg := NewConfig(fakeWorkspacePath, fakeWorkspacePath)
+	cfg.Services["test"] = ServiceConfig{TemplateConfig: TemplateConfig{Path: "${WORKSPACE_PATH}/apps/test"}}
+	gomock.InOrder(
+		mockPC.EXPECT().Eprintf("internal error: %v\n", gomock.Any()),
+		mockPC.EXPECT().LookupEnv("ELC_DEBUG").Return("", false),
+		mockPC.EXPECT().Eprintf("run command with --verbose option or %s=1 to see details\n", "ELC_DEBUG"),
+		mockPC.EXPECT().Eprintf("please report it at %s\n", "https://github.com/MadridianFox/ensi-local-ctl/issues"),
+		mockPC.EXPECT().Exit(2),
+	)
+
+	_ = runParallel(cfg, []string{"test"}, 1, func(svc *Service) error {
+		panic("unexpected")
+	}, newBatchReport([]string{"test"}))
+}
+
+func TestServiceDeps(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPC := NewMockPC(ctrl)
+	Pc = mockPC
+
+	// default mode
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithNestedDeps, "")
+	gomock.InOrder(
+		mockPC.EXPECT().Printf("%-6s %s\n", "mode:", "default"),
+		mockPC.EXPECT().Println("test"),
+		mockPC.EXPECT().Printf("%s%s %s [%s]\n", "  ", gomock.Any(), "dep1", "default, hook"),
+		mockPC.EXPECT().Printf("%s%s %s [%s]\n", "    ", gomock.Any(), "dep3", "hook"),
+		mockPC.EXPECT().Printf("%s%s %s [%s]\n", "  ", gomock.Any(), "dep2", "extra"),
+	)
+
+	err := CmdServiceDeps(fakeHomeConfigPath, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// several modes
+	expectReadHomeConfig(mockPC)
+	expectReadWorkspaceConfig(mockPC, fakeWorkspacePath, workspaceConfigWithNestedDeps, "")
+	gomock.InOrder(
+		mockPC.EXPECT().Printf("%-6s %s\n", "mode:", "hook,extra"),
+		mockPC.EXPECT().Println("test"),
+		mockPC.EXPECT().Printf("%s%s %s [%s]\n", "  ", gomock.Any(), "dep1", "default, hook"),
+		mockPC.EXPECT().Printf("%s%s %s [%s]\n", "    ", gomock.Any(), "dep3", "hook"),
+		mockPC.EXPECT().Printf("%s%s %s [%s]\n", "  ", gomock.Any(), "dep2", "extra"),
+	)
+
+	err = CmdServiceDeps(fakeHomeConfigPath, []string{"--mode=hook,extra", "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
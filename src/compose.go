@@ -0,0 +1,71 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ComposeRunner builds command lines for compose tool and container engine,
+// so services can be run with docker as well as with podman.
+type ComposeRunner interface {
+	ComposeCommand(composeFiles []string, args []string) []string
+	EngineCommand(args []string) []string
+}
+
+type dockerComposeRunner struct{}
+
+func (r dockerComposeRunner) ComposeCommand(composeFiles []string, args []string) []string {
+	return append(append([]string{"docker", "compose"}, composeFileOptions(composeFiles)...), args...)
+}
+
+func (r dockerComposeRunner) EngineCommand(args []string) []string {
+	return append([]string{"docker"}, args...)
+}
+
+type podmanComposeRunner struct{}
+
+func (r podmanComposeRunner) ComposeCommand(composeFiles []string, args []string) []string {
+	return append(append([]string{"podman-compose"}, composeFileOptions(composeFiles)...), args...)
+}
+
+func (r podmanComposeRunner) EngineCommand(args []string) []string {
+	return append([]string{"podman"}, args...)
+}
+
+const composeEngineEnv = "ELC_COMPOSE_ENGINE"
+
+var composeRunners = map[string]ComposeRunner{
+	"docker": dockerComposeRunner{},
+	"podman": podmanComposeRunner{},
+}
+
+func newComposeRunner(engine string) (ComposeRunner, error) {
+	if engine == "" {
+		engine = "docker"
+	}
+
+	runner, found := composeRunners[engine]
+	if !found {
+		return nil, errors.New(fmt.Sprintf("unknown compose engine '%s', use one of: docker, podman", engine))
+	}
+
+	return runner, nil
+}
+
+func composeFileOptions(composeFiles []string) []string {
+	options := make([]string, 0, len(composeFiles)*2)
+	for _, composeFile := range composeFiles {
+		options = append(options, "-f", composeFile)
+	}
+
+	return options
+}
+
+// composeFileSeparator separates files in COMPOSE_FILE variable, compose uses the same separator by default.
+const composeFileSeparator = string(os.PathListSeparator)
+
+func splitComposeFiles(value string) []string {
+	return strings.Split(value, composeFileSeparator)
+}
@@ -0,0 +1,213 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"path"
+)
+
+// loadEditableConfig reads workspace config as ordered mapping, so it can be changed and saved
+// without losing order of keys. Comments are not preserved.
+func loadEditableConfig(wsPath string, configFile string) (string, yaml.MapSlice, error) {
+	cfg := NewConfig(wsPath, "")
+	cfg.ConfigFile = configFile
+	configPath, found := cfg.findConfigFile()
+	if !found {
+		return "", nil, cfg.configNotFoundError()
+	}
+	if path.Ext(configPath) == ".json" {
+		return "", nil, errors.New("editing of json config is not supported")
+	}
+
+	data, err := Pc.ReadFile(configPath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var result yaml.MapSlice
+	err = yaml.Unmarshal(data, &result)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return configPath, result, nil
+}
+
+func saveEditableConfig(configPath string, cfg yaml.MapSlice) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	return Pc.WriteFile(configPath, data, 0644)
+}
+
+// getMappingSection returns section of config which must be a mapping, eg. services or modules.
+func getMappingSection(cfg yaml.MapSlice, key string) (yaml.MapSlice, error) {
+	index := findMapItem(cfg, key)
+	if index == -1 || cfg[index].Value == nil {
+		return yaml.MapSlice{}, nil
+	}
+
+	section, ok := cfg[index].Value.(yaml.MapSlice)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("section '%s' of config is not a mapping, run 'elc config migrate' to convert it", key))
+	}
+
+	return section, nil
+}
+
+func setSection(cfg yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	index := findMapItem(cfg, key)
+	if index == -1 {
+		return append(cfg, yaml.MapItem{Key: key, Value: value})
+	}
+	cfg[index].Value = value
+
+	return cfg
+}
+
+// renameService changes name of service and all references to it in dependencies, modules and aliases.
+func renameService(cfg yaml.MapSlice, oldName string, newName string) (yaml.MapSlice, error) {
+	services, err := getMappingSection(cfg, "services")
+	if err != nil {
+		return nil, err
+	}
+
+	index := findMapItem(services, oldName)
+	if index == -1 {
+		return nil, errors.New(fmt.Sprintf("service %s is not found in workspace config", oldName))
+	}
+	if findMapItem(services, newName) != -1 {
+		return nil, errors.New(fmt.Sprintf("service %s already exists", newName))
+	}
+	services[index].Key = newName
+
+	for _, item := range services {
+		svc, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			continue
+		}
+		depsIndex := findMapItem(svc, "dependencies")
+		if depsIndex == -1 {
+			continue
+		}
+		deps, ok := svc[depsIndex].Value.(yaml.MapSlice)
+		if !ok {
+			continue
+		}
+		if depIndex := findMapItem(deps, oldName); depIndex != -1 {
+			deps[depIndex].Key = newName
+		}
+	}
+
+	modules, err := getMappingSection(cfg, "modules")
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range modules {
+		mdl, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			continue
+		}
+		hostedIndex := findMapItem(mdl, "hosted_in")
+		if hostedIndex != -1 && mdl[hostedIndex].Value == oldName {
+			mdl[hostedIndex].Value = newName
+		}
+	}
+
+	aliases, err := getMappingSection(cfg, "aliases")
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range aliases {
+		if item.Value == oldName {
+			aliases[i].Value = newName
+		}
+	}
+
+	return cfg, nil
+}
+
+// setDependencyModes adds and removes modes of dependency depName of service svcName, dependency is created
+// if it is absent. Resulting list of modes is returned, empty list means that dependency is never started.
+func setDependencyModes(cfg yaml.MapSlice, svcName string, depName string, add []string, remove []string) (yaml.MapSlice, []string, error) {
+	services, err := getMappingSection(cfg, "services")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	index := findMapItem(services, svcName)
+	if index == -1 {
+		return nil, nil, errors.New(fmt.Sprintf("service %s is not found in workspace config", svcName))
+	}
+	if findMapItem(services, depName) == -1 {
+		return nil, nil, errors.New(fmt.Sprintf("service %s is not found in workspace config", depName))
+	}
+	svc, ok := services[index].Value.(yaml.MapSlice)
+	if !ok {
+		svc = yaml.MapSlice{}
+	}
+	deps, err := getMappingSection(svc, "dependencies")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	modes := make([]string, 0)
+	depIndex := findMapItem(deps, depName)
+	if depIndex != -1 {
+		items, _ := deps[depIndex].Value.([]interface{})
+		for _, item := range items {
+			mode := fmt.Sprintf("%v", item)
+			if !contains(remove, mode) {
+				modes = append(modes, mode)
+			}
+		}
+	}
+	for _, mode := range add {
+		if !contains(modes, mode) {
+			modes = append(modes, mode)
+		}
+	}
+
+	if depIndex == -1 {
+		deps = append(deps, yaml.MapItem{Key: depName, Value: modes})
+	} else {
+		deps[depIndex].Value = modes
+	}
+	services[index].Value = setSection(svc, "dependencies", deps)
+
+	return setSection(cfg, "services", services), modes, nil
+}
+
+// addModule adds module to config, service hostedIn must be defined in the same config.
+func addModule(cfg yaml.MapSlice, name string, mdl ModuleConfig) (yaml.MapSlice, error) {
+	services, err := getMappingSection(cfg, "services")
+	if err != nil {
+		return nil, err
+	}
+	if findMapItem(services, mdl.HostedIn) == -1 {
+		return nil, errors.New(fmt.Sprintf("service %s is not found in workspace config", mdl.HostedIn))
+	}
+
+	modules, err := getMappingSection(cfg, "modules")
+	if err != nil {
+		return nil, err
+	}
+	if findMapItem(modules, name) != -1 {
+		return nil, errors.New(fmt.Sprintf("module %s already exists", name))
+	}
+
+	item := yaml.MapSlice{}
+	if mdl.Path != "" {
+		item = append(item, yaml.MapItem{Key: "path", Value: mdl.Path})
+	}
+	item = append(item, yaml.MapItem{Key: "hosted_in", Value: mdl.HostedIn})
+	if mdl.ExecPath != "" {
+		item = append(item, yaml.MapItem{Key: "exec_path", Value: mdl.ExecPath})
+	}
+	modules = append(modules, yaml.MapItem{Key: name, Value: item})
+
+	return setSection(cfg, "modules", modules), nil
+}
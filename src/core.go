@@ -3,8 +3,10 @@ package src
 import (
 	"errors"
 	"fmt"
+	"gopkg.in/yaml.v2"
 	"path"
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -50,6 +52,39 @@ func (ctx *Context) renderMapToEnv() []string {
 	return result
 }
 
+// renderMapToHostEnv returns environment of elc process extended with variables from ctx.
+func (ctx *Context) renderMapToHostEnv() []string {
+	return append(Pc.Environ(), ctx.renderMapToEnv()...)
+}
+
+var reVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// addVariable renders name and value of variable from config, so name may depend on other variables,
+// eg. ${APP_NAME}_HOST. Only rendered names are checked, names written as is are used without changes.
+// Variables are added in order of config, so when several names are rendered to the same one,
+// the last of them wins, as it is for variables written with the same name.
+// Variables overridden with --set are skipped, so other variables are rendered with overridden values.
+func (ctx *Context) addVariable(item yaml.MapItem, overrides Context) (Context, error) {
+	key := fmt.Sprint(item.Key)
+	name, err := substVars(key, *ctx)
+	if err != nil {
+		return nil, err
+	}
+	if name != key && !reVarName.MatchString(name) {
+		return nil, errors.New(fmt.Sprintf("name of variable '%s' is rendered to invalid name '%s'", key, name))
+	}
+	if _, found := overrides.find(name); found {
+		return *ctx, nil
+	}
+
+	value, err := substVars(item.Value.(string), *ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return ctx.add(name, value), nil
+}
+
 func contains(list []string, item string) bool {
 	for _, value := range list {
 		if value == item {
@@ -59,6 +94,72 @@ func contains(list []string, item string) bool {
 	return false
 }
 
+func levenshtein(a string, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(minInt(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// closestNames returns up to limit names which are similar to name, the most similar first.
+func closestNames(name string, names []string, limit int) []string {
+	maxDistance := len(name)/3 + 1
+	distances := make(map[string]int)
+	result := make([]string, 0)
+	for _, candidate := range names {
+		distance := levenshtein(name, candidate)
+		if distance <= maxDistance {
+			distances[candidate] = distance
+			result = append(result, candidate)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if distances[result[i]] != distances[result[j]] {
+			return distances[result[i]] < distances[result[j]]
+		}
+		return result[i] < result[j]
+	})
+
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result
+}
+
+// isSubPath checks that dir is parent or is inside it.
+func isSubPath(dir string, parent string) bool {
+	dir = path.Clean(dir)
+	parent = path.Clean(parent)
+
+	return dir == parent || strings.HasPrefix(dir, strings.TrimSuffix(parent, "/")+"/")
+}
+
 type reResult map[string]string
 
 func reFindMaps(pattern string, subject string) ([]reResult, error) {
@@ -116,25 +217,91 @@ func substVars(expr string, ctx Context) (string, error) {
 	return expr, nil
 }
 
-func SetGitHooks(scriptsFolder string, elcBinary string) error {
-	folders, err := Pc.ReadDir(scriptsFolder)
+// findUnsetVars returns variables used in expression without default value, which are not defined in ctx.
+// substVars silently replaces such variables with empty string.
+func findUnsetVars(expr string, ctx Context) ([]string, error) {
+	foundVars, err := reFindMaps(`\$\{(?P<name>[^:}]+)(?P<default>:-[^}]+)?\}`, expr)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for _, folder := range folders {
-		if !folder.IsDir() {
+
+	unset := make([]string, 0)
+	for _, foundVar := range foundVars {
+		if foundVar["default"] != "" {
 			continue
 		}
-		files, err := Pc.ReadDir(path.Join(scriptsFolder, folder.Name()))
+		if _, found := ctx.find(foundVar["name"]); !found {
+			unset = append(unset, foundVar["name"])
+		}
+	}
+
+	return unset, nil
+}
+
+var reShellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes value for bash, if it contains special characters.
+func shellQuote(value string) string {
+	if reShellSafe.MatchString(value) {
+		return value
+	}
+
+	return "'" + strings.ReplaceAll(value, "'", `'"'"'`) + "'"
+}
+
+// formatCommand returns command with variables of ctx as a line, which can be pasted to shell.
+func formatCommand(ctx Context, command []string) string {
+	parts := make([]string, 0, len(ctx)+len(command))
+	for _, pair := range ctx {
+		parts = append(parts, pair[0]+"="+shellQuote(pair[1]))
+	}
+	for _, arg := range command {
+		parts = append(parts, shellQuote(arg))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// SetGitHooks installs hooks from one or several folders. Scripts of hooks with the same name are
+// combined: folders are taken in order of their paths and scripts of one folder in order of their names.
+func SetGitHooks(scriptsFolders []string, elcBinary string) error {
+	folders := append([]string{}, scriptsFolders...)
+	sort.Strings(folders)
+
+	hooks := make(map[string][]string)
+	for _, scriptsFolder := range folders {
+		hookFolders, err := Pc.ReadDir(scriptsFolder)
 		if err != nil {
 			return err
 		}
-		hookScripts := make([]string, 0)
-		for _, file := range files {
-			hookScripts = append(hookScripts, path.Join(scriptsFolder, folder.Name(), file.Name()))
+		for _, hookFolder := range hookFolders {
+			if !hookFolder.IsDir() {
+				continue
+			}
+			files, err := Pc.ReadDir(path.Join(scriptsFolder, hookFolder.Name()))
+			if err != nil {
+				return err
+			}
+			fileNames := make([]string, 0, len(files))
+			for _, file := range files {
+				fileNames = append(fileNames, file.Name())
+			}
+			sort.Strings(fileNames)
+			for _, fileName := range fileNames {
+				hooks[hookFolder.Name()] = append(hooks[hookFolder.Name()], path.Join(scriptsFolder, hookFolder.Name(), fileName))
+			}
 		}
-		script := generateHookScript(hookScripts, elcBinary)
-		err = Pc.WriteFile(fmt.Sprintf(".git/hooks/%s", folder.Name()), []byte(script), 0755)
+	}
+
+	hookNames := make([]string, 0, len(hooks))
+	for name := range hooks {
+		hookNames = append(hookNames, name)
+	}
+	sort.Strings(hookNames)
+
+	for _, name := range hookNames {
+		script := generateHookScript(hooks[name], elcBinary)
+		err := Pc.WriteFile(fmt.Sprintf(".git/hooks/%s", name), []byte(script), 0755)
 		if err != nil {
 			return err
 		}
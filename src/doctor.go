@@ -0,0 +1,249 @@
+package src
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+)
+
+// doctor collects problems found by checks and counts those which are left unfixed.
+type doctor struct {
+	fix      bool
+	problems int
+	unfixed  int
+}
+
+func (d *doctor) problem(format string, a ...interface{}) {
+	d.problems++
+	d.unfixed++
+	_, _ = Pc.Printf("%s %s\n", Color("problem:", CError), fmt.Sprintf(format, a...))
+}
+
+func (d *doctor) fixed(format string, a ...interface{}) {
+	d.unfixed--
+	_, _ = Pc.Printf("%s %s\n", Color("fixed:", CSuccess), fmt.Sprintf(format, a...))
+}
+
+func CmdDoctor(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "doctor [OPTIONS]", []string{
+		"Check home config and registered workspaces for common problems.",
+		"",
+		"Available options:",
+		fmt.Sprintf("  %-20s - %s", Color("--fix", CHighlight), "fix trivial problems, removal of workspaces is confirmed interactively"),
+	}) {
+		return nil
+	}
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fix := fs.Bool("fix", false, "fix trivial problems")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	d := &doctor{fix: *fix}
+	err = d.checkHomeConfig(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	if d.problems == 0 {
+		_, _ = Pc.Println("no problems found")
+		return nil
+	}
+	if d.unfixed > 0 {
+		return errors.New(fmt.Sprintf("found %d problems, %d of them are not fixed", d.problems, d.unfixed))
+	}
+
+	return nil
+}
+
+func (d *doctor) checkHomeConfig(homeConfigPath string) error {
+	if !Pc.FileExists(homeConfigPath) {
+		d.problem("home config %s does not exist", homeConfigPath)
+		if !d.fix {
+			return nil
+		}
+		err := CheckHomeConfigIsEmpty(homeConfigPath)
+		if err != nil {
+			return err
+		}
+		d.fixed("home config %s is created", homeConfigPath)
+	}
+
+	err := d.checkHomeConfigMode(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	hc, err := LoadHomeConfig(homeConfigPath)
+	if err != nil {
+		d.problem("home config %s can not be read: %s", homeConfigPath, err)
+		return nil
+	}
+
+	return d.checkWorkspaces(hc)
+}
+
+// checkHomeConfigMode reports home config which is not readable and writable by its owner or writable by others.
+func (d *doctor) checkHomeConfigMode(homeConfigPath string) error {
+	mode, err := Pc.FileMode(homeConfigPath)
+	if err != nil {
+		return err
+	}
+	if mode&0600 == 0600 && mode&0022 == 0 {
+		return nil
+	}
+
+	d.problem("home config %s has permissions %04o", homeConfigPath, mode)
+	if !d.fix {
+		return nil
+	}
+
+	newMode := (mode | 0600) &^ 0022
+	err = Pc.Chmod(homeConfigPath, newMode)
+	if err != nil {
+		return err
+	}
+	d.fixed("permissions of home config are changed to %04o", newMode)
+
+	return nil
+}
+
+func (d *doctor) checkWorkspaces(hc *HomeConfig) error {
+	workspaces := make([]HomeConfigItem, 0, len(hc.Workspaces))
+	currentFound := false
+	changed := false
+	for _, ws := range hc.Workspaces {
+		if !Pc.FileExists(ws.Path) {
+			d.problem("path %s of workspace %s does not exist", ws.Path, ws.Name)
+			if d.fix {
+				remove, err := askConfirmation(fmt.Sprintf("remove workspace %s from home config?", ws.Name))
+				if err != nil {
+					return err
+				}
+				if remove {
+					d.fixed("workspace %s is removed", ws.Name)
+					changed = true
+					continue
+				}
+			}
+		}
+		if ws.Name == hc.CurrentWorkspace {
+			currentFound = true
+		}
+		workspaces = append(workspaces, ws)
+	}
+
+	if hc.CurrentWorkspace != "" && !currentFound {
+		d.problem("current workspace %s is not registered", hc.CurrentWorkspace)
+		if d.fix {
+			hc.CurrentWorkspace = ""
+			d.fixed("current workspace is reset, select one with 'elc workspace select NAME'")
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	hc.Workspaces = workspaces
+	return SaveHomeConfig(hc)
+}
+
+func CmdWorkspaceDoctor(homeConfigPath string, args []string) error {
+	if NeedHelp(args, "workspace doctor", []string{
+		"Check that services of current workspace can be run: config is valid, variables of every service",
+		"are resolved and its compose files exist, paths of modules exist.",
+	}) {
+		return nil
+	}
+	cfg, err := getWorkspaceConfig(homeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	d := &doctor{}
+	for _, problem := range cfg.Validate() {
+		d.problem("%s", problem)
+	}
+
+	svcNames := cfg.GetAllSvcNames()
+	sort.Strings(svcNames)
+	for _, svcName := range svcNames {
+		d.checkService(cfg, svcName)
+	}
+
+	mdlNames := make([]string, 0, len(cfg.Modules))
+	for name := range cfg.Modules {
+		mdlNames = append(mdlNames, name)
+	}
+	sort.Strings(mdlNames)
+	for _, mdlName := range mdlNames {
+		mdlPath, err := cfg.renderPath(cfg.Modules[mdlName].Path)
+		if err != nil {
+			d.problem("module %s: %s", mdlName, err)
+		} else if !Pc.FileExists(mdlPath) {
+			d.problem("module %s: path %s does not exist", mdlName, mdlPath)
+		}
+	}
+
+	if d.problems > 0 {
+		return errors.New(fmt.Sprintf("found %d problems in workspace %s", d.problems, cfg.Name))
+	}
+
+	_, _ = Pc.Println("no problems found")
+	return nil
+}
+
+func (d *doctor) checkService(cfg *MainConfig, svcName string) {
+	svc, err := CreateFromSvcName(cfg, svcName)
+	if err != nil {
+		d.problem("service %s: %s", svcName, err)
+		return
+	}
+
+	ctx, err := svc.GetEnv()
+	if err != nil {
+		d.problem("service %s: %s", svcName, err)
+		return
+	}
+
+	exprs := []string{svc.SvcCfg.Path, svc.SvcCfg.ComposeFile, svc.SvcCfg.ExecPath, svc.SvcCfg.WaitFor}
+	exprs = append(exprs, svc.SvcCfg.ComposeFiles...)
+	for _, pair := range svc.SvcCfg.Variables {
+		exprs = append(exprs, fmt.Sprint(pair.Key), fmt.Sprint(pair.Value))
+	}
+	if svc.TplCfg != nil {
+		exprs = append(exprs, svc.TplCfg.Path, svc.TplCfg.ComposeFile)
+		for _, pair := range svc.TplCfg.Variables {
+			exprs = append(exprs, fmt.Sprint(pair.Key), fmt.Sprint(pair.Value))
+		}
+	}
+
+	unset := make([]string, 0)
+	for _, expr := range exprs {
+		names, err := findUnsetVars(expr, ctx)
+		if err != nil {
+			d.problem("service %s: %s", svcName, err)
+			return
+		}
+		for _, name := range names {
+			if !contains(unset, name) {
+				unset = append(unset, name)
+			}
+		}
+	}
+	sort.Strings(unset)
+	for _, name := range unset {
+		d.problem("service %s: variable %s is not set", svcName, name)
+	}
+
+	composeFile, _ := ctx.find("COMPOSE_FILE")
+	for _, file := range splitComposeFiles(composeFile) {
+		if !Pc.FileExists(file) {
+			d.problem("service %s: compose file %s does not exist", svcName, file)
+		}
+	}
+}
@@ -2,24 +2,61 @@ package src
 
 import (
 	"errors"
+	"fmt"
 	"gopkg.in/yaml.v2"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 type HomeConfigItem struct {
-	Name string `yaml:"name"`
-	Path string `yaml:"path"`
+	Name   string `yaml:"name"`
+	Path   string `yaml:"path"`
+	Config string `yaml:"config,omitempty"`
 }
 
 type HomeConfig struct {
-	Path             string           `yaml:"-"`
-	CurrentWorkspace string           `yaml:"current_workspace"`
-	UpdateCommand    string           `yaml:"update_command"`
-	Workspaces       []HomeConfigItem `yaml:"workspaces"`
+	Path                string            `yaml:"-"`
+	CurrentWorkspace    string            `yaml:"current_workspace"`
+	UpdateCommand       string            `yaml:"update_command"`
+	UpdateChannel       string            `yaml:"update_channel,omitempty"`
+	DefaultMode         string            `yaml:"default_mode,omitempty"`
+	RememberLastService bool              `yaml:"remember_last_service,omitempty"`
+	PushedWorkspaces    []string          `yaml:"pushed_workspaces,omitempty"`
+	LogFile             string            `yaml:"log_file,omitempty"`
+	UpdateCheck         bool              `yaml:"update_check,omitempty"`
+	ColorTheme          string            `yaml:"color_theme,omitempty"`
+	Colors              map[string]string `yaml:"colors,omitempty"`
+	Workspaces          []HomeConfigItem  `yaml:"workspaces"`
 }
 
-const defaultUpdateCommand = "curl -sSL https://raw.githubusercontent.com/MadridianFox/ensi-local-ctl/master/get.sh | sudo bash"
+// legacyUpdateCommand is default update_command of previous versions, sudo in it drops variables of update.
+const legacyUpdateCommand = "curl -sSL https://raw.githubusercontent.com/MadridianFox/ensi-local-ctl/master/get.sh | sudo bash"
+
+const defaultUpdateCommand = "curl -sSL https://raw.githubusercontent.com/MadridianFox/ensi-local-ctl/master/get.sh | sudo --preserve-env=ELC_EXPECTED_SHA256,ELC_UPDATE_CHANNEL bash"
+
+// GetHomeConfigPath returns path of home config, each profile has its own file next to the default one.
+func GetHomeConfigPath(homeDir string, profile string) (string, error) {
+	if profile == "" {
+		return path.Join(homeDir, ".elc.yaml"), nil
+	}
+
+	if strings.ContainsAny(profile, "/\\") || strings.HasPrefix(profile, ".") {
+		return "", errors.New(fmt.Sprintf("invalid profile name '%s'", profile))
+	}
+
+	return path.Join(homeDir, fmt.Sprintf(".elc.%s.yaml", profile)), nil
+}
 
 func LoadHomeConfig(configPath string) (*HomeConfig, error) {
+	if preloadedHC != nil && preloadedHC.Path == configPath {
+		hc := preloadedHC
+		preloadedHC = nil
+		return hc, nil
+	}
+
 	yamlFile, err := Pc.ReadFile(configPath)
 	if err != nil {
 		return nil, err
@@ -34,13 +71,38 @@ func LoadHomeConfig(configPath string) (*HomeConfig, error) {
 	return cfg, nil
 }
 
+// Home config may contain paths and settings which are not intended for other users, so it is
+// created readable only by its owner. Permissions are applied only to new file, existing one keeps its own.
+const defaultHomeConfigMode os.FileMode = 0600
+
+// homeConfigModeEnv overrides permissions of created home config, eg. ELC_HOME_CONFIG_MODE=0644.
+const homeConfigModeEnv = "ELC_HOME_CONFIG_MODE"
+
+func homeConfigMode() (os.FileMode, error) {
+	value, found := Pc.LookupEnv(homeConfigModeEnv)
+	if !found || value == "" {
+		return defaultHomeConfigMode, nil
+	}
+
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, errors.New(fmt.Sprintf("invalid %s '%s', permissions must be octal number, eg. 0600", homeConfigModeEnv, value))
+	}
+
+	return os.FileMode(mode), nil
+}
+
 func SaveHomeConfig(homeConfig *HomeConfig) error {
+	return writeHomeConfig(homeConfig, defaultHomeConfigMode)
+}
+
+func writeHomeConfig(homeConfig *HomeConfig, mode os.FileMode) error {
 	data, err := yaml.Marshal(homeConfig)
 	if err != nil {
 		return err
 	}
 
-	err = Pc.WriteFile(homeConfig.Path, data, 0644)
+	err = Pc.WriteFile(homeConfig.Path, data, mode)
 	if err != nil {
 		return err
 	}
@@ -52,11 +114,17 @@ func CheckHomeConfigIsEmpty(configPath string) error {
 	if Pc.FileExists(configPath) {
 		return nil
 	}
-	return SaveHomeConfig(&HomeConfig{Path: configPath, UpdateCommand: defaultUpdateCommand})
+
+	mode, err := homeConfigMode()
+	if err != nil {
+		return err
+	}
+
+	return writeHomeConfig(&HomeConfig{Path: configPath, UpdateCommand: defaultUpdateCommand}, mode)
 }
 
-func (hc *HomeConfig) AddWorkspace(name string, path string) error {
-	hc.Workspaces = append(hc.Workspaces, HomeConfigItem{Name: name, Path: path})
+func (hc *HomeConfig) AddWorkspace(name string, path string, config string) error {
+	hc.Workspaces = append(hc.Workspaces, HomeConfigItem{Name: name, Path: path, Config: config})
 	return SaveHomeConfig(hc)
 }
 
@@ -74,6 +142,16 @@ func (hc *HomeConfig) GetCurrentWsPath() (string, error) {
 	return "", errors.New("current workspace is bad")
 }
 
+// getCurrentWsConfig returns name of config file of current workspace, empty name means default one.
+func (hc *HomeConfig) getCurrentWsConfig() string {
+	ws := hc.findWorkspace(hc.CurrentWorkspace)
+	if ws == nil {
+		return ""
+	}
+
+	return ws.Config
+}
+
 func (hc *HomeConfig) findWorkspace(name string) *HomeConfigItem {
 	for _, workspace := range hc.Workspaces {
 		if workspace.Name == name {
@@ -83,3 +161,99 @@ func (hc *HomeConfig) findWorkspace(name string) *HomeConfigItem {
 
 	return nil
 }
+
+// shrinkHomePath replaces home directory at the beginning of path with "~",
+// so the path stays valid on machine with another home directory.
+func shrinkHomePath(homeDir string, wsPath string) string {
+	if wsPath == homeDir {
+		return "~"
+	}
+	if strings.HasPrefix(wsPath, homeDir+"/") {
+		return "~" + strings.TrimPrefix(wsPath, homeDir)
+	}
+
+	return wsPath
+}
+
+func expandHomePath(homeDir string, wsPath string) string {
+	if wsPath == "~" {
+		return homeDir
+	}
+	if strings.HasPrefix(wsPath, "~/") {
+		return path.Join(homeDir, wsPath[2:])
+	}
+
+	return wsPath
+}
+
+// options maps keys of scalar options of home config to pointers on their fields, it is used by config get and set.
+func (hc *HomeConfig) options() map[string]interface{} {
+	return map[string]interface{}{
+		"current_workspace":     &hc.CurrentWorkspace,
+		"update_command":        &hc.UpdateCommand,
+		"update_channel":        &hc.UpdateChannel,
+		"default_mode":          &hc.DefaultMode,
+		"remember_last_service": &hc.RememberLastService,
+		"log_file":              &hc.LogFile,
+		"update_check":          &hc.UpdateCheck,
+		"color_theme":           &hc.ColorTheme,
+	}
+}
+
+func (hc *HomeConfig) findOption(key string) (interface{}, error) {
+	options := hc.options()
+	option, found := options[key]
+	if !found {
+		keys := make([]string, 0, len(options))
+		for name := range options {
+			keys = append(keys, name)
+		}
+		sort.Strings(keys)
+		return nil, errors.New(fmt.Sprintf("unknown option '%s', use one of: %s", key, strings.Join(keys, ", ")))
+	}
+
+	return option, nil
+}
+
+func (hc *HomeConfig) GetOption(key string) (string, error) {
+	option, err := hc.findOption(key)
+	if err != nil {
+		return "", err
+	}
+
+	switch value := option.(type) {
+	case *bool:
+		return strconv.FormatBool(*value), nil
+	default:
+		return *value.(*string), nil
+	}
+}
+
+func (hc *HomeConfig) SetOption(key string, value string) error {
+	option, err := hc.findOption(key)
+	if err != nil {
+		return err
+	}
+
+	if key == "current_workspace" && value != "" && hc.findWorkspace(value) == nil {
+		return errors.New(fmt.Sprintf("workspace with name '%s' is not defined", value))
+	}
+	if key == "color_theme" && value != "" {
+		if _, found := colorThemes[value]; !found {
+			return errors.New(fmt.Sprintf("unknown color theme '%s', use one of: default, light, plain", value))
+		}
+	}
+
+	switch field := option.(type) {
+	case *bool:
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New(fmt.Sprintf("value of %s must be true or false", key))
+		}
+		*field = flag
+	default:
+		*field.(*string) = value
+	}
+
+	return nil
+}
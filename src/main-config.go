@@ -1,30 +1,53 @@
 package src
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/hashicorp/go-version"
 	"gopkg.in/yaml.v2"
 	"path"
+	"sort"
 	"strings"
 )
 
 type CoreConfig struct {
-	Aliases   map[string]string         `yaml:"aliases"`
-	Templates map[string]TemplateConfig `yaml:"templates"`
-	Services  map[string]ServiceConfig  `yaml:"services"`
-	Modules   map[string]ModuleConfig   `yaml:"modules"`
-	Variables yaml.MapSlice             `yaml:"variables"`
+	Aliases       map[string]string         `yaml:"aliases"`
+	Templates     map[string]TemplateConfig `yaml:"templates"`
+	Services      map[string]ServiceConfig  `yaml:"services"`
+	Modules       map[string]ModuleConfig   `yaml:"modules"`
+	Scripts       map[string]string         `yaml:"scripts"`
+	Variables     Variables                 `yaml:"variables"`
+	DefaultMode   string                    `yaml:"default_mode"`
+	DepTimeout    string                    `yaml:"dep_timeout"`
+	SecretsFile   string                    `yaml:"secrets_file"`
+	SecretVars    []string                  `yaml:"secret_vars"`
+	ComposeEngine string                    `yaml:"compose_engine"`
+}
+
+// runOptions are set by command for the whole run, configs of pushed workspaces share them
+// with config of current workspace by pointer.
+type runOptions struct {
+	WillStart   []string
+	Overrides   Context
+	PrintCmd    bool
+	ShowSecrets bool
 }
 
 type MainConfig struct {
-	CoreConfig    `yaml:",inline"`
-	Name          string     `yaml:"name"`
-	ElcMinVersion string     `yaml:"elc_min_version"`
-	LocalConfig   CoreConfig `yaml:"-"`
-	WorkspacePath string     `yaml:"-"`
-	Cwd           string     `yaml:"-"`
-	WillStart     []string   `yaml:"-"`
+	CoreConfig          `yaml:",inline"`
+	*runOptions         `yaml:"-"`
+	Name                string        `yaml:"name"`
+	ElcMinVersion       string        `yaml:"elc_min_version"`
+	LocalConfig         CoreConfig    `yaml:"-"`
+	WorkspacePath       string        `yaml:"-"`
+	Cwd                 string        `yaml:"-"`
+	ConfigFile          string        `yaml:"-"`
+	DotEnv              Context       `yaml:"-"`
+	Secrets             Context       `yaml:"-"`
+	RememberLastService bool          `yaml:"-"`
+	Stacked             []*MainConfig `yaml:"-"`
+	Runner              ComposeRunner `yaml:"-"`
 }
 
 func NewConfig(workspacePath string, cwd string) *MainConfig {
@@ -36,26 +59,114 @@ func NewConfig(workspacePath string, cwd string) *MainConfig {
 			Templates: make(map[string]TemplateConfig),
 			Services:  make(map[string]ServiceConfig),
 			Modules:   make(map[string]ModuleConfig),
+			Scripts:   make(map[string]string),
 		},
+		runOptions: &runOptions{},
+		Runner:     dockerComposeRunner{},
 	}
 
 	return &cfg
 }
 
+var configFileNames = []string{"workspace.yaml", "workspace.yml", "workspace.json"}
+
+// findConfigFile returns path of existing config file or path of default one, if there is no config yet.
+// Config file set in home config for workspace is used instead of default names.
+func (cfg *MainConfig) findConfigFile() (string, bool) {
+	if cfg.ConfigFile != "" {
+		configPath := cfg.customConfigPath()
+		return configPath, Pc.FileExists(configPath)
+	}
+
+	for _, name := range configFileNames {
+		configPath := path.Join(cfg.WorkspacePath, name)
+		if Pc.FileExists(configPath) {
+			return configPath, true
+		}
+	}
+
+	return path.Join(cfg.WorkspacePath, configFileNames[0]), false
+}
+
+func (cfg *MainConfig) customConfigPath() string {
+	if path.IsAbs(cfg.ConfigFile) {
+		return cfg.ConfigFile
+	}
+
+	return path.Join(cfg.WorkspacePath, cfg.ConfigFile)
+}
+
+func (cfg *MainConfig) configNotFoundError() error {
+	if cfg.ConfigFile != "" {
+		return errors.New(fmt.Sprintf("config of workspace is not found at %s", cfg.customConfigPath()))
+	}
+	return errors.New(fmt.Sprintf("config of workspace is not found in %s, expected one of: %s. Create it with 'elc workspace init %s'",
+		cfg.WorkspacePath, strings.Join(configFileNames, ", "), cfg.WorkspacePath))
+}
+
+// unmarshalConfig decodes yaml or json config. JSON is decoded with yaml parser too,
+// because it is a subset of yaml and only yaml decoder keeps order of variables.
+func unmarshalConfig(configPath string, data []byte, out interface{}) error {
+	if path.Ext(configPath) == ".json" && !json.Valid(data) {
+		return errors.New(fmt.Sprintf("file %s is not valid json", configPath))
+	}
+
+	return yaml.Unmarshal(data, out)
+}
+
+// findDuplicateServices returns names of services defined more than once, because yaml decoder silently
+// keeps only the last definition in map.
+func findDuplicateServices(data []byte) []string {
+	var raw yaml.MapSlice
+	if yaml.Unmarshal(data, &raw) != nil {
+		return nil
+	}
+	index := findMapItem(raw, "services")
+	if index == -1 {
+		return nil
+	}
+	services, ok := raw[index].Value.(yaml.MapSlice)
+	if !ok {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	duplicates := make([]string, 0)
+	for _, item := range services {
+		name := fmt.Sprintf("%v", item.Key)
+		counts[name]++
+		if counts[name] == 2 {
+			duplicates = append(duplicates, name)
+		}
+	}
+	sort.Strings(duplicates)
+
+	return duplicates
+}
+
 func (cfg *MainConfig) LoadFromFile() error {
-	yamlFile, err := Pc.ReadFile(path.Join(cfg.WorkspacePath, "workspace.yaml"))
+	configPath, found := cfg.findConfigFile()
+	if !found {
+		return cfg.configNotFoundError()
+	}
+	configFile, err := Pc.ReadFile(configPath)
 	if err != nil {
 		return err
 	}
 
-	err = yaml.Unmarshal(yamlFile, cfg)
+	err = unmarshalConfig(configPath, configFile, cfg)
 	if err != nil {
 		return err
 	}
 
+	duplicates := findDuplicateServices(configFile)
+	if len(duplicates) > 0 {
+		return errors.New(fmt.Sprintf("services are defined several times in %s: %s", configPath, strings.Join(duplicates, ", ")))
+	}
+
 	envPath := path.Join(cfg.WorkspacePath, "env.yaml")
 	if Pc.FileExists(envPath) {
-		yamlFile, err = Pc.ReadFile(envPath)
+		yamlFile, err := Pc.ReadFile(envPath)
 		if err != nil {
 			return err
 		}
@@ -67,29 +178,196 @@ func (cfg *MainConfig) LoadFromFile() error {
 		cfg.mergeLocalValues()
 	}
 
+	dotEnvPath := path.Join(cfg.WorkspacePath, ".env")
+	if Pc.FileExists(dotEnvPath) {
+		data, err := Pc.ReadFile(dotEnvPath)
+		if err != nil {
+			return err
+		}
+
+		cfg.DotEnv = parseDotEnv(data)
+	}
+
+	return cfg.loadSecrets()
+}
+
+// setComposeEngine selects compose runner with engine from ELC_COMPOSE_ENGINE variable or compose_engine option.
+func (cfg *MainConfig) setComposeEngine() error {
+	engine, found := Pc.LookupEnv(composeEngineEnv)
+	if !found || engine == "" {
+		engine = cfg.ComposeEngine
+	}
+
+	runner, err := newComposeRunner(engine)
+	if err != nil {
+		return err
+	}
+	cfg.Runner = runner
+
 	return nil
 }
 
+// loadSecrets reads variables from secrets_file. Missing file is not an error,
+// because secrets are usually not committed and may be absent on a fresh checkout.
+func (cfg *MainConfig) loadSecrets() error {
+	if cfg.SecretsFile == "" {
+		return nil
+	}
+
+	secretsPath, err := cfg.renderPath(cfg.SecretsFile)
+	if err != nil {
+		return err
+	}
+	if !path.IsAbs(secretsPath) {
+		secretsPath = path.Join(cfg.WorkspacePath, secretsPath)
+	}
+	if !Pc.FileExists(secretsPath) {
+		return nil
+	}
+
+	data, err := Pc.ReadFile(secretsPath)
+	if err != nil {
+		return err
+	}
+
+	var secrets Variables
+	err = yaml.Unmarshal(data, &secrets)
+	if err != nil {
+		return err
+	}
+
+	for _, pair := range secrets {
+		cfg.Secrets = cfg.Secrets.add(fmt.Sprint(pair.Key), fmt.Sprint(pair.Value))
+	}
+
+	return nil
+}
+
+// isSecret checks if variable is loaded from secrets file or matches one of secret_vars patterns, eg. *_PASSWORD.
+func (cfg *MainConfig) isSecret(name string) bool {
+	_, found := cfg.Secrets.find(name)
+	if found {
+		return true
+	}
+
+	for _, pattern := range cfg.SecretVars {
+		matched, err := path.Match(pattern, name)
+		if err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// maskSecret returns value of variable or mask instead of it, if variable is secret and show is not set.
+func (cfg *MainConfig) maskSecret(name string, value string, show bool) string {
+	if !show && cfg.isSecret(name) {
+		return secretMask
+	}
+
+	return value
+}
+
+// maskSecrets returns copy of ctx with masked values of secret variables, if show is not set.
+func (cfg *MainConfig) maskSecrets(ctx Context, show bool) Context {
+	result := make(Context, 0, len(ctx))
+	for _, pair := range ctx {
+		result = append(result, []string{pair[0], cfg.maskSecret(pair[0], pair[1], show)})
+	}
+
+	return result
+}
+
+// parseDotEnv reads variables from .env file. Like docker compose does,
+// variables of elc process take precedence over values from file.
+func parseDotEnv(data []byte) Context {
+	ctx := make(Context, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(line, "export "), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+
+		if envValue, found := Pc.LookupEnv(name); found {
+			value = envValue
+		}
+		ctx = ctx.add(name, value)
+	}
+
+	return ctx
+}
+
 func (cfg *MainConfig) checkVersion() error {
 	if cfg.ElcMinVersion == "" {
 		return nil
 	}
 	vCfg, err := version.NewVersion(cfg.ElcMinVersion)
 	if err != nil {
-		return err
+		return errors.New(fmt.Sprintf("invalid elc_min_version '%s' in workspace config: %s. Run 'elc config migrate' to fix it.", cfg.ElcMinVersion, err))
 	}
 	vElc, err := version.NewVersion(Version)
 	if err != nil {
 		return err
 	}
 
-	if vElc.LessThanOrEqual(vCfg) {
-		return errors.New(fmt.Sprintf("This workspace requires elc version %s. Please, update elc or use another binary.", cfg.ElcMinVersion))
+	if vElc.LessThan(vCfg) {
+		return errors.New(fmt.Sprintf("This workspace requires elc version %s or newer, but current version is %s. Please, update elc with 'elc update' or use another binary.", cfg.ElcMinVersion, Version))
 	}
 
 	return nil
 }
 
+// Validate returns list of problems of config, which are not found by parsing, eg. broken references between sections.
+func (cfg *MainConfig) Validate() []string {
+	problems := make([]string, 0)
+
+	mdlNames := make([]string, 0, len(cfg.Modules))
+	for name := range cfg.Modules {
+		mdlNames = append(mdlNames, name)
+	}
+	sort.Strings(mdlNames)
+
+	for _, name := range mdlNames {
+		if base := cfg.Modules[name].ExecPathBase; base != "" && !contains(execPathBases, base) {
+			problems = append(problems, fmt.Sprintf("module %s has unknown exec_path_base %s, use one of: %s", name, base, strings.Join(execPathBases, ", ")))
+		}
+
+		hostedIn := cfg.Modules[name].HostedIn
+		if hostedIn == "" {
+			problems = append(problems, fmt.Sprintf("module %s has no hosted_in service", name))
+			continue
+		}
+		if _, _, err := cfg.findServiceOwner(hostedIn).FindServiceByName(hostedIn); err != nil {
+			problems = append(problems, fmt.Sprintf("module %s is hosted in unknown service %s", name, hostedIn))
+		}
+	}
+
+	svcNames := make([]string, 0, len(cfg.Services))
+	for name := range cfg.Services {
+		svcNames = append(svcNames, name)
+	}
+	sort.Strings(svcNames)
+
+	for _, name := range svcNames {
+		if cfg.Services[name].ComposeFile != "" && len(cfg.Services[name].ComposeFiles) > 0 {
+			problems = append(problems, fmt.Sprintf("service %s has both compose_file and compose_files, use only one of them", name))
+		}
+	}
+
+	return problems
+}
+
 func (cfg *MainConfig) mergeLocalValues() {
 	for key, value := range cfg.LocalConfig.Templates {
 		cfg.Templates[key] = value
@@ -106,6 +384,28 @@ func (cfg *MainConfig) mergeLocalValues() {
 	for key, value := range cfg.LocalConfig.Aliases {
 		cfg.Aliases[key] = value
 	}
+
+	for key, value := range cfg.LocalConfig.Scripts {
+		cfg.Scripts[key] = value
+	}
+
+	if cfg.LocalConfig.DefaultMode != "" {
+		cfg.DefaultMode = cfg.LocalConfig.DefaultMode
+	}
+
+	if cfg.LocalConfig.DepTimeout != "" {
+		cfg.DepTimeout = cfg.LocalConfig.DepTimeout
+	}
+
+	if cfg.LocalConfig.ComposeEngine != "" {
+		cfg.ComposeEngine = cfg.LocalConfig.ComposeEngine
+	}
+
+	if cfg.LocalConfig.SecretsFile != "" {
+		cfg.SecretsFile = cfg.LocalConfig.SecretsFile
+	}
+
+	cfg.SecretVars = append(cfg.SecretVars, cfg.LocalConfig.SecretVars...)
 }
 
 func (cfg *MainConfig) makeGlobalEnv() (Context, error) {
@@ -114,20 +414,31 @@ func (cfg *MainConfig) makeGlobalEnv() (Context, error) {
 	ctx = ctx.add("WORKSPACE_PATH", strings.TrimRight(cfg.WorkspacePath, "/"))
 	ctx = ctx.add("WORKSPACE_NAME", cfg.Name)
 
+	for _, pair := range cfg.DotEnv {
+		ctx = ctx.add(pair[0], pair[1])
+	}
+
+	for _, pair := range cfg.Secrets {
+		ctx = ctx.add(pair[0], pair[1])
+	}
+
+	for _, pair := range cfg.Overrides {
+		ctx = ctx.add(pair[0], pair[1])
+	}
+
+	var err error
 	for _, pair := range cfg.LocalConfig.Variables {
-		value, err := substVars(pair.Value.(string), ctx)
+		ctx, err = ctx.addVariable(pair, cfg.Overrides)
 		if err != nil {
 			return nil, err
 		}
-		ctx = ctx.add(pair.Key.(string), value)
 	}
 
 	for _, pair := range cfg.Variables {
-		value, err := substVars(pair.Value.(string), ctx)
+		ctx, err = ctx.addVariable(pair, cfg.Overrides)
 		if err != nil {
 			return nil, err
 		}
-		ctx = ctx.add(pair.Key.(string), value)
 	}
 
 	return ctx, nil
@@ -142,21 +453,40 @@ func (cfg *MainConfig) renderPath(path string) (string, error) {
 }
 
 func (cfg *MainConfig) FindServiceByPath() (string, error) {
-	for name, svc := range cfg.Services {
-		svcPath, err := cfg.renderPath(svc.Path)
+	for _, owner := range append([]*MainConfig{cfg}, cfg.Stacked...) {
+		name, found, err := owner.findOwnServiceByPath()
 		if err != nil {
 			return "", err
 		}
-		if strings.HasPrefix(cfg.Cwd, svcPath) {
+		if found {
 			return name, nil
 		}
 	}
 
+	if !isSubPath(cfg.Cwd, cfg.WorkspacePath) {
+		return "", errors.New(fmt.Sprintf("you are not in folder of workspace %s (%s), select another workspace with 'elc workspace select NAME' or pass service with --svc", cfg.Name, cfg.WorkspacePath))
+	}
+
 	return "", errors.New("you are not in service folder")
 }
 
+// findOwnServiceByPath looks for service with current directory only in services of config itself, without stacked configs.
+func (cfg *MainConfig) findOwnServiceByPath() (string, bool, error) {
+	for name, svc := range cfg.Services {
+		svcPath, err := cfg.renderPath(svc.Path)
+		if err != nil {
+			return "", false, err
+		}
+		if strings.HasPrefix(cfg.Cwd, svcPath) {
+			return name, true, nil
+		}
+	}
+
+	return "", false, nil
+}
+
 func (cfg *MainConfig) FindServiceByName(name string) (*ServiceConfig, string, error) {
-	realName := cfg.LocalConfig.resolveAlias(name)
+	realName := cfg.resolveAlias(name)
 	svc, found := cfg.Services[realName]
 	if !found {
 		return nil, "", errors.New(fmt.Sprintf("service %s not found", name))
@@ -174,8 +504,17 @@ func (cfg *MainConfig) FindTemplateByName(name string) (*TemplateConfig, error)
 	return &tpl, nil
 }
 
+func (cfg *MainConfig) FindScriptByName(name string) (string, error) {
+	script, found := cfg.Scripts[name]
+	if !found {
+		return "", errors.New(fmt.Sprintf("script %s not found", name))
+	}
+
+	return script, nil
+}
+
 func (cfg *MainConfig) FindModuleByName(name string) (*ModuleConfig, error) {
-	realName := cfg.LocalConfig.resolveAlias(name)
+	realName := cfg.resolveAlias(name)
 	mdl, found := cfg.Modules[realName]
 	if !found {
 		return nil, errors.New(fmt.Sprintf("module %s not found", name))
@@ -204,9 +543,38 @@ func (cfg *MainConfig) GetAllSvcNames() []string {
 		result = append(result, name)
 	}
 
+	for _, stacked := range cfg.Stacked {
+		for name := range stacked.Services {
+			if _, found := cfg.Services[name]; !found && !contains(result, name) {
+				result = append(result, name)
+			}
+		}
+	}
+
 	return result
 }
 
+// composeProjectName returns name of compose project of service, it is used in labels of docker resources.
+func (cfg *MainConfig) composeProjectName(svcName string) string {
+	return fmt.Sprintf("%s-%s", cfg.Name, svcName)
+}
+
+// findServiceOwner returns config where service is defined, own services of config have priority over
+// services of workspaces pushed with 'elc workspace push'.
+func (cfg *MainConfig) findServiceOwner(name string) *MainConfig {
+	if _, found := cfg.Services[cfg.resolveAlias(name)]; found {
+		return cfg
+	}
+
+	for _, stacked := range cfg.Stacked {
+		if _, found := stacked.Services[stacked.resolveAlias(name)]; found {
+			return stacked
+		}
+	}
+
+	return cfg
+}
+
 func (ccfg *CoreConfig) resolveAlias(name string) string {
 	realName, found := ccfg.Aliases[name]
 	if found {
@@ -215,3 +583,88 @@ func (ccfg *CoreConfig) resolveAlias(name string) string {
 
 	return name
 }
+
+func (cfg *MainConfig) SortByDependencies(names []string) []string {
+	sorted := make([]string, len(names))
+	copy(sorted, names)
+	sort.Strings(sorted)
+
+	visited := make(map[string]bool)
+	result := make([]string, 0, len(names))
+
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+
+		svc, _, err := cfg.findServiceOwner(name).FindServiceByName(name)
+		if err == nil {
+			depNames := make([]string, 0, len(svc.Dependencies))
+			for depName := range svc.Dependencies {
+				depNames = append(depNames, depName)
+			}
+			sort.Strings(depNames)
+			for _, depName := range depNames {
+				visit(depName)
+			}
+		}
+
+		if contains(sorted, name) {
+			result = append(result, name)
+		}
+	}
+
+	for _, name := range sorted {
+		visit(name)
+	}
+
+	return result
+}
+
+// GroupByDependencyLevels splits services into levels, so that every service depends only on services of previous levels.
+func (cfg *MainConfig) GroupByDependencyLevels(names []string) [][]string {
+	depths := make(map[string]int)
+	var depth func(name string, visiting []string) int
+	depth = func(name string, visiting []string) int {
+		if value, found := depths[name]; found {
+			return value
+		}
+		if contains(visiting, name) {
+			return 0
+		}
+
+		result := 0
+		svc, _, err := cfg.findServiceOwner(name).FindServiceByName(name)
+		if err == nil {
+			for depName := range svc.Dependencies {
+				depDepth := depth(depName, append(visiting, name)) + 1
+				if depDepth > result {
+					result = depDepth
+				}
+			}
+		}
+		depths[name] = result
+
+		return result
+	}
+
+	levels := make([][]string, 0)
+	for _, name := range cfg.SortByDependencies(names) {
+		level := depth(name, nil)
+		for len(levels) <= level {
+			levels = append(levels, make([]string, 0))
+		}
+		levels[level] = append(levels[level], name)
+	}
+
+	result := make([][]string, 0, len(levels))
+	for _, level := range levels {
+		if len(level) > 0 {
+			result = append(result, level)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,135 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"gopkg.in/yaml.v2"
+	"path"
+)
+
+type configMigration struct {
+	description string
+	apply       func(cfg yaml.MapSlice) (yaml.MapSlice, bool)
+}
+
+var configMigrations = []configMigration{
+	{"convert list of templates to mapping", listToMapping("templates")},
+	{"convert list of services to mapping", listToMapping("services")},
+	{"convert list of modules to mapping", listToMapping("modules")},
+	{fmt.Sprintf("set elc_min_version to %s", Version), raiseMinVersion},
+}
+
+func findMapItem(cfg yaml.MapSlice, key string) int {
+	for i, item := range cfg {
+		if item.Key == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// listToMapping converts old style list of items with 'name' field into mapping of names to items.
+func listToMapping(key string) func(cfg yaml.MapSlice) (yaml.MapSlice, bool) {
+	return func(cfg yaml.MapSlice) (yaml.MapSlice, bool) {
+		index := findMapItem(cfg, key)
+		if index == -1 {
+			return cfg, false
+		}
+		list, ok := cfg[index].Value.([]interface{})
+		if !ok {
+			return cfg, false
+		}
+
+		result := make(yaml.MapSlice, 0, len(list))
+		for _, value := range list {
+			item, ok := value.(yaml.MapSlice)
+			if !ok {
+				return cfg, false
+			}
+			nameIndex := findMapItem(item, "name")
+			if nameIndex == -1 {
+				return cfg, false
+			}
+			name := item[nameIndex].Value
+			item = append(item[:nameIndex:nameIndex], item[nameIndex+1:]...)
+			result = append(result, yaml.MapItem{Key: name, Value: item})
+		}
+		cfg[index].Value = result
+
+		return cfg, true
+	}
+}
+
+func raiseMinVersion(cfg yaml.MapSlice) (yaml.MapSlice, bool) {
+	index := findMapItem(cfg, "elc_min_version")
+	if index == -1 {
+		return append(cfg, yaml.MapItem{Key: "elc_min_version", Value: Version}), true
+	}
+
+	vCfg, err := version.NewVersion(fmt.Sprint(cfg[index].Value))
+	vElc, _ := version.NewVersion(Version)
+	if err == nil && !vCfg.LessThan(vElc) {
+		return cfg, false
+	}
+	cfg[index].Value = Version
+
+	return cfg, true
+}
+
+// MigrateConfig applies all known transformations to workspace config
+// and returns new content of config with descriptions of applied transformations.
+func MigrateConfig(data []byte) ([]byte, []string, error) {
+	var cfg yaml.MapSlice
+	err := yaml.Unmarshal(data, &cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	applied := make([]string, 0)
+	for _, migration := range configMigrations {
+		var changed bool
+		cfg, changed = migration.apply(cfg)
+		if changed {
+			applied = append(applied, migration.description)
+		}
+	}
+
+	if len(applied) == 0 {
+		return data, applied, nil
+	}
+
+	result, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result, applied, nil
+}
+
+func migrateConfigFile(configPath string) ([]string, error) {
+	if path.Ext(configPath) == ".json" {
+		return nil, errors.New("migration of json config is not supported")
+	}
+
+	data, err := Pc.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	migrated, applied, err := MigrateConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(applied) == 0 {
+		return applied, nil
+	}
+
+	err = Pc.WriteFile(configPath+".bak", data, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return applied, Pc.WriteFile(configPath, migrated, 0644)
+}
@@ -5,6 +5,7 @@
 package src
 
 import (
+	context "context"
 	os "os"
 	reflect "reflect"
 
@@ -48,6 +49,68 @@ func (mr *MockPCMockRecorder) Args() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Args", reflect.TypeOf((*MockPC)(nil).Args))
 }
 
+// Chdir mocks base method.
+func (m *MockPC) Chdir(dir string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Chdir", dir)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Chdir indicates an expected call of Chdir.
+func (mr *MockPCMockRecorder) Chdir(dir interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Chdir", reflect.TypeOf((*MockPC)(nil).Chdir), dir)
+}
+
+// Chmod mocks base method.
+func (m *MockPC) Chmod(filename string, mode os.FileMode) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Chmod", filename, mode)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Chmod indicates an expected call of Chmod.
+func (mr *MockPCMockRecorder) Chmod(filename, mode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Chmod", reflect.TypeOf((*MockPC)(nil).Chmod), filename, mode)
+}
+
+// Environ mocks base method.
+func (m *MockPC) Environ() []string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Environ")
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+// Environ indicates an expected call of Environ.
+func (mr *MockPCMockRecorder) Environ() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Environ", reflect.TypeOf((*MockPC)(nil).Environ))
+}
+
+// Eprintf mocks base method.
+func (m *MockPC) Eprintf(format string, a ...interface{}) (int, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{format}
+	for _, a_2 := range a {
+		varargs = append(varargs, a_2)
+	}
+	ret := m.ctrl.Call(m, "Eprintf", varargs...)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Eprintf indicates an expected call of Eprintf.
+func (mr *MockPCMockRecorder) Eprintf(format interface{}, a ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{format}, a...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Eprintf", reflect.TypeOf((*MockPC)(nil).Eprintf), varargs...)
+}
+
 // ExecInteractive mocks base method.
 func (m *MockPC) ExecInteractive(command, env []string) (int, error) {
 	m.ctrl.T.Helper()
@@ -63,6 +126,21 @@ func (mr *MockPCMockRecorder) ExecInteractive(command, env interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecInteractive", reflect.TypeOf((*MockPC)(nil).ExecInteractive), command, env)
 }
 
+// ExecInteractiveContext mocks base method.
+func (m *MockPC) ExecInteractiveContext(ctx context.Context, command, env []string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExecInteractiveContext", ctx, command, env)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExecInteractiveContext indicates an expected call of ExecInteractiveContext.
+func (mr *MockPCMockRecorder) ExecInteractiveContext(ctx, command, env interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecInteractiveContext", reflect.TypeOf((*MockPC)(nil).ExecInteractiveContext), ctx, command, env)
+}
+
 // ExecToString mocks base method.
 func (m *MockPC) ExecToString(command, env []string) (int, string, error) {
 	m.ctrl.T.Helper()
@@ -79,6 +157,21 @@ func (mr *MockPCMockRecorder) ExecToString(command, env interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecToString", reflect.TypeOf((*MockPC)(nil).ExecToString), command, env)
 }
 
+// ExecWithPrefix mocks base method.
+func (m *MockPC) ExecWithPrefix(command, env []string, prefix string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExecWithPrefix", command, env, prefix)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExecWithPrefix indicates an expected call of ExecWithPrefix.
+func (mr *MockPCMockRecorder) ExecWithPrefix(command, env, prefix interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecWithPrefix", reflect.TypeOf((*MockPC)(nil).ExecWithPrefix), command, env, prefix)
+}
+
 // Exit mocks base method.
 func (m *MockPC) Exit(code int) {
 	m.ctrl.T.Helper()
@@ -105,6 +198,21 @@ func (mr *MockPCMockRecorder) FileExists(filepath interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FileExists", reflect.TypeOf((*MockPC)(nil).FileExists), filepath)
 }
 
+// FileMode mocks base method.
+func (m *MockPC) FileMode(filename string) (os.FileMode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FileMode", filename)
+	ret0, _ := ret[0].(os.FileMode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FileMode indicates an expected call of FileMode.
+func (mr *MockPCMockRecorder) FileMode(filename interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FileMode", reflect.TypeOf((*MockPC)(nil).FileMode), filename)
+}
+
 // Getuid mocks base method.
 func (m *MockPC) Getuid() int {
 	m.ctrl.T.Helper()
@@ -149,6 +257,63 @@ func (mr *MockPCMockRecorder) HomeDir() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HomeDir", reflect.TypeOf((*MockPC)(nil).HomeDir))
 }
 
+// HttpGet mocks base method.
+func (m *MockPC) HttpGet(url string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HttpGet", url)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HttpGet indicates an expected call of HttpGet.
+func (mr *MockPCMockRecorder) HttpGet(url interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HttpGet", reflect.TypeOf((*MockPC)(nil).HttpGet), url)
+}
+
+// IsPortFree mocks base method.
+func (m *MockPC) IsPortFree(hostIP, port string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsPortFree", hostIP, port)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsPortFree indicates an expected call of IsPortFree.
+func (mr *MockPCMockRecorder) IsPortFree(hostIP, port interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsPortFree", reflect.TypeOf((*MockPC)(nil).IsPortFree), hostIP, port)
+}
+
+// IsPortOpen mocks base method.
+func (m *MockPC) IsPortOpen(address string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsPortOpen", address)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsPortOpen indicates an expected call of IsPortOpen.
+func (mr *MockPCMockRecorder) IsPortOpen(address interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsPortOpen", reflect.TypeOf((*MockPC)(nil).IsPortOpen), address)
+}
+
+// IsStdinTerminal mocks base method.
+func (m *MockPC) IsStdinTerminal() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsStdinTerminal")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsStdinTerminal indicates an expected call of IsStdinTerminal.
+func (mr *MockPCMockRecorder) IsStdinTerminal() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsStdinTerminal", reflect.TypeOf((*MockPC)(nil).IsStdinTerminal))
+}
+
 // IsTerminal mocks base method.
 func (m *MockPC) IsTerminal() bool {
 	m.ctrl.T.Helper()
@@ -163,6 +328,36 @@ func (mr *MockPCMockRecorder) IsTerminal() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsTerminal", reflect.TypeOf((*MockPC)(nil).IsTerminal))
 }
 
+// LookPath mocks base method.
+func (m *MockPC) LookPath(file string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LookPath", file)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LookPath indicates an expected call of LookPath.
+func (mr *MockPCMockRecorder) LookPath(file interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LookPath", reflect.TypeOf((*MockPC)(nil).LookPath), file)
+}
+
+// LookupEnv mocks base method.
+func (m *MockPC) LookupEnv(key string) (string, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LookupEnv", key)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// LookupEnv indicates an expected call of LookupEnv.
+func (mr *MockPCMockRecorder) LookupEnv(key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LookupEnv", reflect.TypeOf((*MockPC)(nil).LookupEnv), key)
+}
+
 // Printf mocks base method.
 func (m *MockPC) Printf(format string, a ...interface{}) (int, error) {
 	m.ctrl.T.Helper()
@@ -232,6 +427,21 @@ func (mr *MockPCMockRecorder) ReadFile(filename interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadFile", reflect.TypeOf((*MockPC)(nil).ReadFile), filename)
 }
 
+// ReadLine mocks base method.
+func (m *MockPC) ReadLine() (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadLine")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadLine indicates an expected call of ReadLine.
+func (mr *MockPCMockRecorder) ReadLine() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadLine", reflect.TypeOf((*MockPC)(nil).ReadLine))
+}
+
 // WriteFile mocks base method.
 func (m *MockPC) WriteFile(filename string, data []byte, perm os.FileMode) error {
 	m.ctrl.T.Helper()
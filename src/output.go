@@ -0,0 +1,98 @@
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+const (
+	FormatTable = "table"
+	FormatJson  = "json"
+	FormatPlain = "plain"
+)
+
+// OutputTable is a common representation of data printed by list commands.
+// In plain format cells of row are joined with Separator, or with space if it is empty.
+type OutputTable struct {
+	Columns   []string
+	Rows      [][]string
+	Separator string
+}
+
+func addFormatFlag(fs *flag.FlagSet, format *string, defaultFormat string) {
+	fs.StringVar(format, "format", defaultFormat, "output format: table, json or plain")
+}
+
+func (t *OutputTable) Print(format string) error {
+	switch format {
+	case FormatTable:
+		t.printTable()
+	case FormatJson:
+		return t.printJson()
+	case FormatPlain:
+		t.printPlain()
+	default:
+		return errors.New(fmt.Sprintf("unknown format %s, use one of: table, json, plain", format))
+	}
+
+	return nil
+}
+
+func (t *OutputTable) printTable() {
+	widths := make([]int, len(t.Columns))
+	header := make([]string, len(t.Columns))
+	for i, column := range t.Columns {
+		header[i] = strings.ToUpper(column)
+		widths[i] = len(header[i])
+	}
+	for _, row := range t.Rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	for _, row := range append([][]string{header}, t.Rows...) {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			if i < len(row)-1 {
+				cell = fmt.Sprintf("%-*s", widths[i], cell)
+			}
+			cells[i] = cell
+		}
+		_, _ = Pc.Println(strings.Join(cells, " "))
+	}
+}
+
+func (t *OutputTable) printJson() error {
+	items := make([]map[string]string, 0, len(t.Rows))
+	for _, row := range t.Rows {
+		item := make(map[string]string)
+		for i, cell := range row {
+			item[strings.ToLower(t.Columns[i])] = cell
+		}
+		items = append(items, item)
+	}
+
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, _ = Pc.Println(string(data))
+
+	return nil
+}
+
+func (t *OutputTable) printPlain() {
+	separator := t.Separator
+	if separator == "" {
+		separator = " "
+	}
+	for _, row := range t.Rows {
+		_, _ = Pc.Println(strings.Join(row, separator))
+	}
+}
@@ -1,30 +1,54 @@
 package src
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/mattn/go-isatty"
+	"io"
 	"io/ioutil"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/user"
+	"strings"
+	"sync"
+	"time"
 )
 
 type PC interface {
 	ExecInteractive(command []string, env []string) (int, error)
+	ExecInteractiveContext(ctx context.Context, command []string, env []string) (int, error)
 	ExecToString(command []string, env []string) (int, string, error)
+	ExecWithPrefix(command []string, env []string, prefix string) (int, error)
 	Args() []string
 	Exit(code int)
 	HomeDir() (string, error)
 	Getuid() int
 	Getwd() (dir string, err error)
+	Chdir(dir string) error
+	LookupEnv(key string) (string, bool)
+	Environ() []string
+	LookPath(file string) (string, error)
 	FileExists(filepath string) bool
 	ReadFile(filename string) ([]byte, error)
 	ReadDir(dirname string) ([]os.FileInfo, error)
 	WriteFile(filename string, data []byte, perm os.FileMode) error
+	FileMode(filename string) (os.FileMode, error)
+	Chmod(filename string, mode os.FileMode) error
 	Printf(format string, a ...interface{}) (n int, err error)
 	Println(a ...interface{}) (n int, err error)
+	Eprintf(format string, a ...interface{}) (n int, err error)
 	IsTerminal() bool
+	IsStdinTerminal() bool
+	ReadLine() (string, error)
+	IsPortFree(hostIP string, port string) bool
+	IsPortOpen(address string) bool
+	HttpGet(url string) ([]byte, error)
 }
 
 var Pc PC
@@ -43,6 +67,22 @@ func (r *RealPC) ExecInteractive(command []string, env []string) (int, error) {
 	return cmd.ProcessState.ExitCode(), err
 }
 
+// ExecInteractiveContext runs command like ExecInteractive, but kills it when ctx is done.
+func (r *RealPC) ExecInteractiveContext(ctx context.Context, command []string, env []string) (int, error) {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+	cmd.Env = env
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return cmd.ProcessState.ExitCode(), ctx.Err()
+	}
+
+	return cmd.ProcessState.ExitCode(), err
+}
+
 func (r *RealPC) ExecToString(command []string, env []string) (int, string, error) {
 	var buff bytes.Buffer
 	cmd := exec.Command(command[0], command[1:]...)
@@ -53,6 +93,37 @@ func (r *RealPC) ExecToString(command []string, env []string) (int, string, erro
 	return cmd.ProcessState.ExitCode(), buff.String(), err
 }
 
+var outputMutex sync.Mutex
+
+// ExecWithPrefix runs command and prints every line of its stdout and stderr with prefix,
+// so output of several commands running at once can be told apart.
+func (r *RealPC) ExecWithPrefix(command []string, env []string, prefix string) (int, error) {
+	reader, writer := io.Pipe()
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	cmd.Env = env
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer HandlePanic()
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			outputMutex.Lock()
+			fmt.Printf("%s%s\n", prefix, scanner.Text())
+			outputMutex.Unlock()
+		}
+		_, _ = io.Copy(ioutil.Discard, reader)
+	}()
+
+	err := cmd.Run()
+	_ = writer.Close()
+	<-done
+
+	return cmd.ProcessState.ExitCode(), err
+}
+
 func (r *RealPC) Args() []string {
 	return os.Args
 }
@@ -78,6 +149,22 @@ func (r *RealPC) Getwd() (dir string, err error) {
 	return os.Getwd()
 }
 
+func (r *RealPC) Chdir(dir string) error {
+	return os.Chdir(dir)
+}
+
+func (r *RealPC) LookupEnv(key string) (string, bool) {
+	return os.LookupEnv(key)
+}
+
+func (r *RealPC) Environ() []string {
+	return os.Environ()
+}
+
+func (r *RealPC) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
 func (r *RealPC) FileExists(filepath string) bool {
 	_, err := os.Stat(filepath)
 
@@ -96,6 +183,19 @@ func (r *RealPC) WriteFile(filename string, data []byte, perm os.FileMode) error
 	return ioutil.WriteFile(filename, data, perm)
 }
 
+func (r *RealPC) FileMode(filename string) (os.FileMode, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Mode().Perm(), nil
+}
+
+func (r *RealPC) Chmod(filename string, mode os.FileMode) error {
+	return os.Chmod(filename, mode)
+}
+
 func (r *RealPC) Printf(format string, a ...interface{}) (n int, err error) {
 	return fmt.Printf(format, a...)
 }
@@ -104,6 +204,121 @@ func (r *RealPC) Println(a ...interface{}) (n int, err error) {
 	return fmt.Println(a...)
 }
 
+func (r *RealPC) Eprintf(format string, a ...interface{}) (n int, err error) {
+	return fmt.Fprintf(os.Stderr, format, a...)
+}
+
 func (r *RealPC) IsTerminal() bool {
 	return isatty.IsTerminal(os.Stdout.Fd())
 }
+
+func (r *RealPC) IsStdinTerminal() bool {
+	return isatty.IsTerminal(os.Stdin.Fd())
+}
+
+func (r *RealPC) ReadLine() (string, error) {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	return strings.TrimSpace(line), nil
+}
+
+func (r *RealPC) IsPortFree(hostIP string, port string) bool {
+	listener, err := net.Listen("tcp", net.JoinHostPort(hostIP, port))
+	if err != nil {
+		return false
+	}
+	_ = listener.Close()
+
+	return true
+}
+
+func (r *RealPC) IsPortOpen(address string) bool {
+	conn, err := net.DialTimeout("tcp", address, time.Second)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+
+	return true
+}
+
+func (r *RealPC) HttpGet(url string) ([]byte, error) {
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("request to %s failed with status %s", url, resp.Status))
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// execLogPC writes every interactive command to log file as json line,
+// output of command is not affected.
+type execLogPC struct {
+	PC
+	logFile string
+}
+
+type execLogRecord struct {
+	Time    string   `json:"time"`
+	Command []string `json:"command"`
+	Code    int      `json:"code"`
+	Error   string   `json:"error,omitempty"`
+}
+
+func (r *execLogPC) ExecInteractive(command []string, env []string) (int, error) {
+	code, err := r.PC.ExecInteractive(command, env)
+
+	record := execLogRecord{Time: time.Now().Format(time.RFC3339), Command: command, Code: code}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	r.write(record)
+
+	return code, err
+}
+
+func (r *execLogPC) ExecInteractiveContext(ctx context.Context, command []string, env []string) (int, error) {
+	code, err := r.PC.ExecInteractiveContext(ctx, command, env)
+
+	record := execLogRecord{Time: time.Now().Format(time.RFC3339), Command: command, Code: code}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	r.write(record)
+
+	return code, err
+}
+
+// write appends record to log file, failure of logging must not break command, so errors are ignored.
+func (r *execLogPC) write(record execLogRecord) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(r.logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	_, _ = file.Write(append(data, '\n'))
+}
+
+// enableExecLog wraps Pc, so interactive commands are written to logFile.
+func enableExecLog(logFile string) {
+	if _, wrapped := Pc.(*execLogPC); wrapped {
+		return
+	}
+
+	Pc = &execLogPC{PC: Pc, logFile: logFile}
+}
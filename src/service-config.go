@@ -3,24 +3,89 @@ package src
 import (
 	"fmt"
 	"gopkg.in/yaml.v2"
+	"sort"
+	"strings"
 )
 
 type TemplateConfig struct {
-	Path        string        `yaml:"path"`
-	ComposeFile string        `yaml:"compose_file"`
-	Variables   yaml.MapSlice `yaml:"variables"`
+	Path        string    `yaml:"path"`
+	ComposeFile string    `yaml:"compose_file"`
+	Variables   Variables `yaml:"variables"`
+}
+
+// Variables keeps variables in the same order as they are written in config.
+type Variables yaml.MapSlice
+
+// UnmarshalYAML works around yaml.v2, which drops keys merged with '<<' when decodes yaml.MapSlice.
+// Merged keys go before own keys of mapping in alphabetical order, because their original order is lost.
+func (vars *Variables) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var own yaml.MapSlice
+	err := unmarshal(&own)
+	if err != nil {
+		return err
+	}
+
+	var all map[string]interface{}
+	err = unmarshal(&all)
+	if err != nil {
+		return err
+	}
+
+	ownKeys := make(map[string]bool)
+	for _, item := range own {
+		ownKeys[fmt.Sprint(item.Key)] = true
+	}
+
+	mergedKeys := make([]string, 0)
+	for key := range all {
+		if !ownKeys[key] {
+			mergedKeys = append(mergedKeys, key)
+		}
+	}
+	sort.Strings(mergedKeys)
+
+	result := make(Variables, 0, len(all))
+	for _, key := range mergedKeys {
+		result = append(result, yaml.MapItem{Key: key, Value: all[key]})
+	}
+	*vars = append(result, own...)
+
+	return nil
+}
+
+func (vars Variables) MarshalYAML() (interface{}, error) {
+	return yaml.MapSlice(vars), nil
 }
 
 type ServiceConfig struct {
 	TemplateConfig `yaml:",inline"`
 	Extends        string              `yaml:"extends"`
 	Dependencies   map[string][]string `yaml:"dependencies"`
+	ExecPath       string              `yaml:"exec_path"`
+	DefaultUID     *int                `yaml:"default_uid"`
+	BeforeStart    []string            `yaml:"before_start"`
+	AfterStart     []string            `yaml:"after_start"`
+	WaitFor        string              `yaml:"wait_for"`
+	ComposeFiles   []string            `yaml:"compose_files"`
 }
 
+// Relative exec_path of module is resolved from one of bases:
+// container - path is passed to container as is, it is the default,
+// service - from exec_path of hosting service, which is usually root of its repository in container,
+// module - from directory of module in container, i.e. its path relative to hosting service is appended to exec_path of service.
+const (
+	ExecPathBaseContainer = "container"
+	ExecPathBaseService   = "service"
+	ExecPathBaseModule    = "module"
+)
+
+var execPathBases = []string{ExecPathBaseContainer, ExecPathBaseService, ExecPathBaseModule}
+
 type ModuleConfig struct {
-	Path     string `yaml:"path"`
-	HostedIn string `yaml:"hosted_in"`
-	ExecPath string `yaml:"exec_path"`
+	Path         string `yaml:"path"`
+	HostedIn     string `yaml:"hosted_in"`
+	ExecPath     string `yaml:"exec_path"`
+	ExecPathBase string `yaml:"exec_path_base"`
 }
 
 func (svcCfg *TemplateConfig) GetEnv() []string {
@@ -32,13 +97,20 @@ func (svcCfg *TemplateConfig) GetEnv() []string {
 	return env
 }
 
+// GetDeps returns dependencies tagged with mode. Mode may contain several tags separated by comma,
+// then dependency is selected if it is tagged with any of them.
 func (svcCfg *ServiceConfig) GetDeps(mode string) []string {
+	tags := strings.Split(mode, ",")
 	var result []string
 	for key, modes := range svcCfg.Dependencies {
-		if contains(modes, mode) {
-			result = append(result, key)
+		for _, tag := range tags {
+			if tag != "" && contains(modes, tag) {
+				result = append(result, key)
+				break
+			}
 		}
 	}
+	sort.Strings(result)
 
 	return result
 }
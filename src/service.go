@@ -1,9 +1,18 @@
 package src
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"path"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Service struct {
@@ -14,8 +23,13 @@ type Service struct {
 }
 
 func CreateFromSvcName(cfg *MainConfig, svcName string) (*Service, error) {
+	cfg = cfg.findServiceOwner(svcName)
 	svc, realName, err := cfg.FindServiceByName(svcName)
 	if err != nil {
+		suggestions := closestNames(svcName, cfg.GetAllSvcNames(), 3)
+		if len(suggestions) > 0 {
+			return nil, errors.New(fmt.Sprintf("%s, did you mean: %s?", err, strings.Join(suggestions, ", ")))
+		}
 		return nil, err
 	}
 	sts := Service{Config: cfg, Name: realName}
@@ -38,7 +52,7 @@ func (svc *Service) GetEnv() (Context, error) {
 	}
 
 	ctx = ctx.add("APP_NAME", svc.Name)
-	ctx = ctx.add("COMPOSE_PROJECT_NAME", fmt.Sprintf("%s-%s", svc.Config.Name, svc.Name))
+	ctx = ctx.add("COMPOSE_PROJECT_NAME", svc.Config.composeProjectName(svc.Name))
 
 	svcPath, err := substVars(svc.SvcCfg.Path, ctx)
 	if err != nil {
@@ -58,11 +72,10 @@ func (svc *Service) GetEnv() (Context, error) {
 		}
 		ctx = ctx.add("COMPOSE_FILE", composeFile)
 		for _, pair := range svc.TplCfg.Variables {
-			value, err := substVars(pair.Value.(string), ctx)
+			ctx, err = ctx.addVariable(pair, svc.Config.Overrides)
 			if err != nil {
 				return nil, err
 			}
-			ctx = ctx.add(pair.Key.(string), value)
 		}
 
 		composeFile, found := ctx.find("COMPOSE_FILE")
@@ -83,6 +96,18 @@ func (svc *Service) GetEnv() (Context, error) {
 		ctx = ctx.add("COMPOSE_FILE", composeFile)
 	}
 
+	if len(svc.SvcCfg.ComposeFiles) > 0 {
+		composeFiles := make([]string, 0, len(svc.SvcCfg.ComposeFiles))
+		for _, file := range svc.SvcCfg.ComposeFiles {
+			composeFile, err := substVars(file, ctx)
+			if err != nil {
+				return nil, err
+			}
+			composeFiles = append(composeFiles, composeFile)
+		}
+		ctx = ctx.add("COMPOSE_FILE", strings.Join(composeFiles, composeFileSeparator))
+	}
+
 	composeFile, found := ctx.find("COMPOSE_FILE")
 	if !found || composeFile == "" {
 		composeFile, err := substVars("${SVC_PATH}/docker-compose.yml", ctx)
@@ -93,28 +118,49 @@ func (svc *Service) GetEnv() (Context, error) {
 	}
 
 	for _, pair := range svc.SvcCfg.Variables {
-		value, err := substVars(pair.Value.(string), ctx)
+		ctx, err = ctx.addVariable(pair, svc.Config.Overrides)
 		if err != nil {
 			return nil, err
 		}
-		ctx = ctx.add(pair.Key.(string), value)
+	}
+
+	for _, pair := range svc.Config.Overrides {
+		ctx = ctx.add(pair[0], pair[1])
 	}
 
 	return ctx, nil
 }
 
-func (svc *Service) execComposeToString(composeCommand []string) (string, error) {
+func (svc *Service) renderPath(path string) (string, error) {
 	ctx, err := svc.GetEnv()
 	if err != nil {
 		return "", err
 	}
+	return substVars(path, ctx)
+}
+
+// composeCommand returns command line of compose tool for service and environment to run it with.
+func (svc *Service) composeCommand(composeCommand []string) ([]string, Context, error) {
+	ctx, err := svc.GetEnv()
+	if err != nil {
+		return nil, nil, err
+	}
 
 	composeFile, found := ctx.find("COMPOSE_FILE")
 	if !found {
-		return "", errors.New("compose file is not defined in service or template")
+		return nil, nil, errors.New("compose file is not defined in service or template")
 	}
 
-	command := append([]string{"docker", "compose", "-f", composeFile}, composeCommand...)
+	return svc.Config.Runner.ComposeCommand(splitComposeFiles(composeFile), composeCommand), ctx, nil
+}
+
+func (svc *Service) execComposeToString(composeCommand []string) (string, error) {
+	command, ctx, err := svc.composeCommand(composeCommand)
+	if err != nil {
+		return "", err
+	}
+
+	defer MeasureTime(fmt.Sprintf("%s: compose %s", svc.Name, strings.Join(composeCommand, " ")), time.Now())
 	_, out, err := Pc.ExecToString(command, ctx.renderMapToEnv())
 	if err != nil {
 		return "", err
@@ -124,18 +170,18 @@ func (svc *Service) execComposeToString(composeCommand []string) (string, error)
 }
 
 func (svc *Service) execComposeInteractive(composeCommand []string) (int, error) {
-	ctx, err := svc.GetEnv()
+	return svc.execComposeInteractiveUntil(composeCommand, time.Time{})
+}
+
+// execComposeInteractiveUntil runs compose command, which is killed at deadline, if deadline is set.
+func (svc *Service) execComposeInteractiveUntil(composeCommand []string, deadline time.Time) (int, error) {
+	command, ctx, err := svc.composeCommand(composeCommand)
 	if err != nil {
 		return 0, err
 	}
 
-	composeFile, found := ctx.find("COMPOSE_FILE")
-	if !found {
-		return 0, errors.New("compose file is not defined in service or template")
-	}
-
-	command := append([]string{"docker", "compose", "-f", composeFile}, composeCommand...)
-	code, err := Pc.ExecInteractive(command, ctx.renderMapToEnv())
+	defer MeasureTime(fmt.Sprintf("%s: compose %s", svc.Name, strings.Join(composeCommand, " ")), time.Now())
+	code, err := svc.execInteractiveUntil(command, ctx, ctx.renderMapToEnv(), deadline)
 	if err != nil {
 		return 0, err
 	}
@@ -143,6 +189,28 @@ func (svc *Service) execComposeInteractive(composeCommand []string) (int, error)
 	return code, nil
 }
 
+// execInteractive runs command or only prints it with variables of ctx, if --print-cmd is passed.
+// Values of secret variables are printed masked, unless --show-secrets is passed too.
+func (svc *Service) execInteractive(command []string, ctx Context, env []string) (int, error) {
+	return svc.execInteractiveUntil(command, ctx, env, time.Time{})
+}
+
+// execInteractiveUntil is execInteractive, which kills command at deadline, if deadline is set.
+func (svc *Service) execInteractiveUntil(command []string, ctx Context, env []string, deadline time.Time) (int, error) {
+	if svc.Config.PrintCmd {
+		_, _ = Pc.Println(formatCommand(svc.Config.maskSecrets(ctx, svc.Config.ShowSecrets), command))
+		return 0, nil
+	}
+	if deadline.IsZero() {
+		return Pc.ExecInteractive(command, env)
+	}
+
+	execCtx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	return Pc.ExecInteractiveContext(execCtx, command, env)
+}
+
 func (svc *Service) IsRunning() (bool, error) {
 	out, err := svc.execComposeToString([]string{"ps", "--status=running", "-q"})
 	if err != nil {
@@ -152,38 +220,343 @@ func (svc *Service) IsRunning() (bool, error) {
 	return out != "", nil
 }
 
+// isRunningForShutdown treats service without compose file as stopped,
+// so stop and destroy of never cloned service are not errors.
+func (svc *Service) isRunningForShutdown() (bool, error) {
+	running, err := svc.IsRunning()
+	if err == nil {
+		return running, nil
+	}
+
+	if svc.composeFileMissing() {
+		Debug("compose file of service %s is not found, it is treated as stopped\n", svc.Name)
+		return false, nil
+	}
+
+	return false, err
+}
+
+// composeFileMissing reports if any of compose files of service does not exist, eg. service is not cloned yet.
+func (svc *Service) composeFileMissing() bool {
+	ctx, err := svc.GetEnv()
+	if err != nil {
+		return false
+	}
+	composeFile, found := ctx.find("COMPOSE_FILE")
+	if found {
+		for _, file := range splitComposeFiles(composeFile) {
+			if !Pc.FileExists(file) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (svc *Service) Checksum() (string, error) {
+	ctx, err := svc.GetEnv()
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	_, _ = hash.Write([]byte(strings.Join(ctx.renderMapToEnv(), "\n")))
+
+	composeFile, found := ctx.find("COMPOSE_FILE")
+	if found {
+		for _, file := range splitComposeFiles(composeFile) {
+			if !Pc.FileExists(file) {
+				continue
+			}
+			data, err := Pc.ReadFile(file)
+			if err != nil {
+				return "", err
+			}
+			_, _ = hash.Write(data)
+		}
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
 type SvcStartParams struct {
-	Force bool
-	Mode  string
+	Force       bool
+	Mode        string
+	DepTimeout  time.Duration
+	NoPortCheck bool
+	deadline    time.Time
+	// started collects names of services, which start was begun, including dependencies
+	started *[]string
+}
+
+// startProgress prints which service of dependency graph is started, e.g. [3/10] starting service X.
+// Total is the number of services in graph, services which are already running are counted silently.
+type startProgress struct {
+	total   int
+	done    []string
+	printed bool
+	inPlace bool
+}
+
+func newStartProgress(total int) *startProgress {
+	return &startProgress{total: total}
+}
+
+func (p *startProgress) step(name string) {
+	p.skip([]string{name})
+	if Globals.Quiet {
+		return
+	}
+	if !p.printed {
+		p.printed = true
+		p.inPlace = Pc.IsTerminal()
+	}
+
+	message := fmt.Sprintf("[%d/%d] starting service %s", len(p.done), p.total, name)
+	if p.inPlace {
+		Info("\r\033[K%s", message)
+	} else {
+		Info("%s\n", message)
+	}
+}
+
+// skip marks services, which are not started because they are already running, as done.
+func (p *startProgress) skip(names []string) {
+	for _, name := range names {
+		if !contains(p.done, name) {
+			p.done = append(p.done, name)
+		}
+	}
+}
+
+func (p *startProgress) finish() {
+	if p.printed && p.inPlace {
+		Info("\n")
+	}
+}
+
+// collectStarts returns names of service and its dependencies in mode, which will be visited by Start.
+func collectStarts(cfg *MainConfig, name string, mode string, visited []string) []string {
+	if contains(visited, name) {
+		return visited
+	}
+	visited = append(visited, name)
+
+	owner := cfg.findServiceOwner(name)
+	svcCfg, _, err := owner.FindServiceByName(name)
+	if err != nil {
+		return visited
+	}
+	for _, depName := range svcCfg.GetDeps(mode) {
+		visited = collectStarts(cfg, depName, mode, visited)
+	}
+
+	return visited
 }
 
 func (svc *Service) Start(params *SvcStartParams) error {
-	svc.Config.WillStart = append(svc.Config.WillStart, svc.Name)
+	running, err := svc.IsRunning()
+	if err != nil {
+		return err
+	}
+
+	return svc.startWithState(params, running)
+}
+
+// startWithState starts service and its dependencies, when caller has already checked that service is running.
+// Deadline of dependencies is computed for every started service, so params can be shared by several starts.
+func (svc *Service) startWithState(params *SvcStartParams, running bool) error {
+	startParams := *params
+	startParams.deadline = time.Time{}
+	if params.DepTimeout > 0 {
+		startParams.deadline = time.Now().Add(params.DepTimeout)
+	}
+	params = &startParams
+
+	var progress *startProgress
+	willStart := append([]string{}, svc.Config.WillStart...)
+	graph := collectStarts(svc.Config, svc.Name, params.Mode, willStart)[len(willStart):]
+	if len(graph) > 1 {
+		progress = newStartProgress(len(graph))
+		defer progress.finish()
+	}
 
+	return svc.start(params, progress, running, time.Time{})
+}
+
+func (svc *Service) startDependency(params *SvcStartParams, progress *startProgress) error {
 	running, err := svc.IsRunning()
 	if err != nil {
 		return err
 	}
 
+	return svc.start(params, progress, running, params.deadline)
+}
+
+// start starts service and its dependencies, commands of start are killed at deadline, if it is set.
+func (svc *Service) start(params *SvcStartParams, progress *startProgress, running bool, deadline time.Time) error {
+	defer MeasureTime(fmt.Sprintf("%s: start", svc.Name), time.Now())
+	svc.Config.WillStart = append(svc.Config.WillStart, svc.Name)
+
+	if progress != nil {
+		if running {
+			progress.skip([]string{svc.Name})
+		} else {
+			progress.step(svc.Name)
+		}
+	}
+
 	if !running || params.Force {
-		err := svc.startDependencies(params)
+		err := svc.startDependencies(params, progress)
 		if err != nil {
 			return err
 		}
+	} else if progress != nil {
+		progress.skip(collectStarts(svc.Config, svc.Name, params.Mode, []string{}))
 	}
 
+	var err error
 	if !running {
-		_, err = svc.execComposeInteractive([]string{"up", "-d"})
+		if !params.NoPortCheck && !svc.Config.PrintCmd {
+			err = svc.checkPorts()
+			if err != nil {
+				return err
+			}
+		}
+
+		err = svc.runHooks("before_start", svc.SvcCfg.BeforeStart, deadline)
+		if err != nil {
+			return err
+		}
+
+		if params.started != nil {
+			*params.started = append(*params.started, svc.Name)
+		}
+		_, err = svc.execComposeInteractiveUntil([]string{"up", "-d"}, deadline)
+		if err != nil {
+			return err
+		}
+
+		err = svc.waitForPort(deadline)
 		if err != nil {
 			return err
 		}
+
+		err = svc.runHooks("after_start", svc.SvcCfg.AfterStart, deadline)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var waitForTimeout = time.Minute
+var waitForInterval = time.Second
+
+// waitForPort polls address from wait_for option until it accepts connections.
+// Deadline of dependencies is used as timeout if it is set.
+func (svc *Service) waitForPort(deadline time.Time) error {
+	if svc.SvcCfg.WaitFor == "" || svc.Config.PrintCmd {
+		return nil
+	}
+
+	address, err := svc.renderPath(svc.SvcCfg.WaitFor)
+	if err != nil {
+		return err
+	}
+
+	if deadline.IsZero() {
+		deadline = time.Now().Add(waitForTimeout)
+	}
+
+	for !Pc.IsPortOpen(address) {
+		if time.Now().After(deadline) {
+			return errors.New(fmt.Sprintf("service %s is not available at %s", svc.Name, address))
+		}
+		time.Sleep(waitForInterval)
+	}
+
+	return nil
+}
+
+type composePortsConfig struct {
+	Services map[string]struct {
+		Ports []struct {
+			HostIP    string `yaml:"host_ip"`
+			Published string `yaml:"published"`
+		} `yaml:"ports"`
+	} `yaml:"services"`
+}
+
+// checkPorts fails if any port published by service is already in use,
+// and tries to find container which occupies it.
+func (svc *Service) checkPorts() error {
+	out, err := svc.execComposeToString([]string{"config"})
+	if err != nil {
+		return err
+	}
+
+	composeCfg := composePortsConfig{}
+	err = yaml.Unmarshal([]byte(out), &composeCfg)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(composeCfg.Services))
+	for name := range composeCfg.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, port := range composeCfg.Services[name].Ports {
+			if port.Published == "" || Pc.IsPortFree(port.HostIP, port.Published) {
+				continue
+			}
+
+			_, owner, err := Pc.ExecToString(svc.Config.Runner.EngineCommand([]string{"ps", "--filter", "publish=" + port.Published, "--format", "{{.Names}}"}), nil)
+			owner = strings.Join(strings.Fields(owner), ", ")
+			if err != nil || owner == "" {
+				return errors.New(fmt.Sprintf("port %s required by service %s is already in use", port.Published, svc.Name))
+			}
+
+			return errors.New(fmt.Sprintf("port %s required by service %s is already in use by %s", port.Published, svc.Name, owner))
+		}
+	}
+
+	return nil
+}
+
+func (svc *Service) runHooks(stage string, commands []string, deadline time.Time) error {
+	if len(commands) == 0 {
+		return nil
+	}
+
+	ctx, err := svc.GetEnv()
+	if err != nil {
+		return err
+	}
+
+	for _, command := range commands {
+		code, err := svc.execInteractiveUntil([]string{"bash", "-c", command}, ctx, ctx.renderMapToHostEnv(), deadline)
+		if err != nil {
+			return errors.New(fmt.Sprintf("%s hook '%s' of service %s failed: %s", stage, command, svc.Name, err))
+		}
+		if code != 0 {
+			return errors.New(fmt.Sprintf("%s hook '%s' of service %s failed with code %d", stage, command, svc.Name, code))
+		}
 	}
 
 	return nil
 }
 
-func (svc *Service) startDependencies(params *SvcStartParams) error {
-	for _, depName := range svc.SvcCfg.GetDeps(params.Mode) {
+// startDependencies starts dependencies selected by params.Mode. Dependencies of dependencies are
+// selected by the same mode, so the whole tree is started in mode of the first service.
+func (svc *Service) startDependencies(params *SvcStartParams, progress *startProgress) error {
+	depNames := svc.SvcCfg.GetDeps(params.Mode)
+	for i, depName := range depNames {
 		if contains(svc.Config.WillStart, depName) {
 			continue
 		}
@@ -193,7 +566,17 @@ func (svc *Service) startDependencies(params *SvcStartParams) error {
 			return err
 		}
 
-		err = depSvc.Start(params)
+		pending := []string{depName}
+		for _, name := range depNames[i+1:] {
+			if !contains(svc.Config.WillStart, name) {
+				pending = append(pending, name)
+			}
+		}
+
+		err = depSvc.startDependency(params, progress)
+		if err != nil && !params.deadline.IsZero() && !time.Now().Before(params.deadline) {
+			return errors.New(fmt.Sprintf("dependencies of service %s are not started in %s: %s", svc.Name, params.DepTimeout, strings.Join(pending, ", ")))
+		}
 		if err != nil {
 			return err
 		}
@@ -202,8 +585,13 @@ func (svc *Service) startDependencies(params *SvcStartParams) error {
 	return nil
 }
 
-func (svc *Service) Stop() error {
-	running, err := svc.IsRunning()
+type SvcStopParams struct {
+	RemoveOrphans bool
+}
+
+func (svc *Service) Stop(params *SvcStopParams) error {
+	defer MeasureTime(fmt.Sprintf("%s: stop", svc.Name), time.Now())
+	running, err := svc.isRunningForShutdown()
 	if err != nil {
 		return err
 	}
@@ -213,48 +601,196 @@ func (svc *Service) Stop() error {
 			return err
 		}
 	}
+	if params.RemoveOrphans {
+		return svc.removeOrphans()
+	}
 
 	return nil
 }
 
-func (svc *Service) Destroy() error {
-	running, err := svc.IsRunning()
+func (svc *Service) Destroy(params *SvcStopParams) error {
+	defer MeasureTime(fmt.Sprintf("%s: destroy", svc.Name), time.Now())
+	running, err := svc.isRunningForShutdown()
 	if err != nil {
 		return err
 	}
 	if running {
-		_, err := svc.execComposeInteractive([]string{"down"})
+		command := []string{"down"}
+		if params.RemoveOrphans {
+			command = append(command, "--remove-orphans")
+		}
+		_, err := svc.execComposeInteractive(command)
 		if err != nil {
 			return err
 		}
+	} else if params.RemoveOrphans {
+		return svc.removeOrphans()
 	}
 
 	return nil
 }
 
+// removeOrphans removes containers of compose project of service, which services are not defined in compose file anymore.
+// 'compose stop' has no option for that, so containers are found by labels.
+// Service without compose file has nothing to compare with, so it is skipped.
+func (svc *Service) removeOrphans() error {
+	if svc.composeFileMissing() {
+		return nil
+	}
+
+	out, err := svc.execComposeToString([]string{"config", "--services"})
+	if err != nil {
+		return err
+	}
+	composeServices := strings.Fields(out)
+
+	label := "label=com.docker.compose.project=" + svc.Config.composeProjectName(svc.Name)
+	command := svc.Config.Runner.EngineCommand([]string{"ps", "-a", "--filter", label, "--format", "{{.ID}} {{.Label \"com.docker.compose.service\"}}"})
+	_, out, err = Pc.ExecToString(command, nil)
+	if err != nil {
+		return err
+	}
+
+	orphans := make([]string, 0)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && !contains(composeServices, fields[1]) {
+			orphans = append(orphans, fields[0])
+		}
+	}
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	_, err = Pc.ExecInteractive(svc.Config.Runner.EngineCommand(append([]string{"rm", "-f"}, orphans...)), nil)
+	return err
+}
+
 type SvcRestartParams struct {
-	Hard bool
+	Hard    bool
+	Rolling bool
+	Start   SvcStartParams
 }
 
-func (svc *Service) Restart(params *SvcRestartParams) error {
-	var err error
+func (svc *Service) Shutdown(params *SvcRestartParams) error {
 	if params.Hard {
-		err = svc.Destroy()
+		return svc.Destroy(&SvcStopParams{})
+	}
+
+	return svc.Stop(&SvcStopParams{})
+}
+
+func (svc *Service) Restart(params *SvcRestartParams) error {
+	if params.Rolling {
+		return svc.rollingRestart()
+	}
+
+	err := svc.Shutdown(params)
+	if err != nil {
+		return err
+	}
+	err = svc.Start(&params.Start)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+const containerStatusFormat = "{{if .State.Health}}{{.State.Health.Status}}{{else}}{{.State.Status}}{{end}}"
+
+// rollingRestart restarts running containers of service one by one. Next container is restarted
+// only when previous one is healthy, or just running if it has no healthcheck, so replicas of service
+// keep serving requests.
+func (svc *Service) rollingRestart() error {
+	defer MeasureTime(fmt.Sprintf("%s: rolling restart", svc.Name), time.Now())
+	out, err := svc.execComposeToString([]string{"ps", "--status=running", "-q"})
+	if err != nil {
+		return err
+	}
+
+	containers := strings.Fields(out)
+	if len(containers) == 0 {
+		return errors.New(fmt.Sprintf("service %s is not running", svc.Name))
+	}
+
+	for _, container := range containers {
+		_, err = Pc.ExecInteractive(svc.Config.Runner.EngineCommand([]string{"restart", container}), nil)
 		if err != nil {
 			return err
 		}
-	} else {
-		err = svc.Stop()
+
+		err = svc.waitForHealthy(container)
 		if err != nil {
 			return err
 		}
 	}
-	err = svc.Start(&SvcStartParams{})
+
+	return nil
+}
+
+func (svc *Service) waitForHealthy(container string) error {
+	deadline := time.Now().Add(waitForTimeout)
+	for {
+		_, status, err := Pc.ExecToString(svc.Config.Runner.EngineCommand([]string{"inspect", "-f", containerStatusFormat, container}), nil)
+		if err != nil {
+			return err
+		}
+
+		status = strings.TrimSpace(status)
+		if status == "healthy" || status == "running" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.New(fmt.Sprintf("container %s of service %s is %s after restart", container, svc.Name, status))
+		}
+		time.Sleep(waitForInterval)
+	}
+}
+
+// moduleWorkingDir returns exec_path of module hosted in service, relative path is resolved from exec_path_base.
+func (svc *Service) moduleWorkingDir(mdl *ModuleConfig) (string, error) {
+	execPath, err := svc.Config.renderPath(mdl.ExecPath)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return nil
+	base := mdl.ExecPathBase
+	if base == "" {
+		base = ExecPathBaseContainer
+	}
+	if base == ExecPathBaseContainer || path.IsAbs(execPath) {
+		return execPath, nil
+	}
+	if !contains(execPathBases, base) {
+		return "", errors.New(fmt.Sprintf("unknown exec_path_base %s, use one of: %s", base, strings.Join(execPathBases, ", ")))
+	}
+
+	if svc.SvcCfg.ExecPath == "" {
+		return "", errors.New(fmt.Sprintf("exec_path of service %s is required to resolve exec_path of module from %s", svc.Name, base))
+	}
+	svcExecPath, err := svc.renderPath(svc.SvcCfg.ExecPath)
+	if err != nil {
+		return "", err
+	}
+
+	if base == ExecPathBaseService {
+		return path.Join(svcExecPath, execPath), nil
+	}
+
+	svcPath, err := svc.renderPath("${SVC_PATH}")
+	if err != nil {
+		return "", err
+	}
+	mdlPath, err := svc.Config.renderPath(mdl.Path)
+	if err != nil {
+		return "", err
+	}
+	if !isSubPath(mdlPath, svcPath) {
+		return "", errors.New(fmt.Sprintf("module at %s is not inside of service %s, so it has no directory in container", mdlPath, svc.Name))
+	}
+
+	return path.Join(svcExecPath, strings.TrimPrefix(path.Clean(mdlPath), path.Clean(svcPath)), execPath), nil
 }
 
 type SvcComposeParams struct {
@@ -262,6 +798,97 @@ type SvcComposeParams struct {
 	SvcName string
 }
 
+// Recreate creates new containers of service even if their configuration and image are not changed.
+func (svc *Service) Recreate() error {
+	defer MeasureTime(fmt.Sprintf("%s: recreate", svc.Name), time.Now())
+	_, err := svc.execComposeInteractive([]string{"up", "-d", "--force-recreate"})
+
+	return err
+}
+
+func (svc *Service) Build() error {
+	defer MeasureTime(fmt.Sprintf("%s: build", svc.Name), time.Now())
+	code, err := svc.execComposeInteractive([]string{"build"})
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return errors.New(fmt.Sprintf("build of service %s failed with code %d", svc.Name, code))
+	}
+
+	return nil
+}
+
+type composeBuildConfig struct {
+	Services map[string]struct {
+		Build struct {
+			Context string `yaml:"context"`
+		} `yaml:"build"`
+	} `yaml:"services"`
+}
+
+// BuildChecksum returns hash of compose config and of names, sizes and modification times of files
+// in build contexts of service. Empty checksum means that service has nothing to build.
+func (svc *Service) BuildChecksum() (string, error) {
+	out, err := svc.execComposeToString([]string{"config"})
+	if err != nil {
+		return "", err
+	}
+
+	composeConfig := composeBuildConfig{}
+	err = yaml.Unmarshal([]byte(out), &composeConfig)
+	if err != nil {
+		return "", err
+	}
+
+	contexts := make([]string, 0)
+	for _, composeSvc := range composeConfig.Services {
+		context := composeSvc.Build.Context
+		if context != "" && !contains(contexts, context) {
+			contexts = append(contexts, context)
+		}
+	}
+	if len(contexts) == 0 {
+		return "", nil
+	}
+	sort.Strings(contexts)
+
+	hash := sha256.New()
+	_, _ = hash.Write([]byte(out))
+	for _, context := range contexts {
+		err = hashDir(hash, context)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+func hashDir(hash io.Writer, dir string) error {
+	files, err := Pc.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		filePath := path.Join(dir, file.Name())
+		if file.IsDir() {
+			if file.Name() == ".git" {
+				continue
+			}
+			err = hashDir(hash, filePath)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		_, _ = fmt.Fprintf(hash, "%s %d %d\n", filePath, file.Size(), file.ModTime().UnixNano())
+	}
+
+	return nil
+}
+
 func (svc *Service) Compose(params *SvcComposeParams) (int, error) {
 	code, err := svc.execComposeInteractive(params.Cmd)
 	if err != nil {
@@ -271,32 +898,100 @@ func (svc *Service) Compose(params *SvcComposeParams) (int, error) {
 	return code, nil
 }
 
+type SvcLogsParams struct {
+	Follow bool
+	Since  string
+	Until  string
+	Tail   string
+}
+
+func (params *SvcLogsParams) command() []string {
+	command := []string{"logs"}
+	if params.Follow {
+		command = append(command, "--follow")
+	}
+	if params.Since != "" {
+		command = append(command, "--since", params.Since)
+	}
+	if params.Until != "" {
+		command = append(command, "--until", params.Until)
+	}
+	if params.Tail != "" && params.Tail != "all" {
+		command = append(command, "--tail", params.Tail)
+	}
+
+	return command
+}
+
+// Logs prints logs of service, every line is prefixed with prefix if it is not empty.
+func (svc *Service) Logs(params *SvcLogsParams, prefix string) error {
+	if prefix == "" {
+		_, err := svc.execComposeInteractive(params.command())
+		return err
+	}
+
+	command, ctx, err := svc.composeCommand(params.command())
+	if err != nil {
+		return err
+	}
+
+	_, err = Pc.ExecWithPrefix(command, ctx.renderMapToEnv(), prefix)
+
+	return err
+}
+
 type SvcExecParams struct {
 	SvcComposeParams
 	SvcStartParams
 	WorkingDir string
 	UID        int
+	User       string
+	Detach     bool
+	NoTTY      bool
+	DetachKeys string
 }
 
 func (svc *Service) Exec(params *SvcExecParams) (int, error) {
-	err := svc.Start(&params.SvcStartParams)
+	// Start of running service is skipped, so exec into started environment costs one compose call,
+	// but forced dependencies must be checked anyway.
+	running, err := svc.IsRunning()
 	if err != nil {
 		return 0, err
 	}
+	if !running || params.Force {
+		err = svc.startWithState(&params.SvcStartParams, running)
+		if err != nil {
+			return 0, err
+		}
+	}
 
-	command := []string{"exec"}
+	options := make([]string, 0)
 	if params.WorkingDir != "" {
-		command = append(command, "-w", params.WorkingDir)
+		options = append(options, "-w", params.WorkingDir)
+	}
+	if params.User != "" {
+		options = append(options, "--user", params.User)
+	} else if params.UID > -1 {
+		options = append(options, "-u", strconv.Itoa(params.UID))
 	}
-	if params.UID > -1 {
-		command = append(command, "-u", strconv.Itoa(params.UID))
+
+	interactive := !params.Detach && !params.NoTTY && Pc.IsTerminal()
+	if interactive && !svc.Config.PrintCmd {
+		setTerminalTitle(fmt.Sprintf("elc: %s/%s", svc.Config.Name, svc.Name))
+		defer setTerminalTitle("")
+	}
+
+	if params.DetachKeys != "" {
+		return svc.engineExec(params, options, interactive)
 	}
 
-	if !Pc.IsTerminal() {
+	command := append([]string{"exec"}, options...)
+	if params.Detach {
+		command = append(command, "-d", "-T")
+	} else if !interactive {
 		command = append(command, "-T")
 	}
 	command = append(command, "app")
-
 	command = append(command, params.Cmd...)
 	code, err := svc.execComposeInteractive(command)
 	if err != nil {
@@ -306,14 +1001,230 @@ func (svc *Service) Exec(params *SvcExecParams) (int, error) {
 	return code, nil
 }
 
-func (svc *Service) DumpVars() error {
+// engineExec runs command in container of service with container engine instead of compose,
+// because compose exec has no --detach-keys option.
+func (svc *Service) engineExec(params *SvcExecParams, options []string, interactive bool) (int, error) {
+	out, err := svc.execComposeToString([]string{"ps", "-q", "app"})
+	if err != nil {
+		return 0, err
+	}
+	containers := strings.Fields(out)
+	if len(containers) == 0 {
+		return 0, errors.New(fmt.Sprintf("container of service %s is not running", svc.Name))
+	}
+
+	command := append([]string{"exec", "--detach-keys", params.DetachKeys}, options...)
+	if params.Detach {
+		command = append(command, "-d")
+	} else if interactive {
+		command = append(command, "-i", "-t")
+	} else {
+		command = append(command, "-i")
+	}
+	command = append(command, containers[0])
+	command = append(command, params.Cmd...)
+
+	ctx, err := svc.GetEnv()
+	if err != nil {
+		return 0, err
+	}
+
+	return svc.execInteractive(svc.Config.Runner.EngineCommand(command), ctx, ctx.renderMapToEnv())
+}
+
+type SvcInfo struct {
+	Name         string              `json:"name"`
+	Path         string              `json:"path"`
+	ComposeFile  string              `json:"compose_file"`
+	Extends      string              `json:"extends,omitempty"`
+	Aliases      []string            `json:"aliases"`
+	Dependencies map[string][]string `json:"dependencies"`
+	Modules      []string            `json:"modules"`
+}
+
+// Info collects configuration of service with rendered paths.
+func (svc *Service) Info() (*SvcInfo, error) {
+	ctx, err := svc.GetEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &SvcInfo{
+		Name:         svc.Name,
+		Extends:      svc.SvcCfg.Extends,
+		Aliases:      make([]string, 0),
+		Dependencies: make(map[string][]string),
+		Modules:      make([]string, 0),
+	}
+	info.Path, _ = ctx.find("SVC_PATH")
+	info.ComposeFile, _ = ctx.find("COMPOSE_FILE")
+
+	for alias, name := range svc.Config.Aliases {
+		if name == svc.Name {
+			info.Aliases = append(info.Aliases, alias)
+		}
+	}
+	sort.Strings(info.Aliases)
+
+	for depName, modes := range svc.SvcCfg.Dependencies {
+		info.Dependencies[depName] = modes
+	}
+
+	for mdlName, mdl := range svc.Config.Modules {
+		if mdl.HostedIn == svc.Name {
+			info.Modules = append(info.Modules, mdlName)
+		}
+	}
+	sort.Strings(info.Modules)
+
+	return info, nil
+}
+
+func (info *SvcInfo) Print() {
+	_, _ = Pc.Printf("%-14s %s\n", "name:", info.Name)
+	_, _ = Pc.Printf("%-14s %s\n", "path:", info.Path)
+	_, _ = Pc.Printf("%-14s %s\n", "compose file:", info.ComposeFile)
+	if info.Extends != "" {
+		_, _ = Pc.Printf("%-14s %s\n", "extends:", info.Extends)
+	}
+	if len(info.Aliases) > 0 {
+		_, _ = Pc.Printf("%-14s %s\n", "aliases:", strings.Join(info.Aliases, ", "))
+	}
+
+	if len(info.Dependencies) > 0 {
+		_, _ = Pc.Println("dependencies:")
+		depNames := make([]string, 0, len(info.Dependencies))
+		for depName := range info.Dependencies {
+			depNames = append(depNames, depName)
+		}
+		sort.Strings(depNames)
+		for _, depName := range depNames {
+			_, _ = Pc.Printf("  %-12s %s\n", depName, strings.Join(info.Dependencies[depName], ", "))
+		}
+	}
+
+	if len(info.Modules) > 0 {
+		_, _ = Pc.Println("modules:")
+		for _, mdlName := range info.Modules {
+			_, _ = Pc.Printf("  %s\n", mdlName)
+		}
+	}
+}
+
+type SvcVarsParams struct {
+	Format      string
+	ShowSecrets bool
+}
+
+const secretMask = "****"
+
+func (svc *Service) DumpVars(params *SvcVarsParams) error {
+	table, err := svc.varsTable(params)
+	if err != nil {
+		return err
+	}
+
+	return table.Print(params.Format)
+}
+
+func (svc *Service) varsTable(params *SvcVarsParams) (*OutputTable, error) {
+	ctx, err := svc.GetEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	table := &OutputTable{Columns: []string{"name", "value"}, Separator: "="}
+	for _, pair := range ctx {
+		table.Rows = append(table.Rows, []string{pair[0], svc.Config.maskSecret(pair[0], pair[1], params.ShowSecrets)})
+	}
+
+	return table, nil
+}
+
+// dumpAllVars prints variables of all services grouped by service,
+// in json format it is an object with services as keys and objects of variables as values.
+func dumpAllVars(cfg *MainConfig, params *SvcVarsParams) error {
+	svcNames := cfg.GetAllSvcNames()
+	sort.Strings(svcNames)
+
+	tables := make([]*OutputTable, 0, len(svcNames))
+	for _, svcName := range svcNames {
+		svc, err := CreateFromSvcName(cfg, svcName)
+		if err != nil {
+			return err
+		}
+		table, err := svc.varsTable(params)
+		if err != nil {
+			return err
+		}
+		tables = append(tables, table)
+	}
+
+	if params.Format == FormatJson {
+		result := make(map[string]map[string]string)
+		for i, table := range tables {
+			vars := make(map[string]string)
+			for _, row := range table.Rows {
+				vars[row[0]] = row[1]
+			}
+			result[svcNames[i]] = vars
+		}
+
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, _ = Pc.Println(string(data))
+
+		return nil
+	}
+
+	for i, table := range tables {
+		if i > 0 {
+			_, _ = Pc.Println("")
+		}
+		_, _ = Pc.Printf("# %s\n", svcNames[i])
+		err := table.Print(params.Format)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DiffVars compares real values of variables, but prints values of secret variables masked,
+// so it is still visible that they differ.
+func (svc *Service) DiffVars(other *Service, params *SvcVarsParams) error {
 	ctx, err := svc.GetEnv()
 	if err != nil {
 		return err
 	}
 
-	for _, line := range ctx.renderMapToEnv() {
-		_, _ = Pc.Println(line)
+	otherCtx, err := other.GetEnv()
+	if err != nil {
+		return err
+	}
+
+	mask := func(name string, value string) string {
+		return svc.Config.maskSecret(name, value, params.ShowSecrets)
+	}
+
+	for _, pair := range ctx {
+		otherValue, found := otherCtx.find(pair[0])
+		if !found {
+			_, _ = Pc.Printf("-%s=%s\n", pair[0], mask(pair[0], pair[1]))
+		} else if otherValue != pair[1] {
+			_, _ = Pc.Printf("-%s=%s\n", pair[0], mask(pair[0], pair[1]))
+			_, _ = Pc.Printf("+%s=%s\n", pair[0], mask(pair[0], otherValue))
+		}
+	}
+
+	for _, pair := range otherCtx {
+		_, found := ctx.find(pair[0])
+		if !found {
+			_, _ = Pc.Printf("+%s=%s\n", pair[0], mask(pair[0], pair[1]))
+		}
 	}
 
 	return nil
@@ -0,0 +1,49 @@
+package src
+
+import (
+	"gopkg.in/yaml.v2"
+	"path"
+)
+
+const stateFileName = ".elc-state.yaml"
+
+type WorkspaceState struct {
+	Path           string            `yaml:"-"`
+	Checksums      map[string]string `yaml:"checksums"`
+	BuildChecksums map[string]string `yaml:"build_checksums,omitempty"`
+	LastService    string            `yaml:"last_service,omitempty"`
+}
+
+func LoadWorkspaceState(workspacePath string) (*WorkspaceState, error) {
+	state := &WorkspaceState{Path: path.Join(workspacePath, stateFileName)}
+
+	if Pc.FileExists(state.Path) {
+		yamlFile, err := Pc.ReadFile(state.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		err = yaml.Unmarshal(yamlFile, state)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if state.Checksums == nil {
+		state.Checksums = make(map[string]string)
+	}
+	if state.BuildChecksums == nil {
+		state.BuildChecksums = make(map[string]string)
+	}
+
+	return state, nil
+}
+
+func SaveWorkspaceState(state *WorkspaceState) error {
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return Pc.WriteFile(state.Path, data, 0644)
+}
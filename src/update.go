@@ -0,0 +1,140 @@
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"gopkg.in/yaml.v2"
+	"path"
+	"strings"
+	"time"
+)
+
+const latestReleaseURL = "https://api.github.com/repos/MadridianFox/ensi-local-ctl/releases/latest"
+const noUpdateCheckEnv = "ELC_NO_UPDATE_CHECK"
+
+var updateCheckInterval = 24 * time.Hour
+
+type updateCheckCache struct {
+	CheckedAt     time.Time `yaml:"checked_at"`
+	LatestVersion string    `yaml:"latest_version"`
+}
+
+func updateCheckCachePath(homeConfigPath string) string {
+	return path.Join(path.Dir(homeConfigPath), ".elc-update-check.yaml")
+}
+
+// StartUpdateCheck looks for new version of elc in background, if update_check is enabled in home config.
+// Command is not delayed by the check, its result is printed with PrintUpdateNotice.
+func StartUpdateCheck(homeConfigPath string) <-chan string {
+	notices := make(chan string, 1)
+	// Pc may be wrapped by command while check is running, so goroutine keeps its own reference.
+	pc := Pc
+	go func() {
+		defer close(notices)
+		defer HandlePanic()
+		notice, err := checkForUpdate(pc, homeConfigPath)
+		if err == nil && notice != "" {
+			notices <- notice
+		}
+	}()
+
+	return notices
+}
+
+// PrintUpdateNotice prints result of update check to stderr, if it is already known.
+func PrintUpdateNotice(notices <-chan string) {
+	select {
+	case notice, ok := <-notices:
+		if ok {
+			Warn("%s\n", notice)
+		}
+	default:
+	}
+}
+
+// checkForUpdate returns notice about new version. Latest version is requested no more than once a day,
+// between requests it is taken from cache file next to home config.
+func checkForUpdate(pc PC, homeConfigPath string) (string, error) {
+	if value, found := pc.LookupEnv(noUpdateCheckEnv); found && value != "" && value != "0" {
+		return "", nil
+	}
+
+	if !pc.FileExists(homeConfigPath) {
+		return "", nil
+	}
+	data, err := pc.ReadFile(homeConfigPath)
+	if err != nil {
+		return "", err
+	}
+	hc := &HomeConfig{}
+	err = yaml.Unmarshal(data, hc)
+	if err != nil || !hc.UpdateCheck {
+		return "", err
+	}
+
+	cachePath := updateCheckCachePath(homeConfigPath)
+	cache := &updateCheckCache{}
+	if pc.FileExists(cachePath) {
+		data, err = pc.ReadFile(cachePath)
+		if err == nil {
+			_ = yaml.Unmarshal(data, cache)
+		}
+	}
+
+	if time.Since(cache.CheckedAt) > updateCheckInterval {
+		latest, err := fetchLatestVersion(pc)
+		if err != nil {
+			return "", err
+		}
+		cache = &updateCheckCache{CheckedAt: time.Now(), LatestVersion: latest}
+		data, err = yaml.Marshal(cache)
+		if err != nil {
+			return "", err
+		}
+		err = pc.WriteFile(cachePath, data, 0644)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if !isNewerVersion(cache.LatestVersion) {
+		return "", nil
+	}
+
+	return fmt.Sprintf("New version of elc %s is available, current version is %s. Run 'elc update' to install it.", cache.LatestVersion, Version), nil
+}
+
+func fetchLatestVersion(pc PC) (string, error) {
+	data, err := pc.HttpGet(latestReleaseURL)
+	if err != nil {
+		return "", err
+	}
+
+	release := struct {
+		TagName string `json:"tag_name"`
+	}{}
+	err = json.Unmarshal(data, &release)
+	if err != nil {
+		return "", err
+	}
+	if release.TagName == "" {
+		return "", errors.New("latest release has no tag")
+	}
+
+	return strings.TrimPrefix(release.TagName, "v"), nil
+}
+
+func isNewerVersion(latest string) bool {
+	vLatest, err := version.NewVersion(latest)
+	if err != nil {
+		return false
+	}
+	vElc, err := version.NewVersion(Version)
+	if err != nil {
+		return false
+	}
+
+	return vElc.LessThan(vLatest)
+}